@@ -0,0 +1,209 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/repo"
+	"github.com/Jarnpher553/gemini/service"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var logger = log.Zap.Mark("audit")
+
+// Record 审计记录，一次非GET请求对应一条
+type Record struct {
+	ID        uint64    `gorm:"primary_key;AUTO_INCREMENT" json:"id" bson:"-"`
+	Principal string    `gorm:"type:varchar(64);index" json:"principal" bson:"principal"`
+	Tenant    string    `gorm:"type:varchar(64);index" json:"tenant" bson:"tenant"`
+	Route     string    `gorm:"type:varchar(255)" json:"route" bson:"route"`
+	Method    string    `gorm:"type:varchar(16)" json:"method" bson:"method"`
+	Path      string    `gorm:"type:varchar(255)" json:"path" bson:"path"`
+	ClientIP  string    `gorm:"type:varchar(64)" json:"clientIp" bson:"clientIp"`
+	Body      string    `gorm:"type:text" json:"body" bson:"body"`
+	Status    int       `json:"status" bson:"status"`
+	Code      int       `json:"code" bson:"code"`
+	Latency   int64     `json:"latency" bson:"latency"`
+	Changes   Changes   `gorm:"type:mediumtext" json:"changes" bson:"changes"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt" bson:"createdAt"`
+}
+
+func (Record) TableName() string {
+	return "audit_record"
+}
+
+// Changes 请求内通过repo修改的数据，以JSON存储
+type Changes []*repo.Change
+
+func (c Changes) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+func (c *Changes) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return errors.New("audit: unsupported changes type")
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	return json.Unmarshal(b, c)
+}
+
+type recorderKey struct{}
+
+// recorder 收集请求内的变更，repo可能在多个goroutine中修改数据
+type recorder struct {
+	m       sync.Mutex
+	changes Changes
+}
+
+// Hook 将repo的变更附加到请求的审计记录，通过repo.Hooks(audit.Hook)配置
+// repo需通过WithContext传入请求的context，不在审计请求内的变更被忽略
+func Hook(ctx context.Context, changes []*repo.Change) {
+	r, ok := ctx.Value(recorderKey{}).(*recorder)
+	if !ok {
+		return
+	}
+	r.m.Lock()
+	r.changes = append(r.changes, changes...)
+	r.m.Unlock()
+}
+
+type auditor struct {
+	sink    Sink
+	redact  map[string]bool
+	maxBody int
+}
+
+// Option 配置函数
+type Option func(*auditor)
+
+// Redact 追加需要脱敏的请求字段，不区分大小写，默认包含password、token、secret等
+func Redact(fields ...string) Option {
+	return func(a *auditor) {
+		for _, f := range fields {
+			a.redact[normalize(f)] = true
+		}
+	}
+}
+
+// MaxBody 记录的请求体最大字节数，默认64KB，JSON与表单请求体最多读取n+1字节，超出时只记录长度，脱敏后超出的部分截断
+func MaxBody(n int) Option {
+	return func(a *auditor) {
+		a.maxBody = n
+	}
+}
+
+// Middleware 审计中间件，记录非GET请求的操作者、租户、路由、脱敏后的请求体、响应码与耗时并写入sink
+// 操作者取UserID、UserGUID或UserInfo，租户取自service.TenantHeader请求头
+func Middleware(sink Sink, options ...Option) service.Middleware {
+	a := &auditor{sink: sink, redact: make(map[string]bool), maxBody: 64 << 10}
+	for _, f := range defaultRedact {
+		a.redact[f] = true
+	}
+	for _, op := range options {
+		op(a)
+	}
+
+	return func(srv service.IBaseService) service.HandlerFunc {
+		return func(c *service.Ctx) {
+			switch c.Request.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return
+			}
+
+			begin := time.Now()
+			record := &Record{
+				Route:     c.FullPath(),
+				Method:    c.Request.Method,
+				Path:      c.Request.URL.Path,
+				ClientIP:  c.ClientIP(),
+				Tenant:    c.GetHeader(service.TenantHeader),
+				CreatedAt: begin,
+			}
+			record.Body = a.readBody(c.Request, c.ContentType())
+			rec := &recorder{}
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), recorderKey{}, rec))
+
+			c.Next()
+
+			record.Principal = principal(c)
+			record.Status = c.Writer.Status()
+			record.Code, _ = c.ResponseCode()
+			record.Latency = time.Since(begin).Milliseconds()
+			rec.m.Lock()
+			record.Changes = rec.changes
+			rec.m.Unlock()
+
+			if err := a.sink.Write(c.Request.Context(), record); err != nil {
+				c.Logger().Error(log.Message("write audit record error:", err))
+			}
+		}
+	}
+}
+
+// readCloser 放回已读取部分的请求体，关闭时关闭原请求体
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// readBody 只读取JSON与表单请求体，最多读取maxBody+1字节，读取的部分放回请求体，其它类型只记录长度
+func (a *auditor) readBody(r *http.Request, contentType string) string {
+	if r.Body == nil || r.Body == http.NoBody {
+		return ""
+	}
+	if !redactable(contentType) {
+		if r.ContentLength < 0 {
+			return fmt.Sprintf("<%s>", contentType)
+		}
+		return fmt.Sprintf("<%s %d bytes>", contentType, r.ContentLength)
+	}
+
+	var reader io.Reader = r.Body
+	if a.maxBody > 0 {
+		reader = io.LimitReader(r.Body, int64(a.maxBody)+1)
+	}
+	body, _ := ioutil.ReadAll(reader)
+	r.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(body), r.Body), Closer: r.Body}
+
+	//不完整的请求体无法脱敏，不记录内容
+	if a.maxBody > 0 && len(body) > a.maxBody {
+		return fmt.Sprintf("<%s over %d bytes>", contentType, a.maxBody)
+	}
+	return a.body(contentType, body)
+}
+
+func principal(c *service.Ctx) string {
+	if id, ok := c.UserID(); ok {
+		return strconv.Itoa(id)
+	}
+	if guid, ok := c.UserGUID(); ok {
+		return string(guid)
+	}
+	if info, ok := c.UserInfo(); ok {
+		return info
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/queue"
+	"github.com/Jarnpher553/gemini/repo"
+	"github.com/Jarnpher553/gemini/service"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+type product struct {
+	ID    int `gorm:"primary_key"`
+	Name  string
+	Price int
+}
+
+func newRepo(t *testing.T) *repo.Repository {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp := &repo.Repository{DB: db, Logger: log.Zap.Mark("repo")}
+	repo.Hooks(Hook)(rp)
+	rp.Migrate(nil, &product{})
+	_ = rp.Insert(&product{ID: 1, Name: "apple", Price: 100})
+	_ = rp.Insert(&product{ID: 2, Name: "pear", Price: 50})
+	return rp
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rp := newRepo(t)
+	defer rp.Close()
+
+	records := make(chan *Record, 10)
+	sink := SinkFunc(func(ctx context.Context, r *Record) error {
+		records <- r
+		return nil
+	})
+
+	engine := gin.New()
+	auth := service.Wrapper(func(c *service.Ctx) {
+		c.SetUserID(7)
+	})
+	audit := service.Wrapper(Middleware(sink, Redact("phone"))(nil))
+	engine.POST("/products/:id", auth, audit, service.Wrapper(func(c *service.Ctx) {
+		r := rp.WithContext(c.Request.Context())
+		if _, err := r.ModifyColumns(&product{ID: 1}, map[string]interface{}{"price": 120, "name": "apple"}); err != nil {
+			c.Failure(500, err)
+			return
+		}
+		if err := r.Remove(&product{ID: 2}); err != nil {
+			c.Failure(500, err)
+			return
+		}
+		c.Success(nil)
+	}))
+	engine.GET("/products/:id", auth, audit, service.Wrapper(func(c *service.Ctx) {
+		c.Success(nil)
+	}))
+
+	body := `{"name":"apple","password":"p@ss","contact":{"Phone":"123"}}`
+	req := httptest.NewRequest(http.MethodPost, "/products/1", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(service.TenantHeader, "t1")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/products/1", nil))
+
+	var r *Record
+	select {
+	case r = <-records:
+	case <-time.After(time.Second):
+		t.Fatal("record timeout")
+	}
+	if len(records) != 0 {
+		t.Fatal("GET should not be audited")
+	}
+
+	if r.Principal != "7" || r.Tenant != "t1" || r.Route != "/products/:id" || r.Status != http.StatusOK || r.Code != 200 {
+		t.Fatalf("unexpected record %+v", r)
+	}
+	if strings.Contains(r.Body, "p@ss") || strings.Contains(r.Body, "123") || !strings.Contains(r.Body, "apple") {
+		t.Fatalf("body should be redacted, got %s", r.Body)
+	}
+
+	if len(r.Changes) != 2 {
+		t.Fatalf("unexpected changes %+v", r.Changes)
+	}
+	modify, remove := r.Changes[0], r.Changes[1]
+	if modify.Action != repo.ActionModify || modify.Table != "products" || modify.Before["price"] != 100 || modify.After["price"] != 120 || len(modify.After) != 1 {
+		t.Fatalf("unexpected modify change %+v", modify)
+	}
+	if remove.Action != repo.ActionRemove || remove.Before["name"] != "pear" || remove.After != nil {
+		t.Fatalf("unexpected remove change %+v", remove)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	records := make(chan *Record, 1)
+	Consume("audit", SinkFunc(func(ctx context.Context, r *Record) error {
+		records <- r
+		return nil
+	}))
+	queue.Bind(queue.Memory())
+
+	err := Queue("audit").Write(context.Background(), &Record{Principal: "7", Changes: Changes{{Table: "products", Action: repo.ActionRemove}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-records:
+		if r.Principal != "7" || len(r.Changes) != 1 || r.Changes[0].Table != "products" {
+			b, _ := json.Marshal(r)
+			t.Fatalf("unexpected record %s", b)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("consume timeout")
+	}
+}
+
+func TestMiddleware_Body(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	records := make(chan *Record, 10)
+	sink := SinkFunc(func(ctx context.Context, r *Record) error {
+		records <- r
+		return nil
+	})
+
+	received := make(chan int, 10)
+	engine := gin.New()
+	engine.POST("/upload", service.Wrapper(Middleware(sink, MaxBody(32))(nil)), func(c *gin.Context) {
+		b, _ := ioutil.ReadAll(c.Request.Body)
+		received <- len(b)
+	})
+
+	cases := []struct {
+		contentType string
+		body        string
+		want        string
+	}{
+		{"multipart/form-data; boundary=x", strings.Repeat("a", 1024), "<multipart/form-data 1024 bytes>"},
+		{"application/json", `{"name":"` + strings.Repeat("a", 64) + `"}`, "<application/json over 32 bytes>"},
+		{"application/json", `{"name":"苹果"}`, `{"name":"苹果"}`},
+		{"application/json", `{"id":9007199254740993}`, `{"id":9007199254740993}`},
+		{"application/json", `{"password":"p@ss"`, "<application/json unparsable 18 bytes>"},
+		{"application/json", `{"pwd":"a"} {"pwd":"b"}`, "<application/json unparsable 23 bytes>"},
+		{"application/x-www-form-urlencoded", "password=%zz", "<application/x-www-form-urlencoded unparsable 12 bytes>"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(c.body))
+		req.Header.Set("Content-Type", c.contentType)
+		engine.ServeHTTP(httptest.NewRecorder(), req)
+
+		if n := <-received; n != len(c.body) {
+			t.Fatalf("handler should read the whole body, got %d of %d", n, len(c.body))
+		}
+		if r := <-records; r.Body != c.want {
+			t.Fatalf("want body %s, got %s", c.want, r.Body)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	a := &auditor{redact: map[string]bool{}, maxBody: 11}
+	s := a.body("application/json", []byte(`{"name":"苹果梨"}`))
+	if !utf8.ValidString(s) || len(s) > 11 || s != `{"name":"` {
+		t.Fatalf("truncate should keep valid utf8, got %q", s)
+	}
+}
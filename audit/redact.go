@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+const redacted = "******"
+
+// defaultRedact 默认脱敏的字段，比较时忽略大小写、下划线与中划线
+var defaultRedact = []string{"password", "pwd", "oldpassword", "newpassword", "token", "accesstoken", "refreshtoken", "secret", "apikey", "authorization", "idcard", "bankcard"}
+
+func normalize(field string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(field))
+}
+
+// redactable 可以脱敏的请求体类型
+func redactable(contentType string) bool {
+	return strings.Contains(contentType, "json") || contentType == "application/x-www-form-urlencoded"
+}
+
+// body 脱敏JSON与表单请求体，multipart等其它类型以及解析失败的请求体只记录长度，不记录原文
+func (a *auditor) body(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var s string
+	switch {
+	case strings.Contains(contentType, "json"):
+		v, err := decodeJSON(body)
+		if err != nil {
+			return fmt.Sprintf("<%s unparsable %d bytes>", contentType, len(body))
+		}
+		b, _ := json.Marshal(a.redactValue(v))
+		s = string(b)
+	case contentType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return fmt.Sprintf("<%s unparsable %d bytes>", contentType, len(body))
+		}
+		for k := range values {
+			if a.redact[normalize(k)] {
+				values[k] = []string{redacted}
+			}
+		}
+		s = values.Encode()
+	default:
+		return fmt.Sprintf("<%s %d bytes>", contentType, len(body))
+	}
+
+	if a.maxBody > 0 && len(s) > a.maxBody {
+		s = truncate(s, a.maxBody)
+	}
+	return s
+}
+
+// decodeJSON 数字解码为json.Number，避免int64的ID经float64后失真
+func decodeJSON(body []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid character after top-level value")
+	}
+	return v, nil
+}
+
+// truncate 截断至不超过n字节，不拆分多字节字符
+func truncate(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func (a *auditor) redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			if a.redact[normalize(k)] {
+				v[k] = redacted
+			} else {
+				v[k] = a.redactValue(item)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = a.redactValue(v[i])
+		}
+	}
+	return v
+}
@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/mongo"
+	"github.com/Jarnpher553/gemini/queue"
+	"github.com/Jarnpher553/gemini/repo"
+	"time"
+)
+
+// Sink 审计记录的存储
+type Sink interface {
+	Write(ctx context.Context, r *Record) error
+}
+
+// SinkFunc 函数形式的Sink
+type SinkFunc func(ctx context.Context, r *Record) error
+
+func (f SinkFunc) Write(ctx context.Context, r *Record) error {
+	return f(ctx, r)
+}
+
+type repoSink struct {
+	repo *repo.Repository
+}
+
+// Repo 写入MySQL的audit_record表，构造时迁移表结构
+func Repo(rp *repo.Repository) Sink {
+	rp.Migrate(nil, &Record{})
+	return &repoSink{repo: rp}
+}
+
+func (s *repoSink) Write(ctx context.Context, r *Record) error {
+	return s.repo.WithContext(ctx).Insert(r)
+}
+
+type mongoSink struct {
+	client *mongo.MgoClient
+}
+
+// Mongo 写入client配置的Database与Collection
+func Mongo(client *mongo.MgoClient) Sink {
+	return &mongoSink{client: client}
+}
+
+// Write 请求结束时客户端可能已断开，不使用请求的context
+func (s *mongoSink) Write(_ context.Context, r *Record) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.client.DbCollection().InsertOne(ctx, r)
+	return err
+}
+
+type queueSink struct {
+	name string
+}
+
+// Queue 以JSON发布到queue，由Consume异步写入其它Sink，queue.Bind时以queue.Trace开启该队列可传递链路信息
+func Queue(name string) Sink {
+	return &queueSink{name: name}
+}
+
+func (s *queueSink) Write(ctx context.Context, r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return queue.PublishContext(ctx, s.name, string(b))
+}
+
+// Consume 消费Queue发布的审计记录并写入sink，写入失败时拒绝消息，需在queue.Bind之前调用
+func Consume(name string, sink Sink) {
+	queue.Assign(name, 100, time.Second, func(d queue.Delivery, _ *queue.Configuration) {
+		r := &Record{}
+		if err := json.Unmarshal([]byte(d.Payload()), r); err != nil {
+			logger.Error(log.Message("decode audit record error:", err))
+			_ = d.Reject()
+			return
+		}
+		if err := sink.Write(queue.DeliveryContext(d), r); err != nil {
+			logger.Error(log.Message("write audit record error:", err))
+			_ = d.Reject()
+			return
+		}
+		_ = d.Ack()
+	})
+}
@@ -20,6 +20,9 @@ var logger = log.Zap.Mark("config")
 
 var conf *Config
 
+// secrets DeployEnv中包含密钥引用的配置项
+var secrets map[string]bool
+
 func Conf() *Config {
 	return conf
 }
@@ -75,5 +78,15 @@ func DeployEnv(osArgs []string, factories ...Factory) (env string) {
 	if conf == nil {
 		logger.Fatal("the config of deploy env is nil")
 	}
+	resolved, err := resolveConfig(conf)
+	if err != nil {
+		logger.Fatal(log.Message(err))
+	}
+	secrets = resolved
+	if conf.IsSet("log") {
+		if err := SetupLog(conf.Sub("log")); err != nil {
+			logger.Fatal(log.Message(err))
+		}
+	}
 	return
 }
@@ -0,0 +1,256 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/validator"
+	"github.com/Jarnpher553/viper"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Loader 由多个来源按顺序分层合并的配置，不依赖包级的conf，可同时存在多个
+// 常见顺序为FileSource、EnvSource、RemoteSource、FlagSource，后者覆盖前者
+type Loader struct {
+	sources []Source
+	m       sync.RWMutex
+	conf    *Config
+	secrets map[string]bool
+	subs    []*subscriber
+	reload  sync.Mutex
+}
+
+type subscriber struct {
+	key string
+	fn  func(*Config)
+}
+
+// NewLoader 构造函数，立即加载所有来源
+func NewLoader(sources ...Source) (*Loader, error) {
+	l := &Loader{sources: sources}
+	conf, secrets, err := l.load()
+	if err != nil {
+		return nil, err
+	}
+	l.conf, l.secrets = conf, secrets
+	return l, nil
+}
+
+// Config 当前的配置，重新加载后返回新的实例
+func (l *Loader) Config() *Config {
+	l.m.RLock()
+	defer l.m.RUnlock()
+	return l.conf
+}
+
+// Redacted 返回用于打印的配置，密钥引用解析出的值以及名称敏感的配置项显示为******
+func (l *Loader) Redacted() map[string]interface{} {
+	l.m.RLock()
+	defer l.m.RUnlock()
+	return redact(l.conf, l.secrets)
+}
+
+// Bind 将key下的配置绑定到结构体指针out，key为空时为整个配置，规则见Bind函数
+func (l *Loader) Bind(key string, out interface{}) error {
+	return Bind(sub(l.Config(), key), out)
+}
+
+// OnChange 重新加载后key下的配置发生变化时调用fn，key为空时任意变化都调用
+// fn的参数为key下的新配置，通常在其中调用Bind后更新限流（limit.Limiter的SetLimit、SetBurst）、日志级别等设置
+// 熔断器（breaker）的参数在创建后不可修改，不在热更新范围内，修改后需重启生效
+func (l *Loader) OnChange(key string, fn func(c *Config)) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.subs = append(l.subs, &subscriber{key: strings.ToLower(key), fn: fn})
+}
+
+// Reload 重新加载所有来源，出错时保留原配置
+func (l *Loader) Reload() error {
+	l.reload.Lock()
+	defer l.reload.Unlock()
+
+	conf, secrets, err := l.load()
+	if err != nil {
+		return err
+	}
+
+	l.m.Lock()
+	old := l.conf
+	l.conf, l.secrets = conf, secrets
+	subs := append([]*subscriber{}, l.subs...)
+	l.m.Unlock()
+
+	for _, s := range subs {
+		if reflect.DeepEqual(settings(old, s.key), settings(conf, s.key)) {
+			continue
+		}
+		s.fn(sub(conf, s.key))
+	}
+	return nil
+}
+
+// Watch 监听所有实现Watcher的来源，变化时重新加载，直到ctx结束
+func (l *Loader) Watch(ctx context.Context) {
+	for _, source := range l.sources {
+		w, ok := source.(Watcher)
+		if !ok {
+			continue
+		}
+		go func(w Watcher) {
+			err := w.Watch(ctx, func() {
+				if err := l.Reload(); err != nil {
+					logger.Error(log.Message("reload config error:", err))
+					return
+				}
+				logger.Info("config reloaded")
+			})
+			if err != nil {
+				logger.Error(log.Message("watch config error:", err))
+			}
+		}(w)
+	}
+}
+
+// load 合并所有来源后解析密钥引用
+func (l *Loader) load() (*Config, map[string]bool, error) {
+	merged := make(map[string]interface{})
+	for _, source := range l.sources {
+		m, err := source.Load(merged)
+		if err != nil {
+			return nil, nil, err
+		}
+		merge(merged, m)
+	}
+
+	secrets := make(map[string]bool)
+	if err := resolve(merged, "", secrets); err != nil {
+		return nil, nil, err
+	}
+
+	v := viper.New()
+	if err := v.MergeConfigMap(merged); err != nil {
+		return nil, nil, err
+	}
+	return v, secrets, nil
+}
+
+func sub(c *Config, key string) *Config {
+	if key == "" || c == nil {
+		return c
+	}
+	return c.Sub(key)
+}
+
+func settings(c *Config, key string) interface{} {
+	if key == "" {
+		return c.AllSettings()
+	}
+	return c.Get(key)
+}
+
+// Bind 将配置绑定到结构体指针out：先按default标签设置默认值，再以mapstructure规则解码，最后按binding标签校验
+// c为nil时只设置默认值并校验
+func Bind(c *Config, out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: bind target must be a pointer to struct, got %T", out)
+	}
+
+	if err := defaults(v.Elem()); err != nil {
+		return err
+	}
+	if c != nil {
+		if err := c.Unmarshal(out); err != nil {
+			return err
+		}
+	}
+	return validator.Struct(out)
+}
+
+// defaults 为零值字段设置default标签的值，嵌套结构体递归处理
+func defaults(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+
+		tag, ok := t.Field(i).Tag.Lookup("default")
+		if !ok {
+			if field.Kind() == reflect.Struct && field.Type() != reflect.TypeOf(time.Time{}) {
+				if err := defaults(field); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !isZero(field) {
+			continue
+		}
+		if err := setDefault(field, tag); err != nil {
+			return fmt.Errorf("config: default of %s.%s: %w", t.Name(), t.Field(i).Name, err)
+		}
+	}
+	return nil
+}
+
+func isZero(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+func setDefault(v reflect.Value, s string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		parts := strings.Split(s, ",")
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setDefault(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
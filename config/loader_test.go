@@ -0,0 +1,125 @@
+package config
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type serverConf struct {
+	Host    string        `default:"0.0.0.0"`
+	Port    int           `binding:"required,gt=0"`
+	Timeout time.Duration `default:"5s"`
+	Limit   struct {
+		Rate  float64 `default:"100"`
+		Burst int     `default:"10"`
+	}
+}
+
+func writeConf(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoader_Layers(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "config")
+	defer os.RemoveAll(dir)
+	writeConf(t, filepath.Join(dir, "config.toml"), `
+[dev.server]
+port = 8080
+timeout = "10s"
+
+[dev.server.limit]
+rate = 20
+`)
+
+	_ = os.Setenv("APP_SERVER_PORT", "9090")
+	defer os.Unsetenv("APP_SERVER_PORT")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("server.limit.burst", "", "")
+	_ = fs.Parse([]string{"-server.limit.burst=50"})
+
+	l, err := NewLoader(
+		Section("dev", FileSource(Path(dir), Name("config"), Type("toml"))),
+		EnvSource("app"),
+		FlagSource(fs),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var conf serverConf
+	if err := l.Bind("server", &conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Host != "0.0.0.0" || conf.Port != 9090 || conf.Timeout != 10*time.Second {
+		t.Fatalf("unexpected conf %+v", conf)
+	}
+	if conf.Limit.Rate != 20 || conf.Limit.Burst != 50 {
+		t.Fatalf("unexpected limit %+v", conf.Limit)
+	}
+
+	var missing serverConf
+	if err := l.Bind("missing", &missing); err == nil {
+		t.Fatal("port is required")
+	}
+}
+
+func TestLoader_Watch(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "config")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	writeConf(t, path, "[server]\nport = 8080\n[log]\nlevel = \"info\"\n")
+
+	l, err := NewLoader(FileSource(Path(dir), Name("config"), Type("toml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := make(chan int, 4)
+	l.OnChange("server", func(c *Config) {
+		var conf serverConf
+		if err := Bind(c, &conf); err == nil {
+			server <- conf.Port
+		}
+	})
+	level := make(chan string, 4)
+	l.OnChange("log", func(c *Config) {
+		level <- c.GetString("level")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l.Watch(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	writeConf(t, path, "[server]\nport = 8081\n[log]\nlevel = \"info\"\n")
+	select {
+	case port := <-server:
+		if port != 8081 {
+			t.Fatalf("unexpected port %d", port)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("reload timeout")
+	}
+	select {
+	case <-level:
+		t.Fatal("unchanged section should not be notified")
+	default:
+	}
+	if got := l.Config().GetInt("server.port"); got != 8081 {
+		t.Fatalf("unexpected port %d", got)
+	}
+}
+
+func TestRemoteSource_Error(t *testing.T) {
+	if _, err := NewLoader(RemoteSource(0, "unknown", "127.0.0.1:8500", "config")); err == nil {
+		t.Fatal("unsupported provider should return error")
+	}
+}
@@ -0,0 +1,12 @@
+package config
+
+import "github.com/Jarnpher553/gemini/log"
+
+// SetupLog 按配置的log节设置日志，可在Loader.OnChange("log", ...)中调用以随配置更新
+func SetupLog(c *Config) error {
+	var conf log.Config
+	if err := Bind(c, &conf); err != nil {
+		return err
+	}
+	return log.Setup(conf)
+}
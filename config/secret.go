@@ -0,0 +1,256 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	consul "github.com/hashicorp/consul/api"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// KeyEnv 保存enc引用解密密钥的环境变量，值为base64编码的16、24或32字节AES密钥
+var KeyEnv = "GEMINI_CONFIG_KEY"
+
+const redacted = "******"
+
+// Resolver 解析密钥引用${scheme:ref}中的ref，返回明文
+type Resolver func(ref string) (string, error)
+
+var (
+	resolverMu sync.RWMutex
+	resolvers  = map[string]Resolver{
+		"env":  envResolver,
+		"file": fileResolver,
+		"enc":  encResolver,
+	}
+	reference = regexp.MustCompile(`\$\{([a-zA-Z][a-zA-Z0-9_-]*):([^}]*)\}`)
+	sensitive = regexp.MustCompile(`(?i)(password|passwd|pwd|secret|token|credential|private_?key|access_?key)`)
+)
+
+// RegisterResolver 注册密钥引用的解析方式，内置env、file、enc，consul需以ConsulResolver注册
+func RegisterResolver(scheme string, resolver Resolver) {
+	resolverMu.Lock()
+	defer resolverMu.Unlock()
+	resolvers[scheme] = resolver
+}
+
+func envResolver(ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("env %s is not set", ref)
+	}
+	return value, nil
+}
+
+// fileResolver 读取文件内容，去掉末尾换行，适用于docker、k8s挂载的secret
+func fileResolver(ref string) (string, error) {
+	b, err := ioutil.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func encResolver(ref string) (string, error) {
+	key, err := secretKey()
+	if err != nil {
+		return "", err
+	}
+	return Decrypt(ref, key)
+}
+
+// ConsulResolver 从consul KV读取密钥，如${consul:secret/mysql/password}
+func ConsulResolver(client *consul.Client) Resolver {
+	return func(ref string) (string, error) {
+		pair, _, err := client.KV().Get(ref, nil)
+		if err != nil {
+			return "", err
+		}
+		if pair == nil {
+			return "", fmt.Errorf("consul key %s not found", ref)
+		}
+		return string(pair.Value), nil
+	}
+}
+
+func secretKey() ([]byte, error) {
+	encoded := os.Getenv(KeyEnv)
+	if encoded == "" {
+		return nil, fmt.Errorf("env %s is not set", KeyEnv)
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// Encrypt 以AES-GCM加密，返回可直接写入配置文件的${enc:...}引用
+func Encrypt(plaintext string, key []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return "${enc:" + base64.StdEncoding.EncodeToString(sealed) + "}", nil
+}
+
+// Decrypt 解密Encrypt生成的引用中的密文
+func Decrypt(ciphertext string, key []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// resolve 解析m中所有字符串里的密钥引用，scheme未注册时返回错误，返回包含引用的配置项
+func resolve(m map[string]interface{}, prefix string, secrets map[string]bool) error {
+	for k, v := range m {
+		resolved, found, err := resolveValue(v, prefix+k, secrets)
+		if err != nil {
+			return err
+		}
+		if found {
+			m[k] = resolved
+			secrets[prefix+k] = true
+		}
+	}
+	return nil
+}
+
+func resolveValue(v interface{}, key string, secrets map[string]bool) (interface{}, bool, error) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		return nil, false, resolve(value, key+".", secrets)
+	case []interface{}:
+		var found bool
+		for i := range value {
+			resolved, ok, err := resolveValue(value[i], key, secrets)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				value[i], found = resolved, true
+			}
+		}
+		return value, found, nil
+	case string:
+		return resolveString(value, key)
+	}
+	return v, false, nil
+}
+
+func resolveString(s string, key string) (string, bool, error) {
+	if !strings.Contains(s, "${") {
+		return s, false, nil
+	}
+
+	var found bool
+	var err error
+	out := reference.ReplaceAllStringFunc(s, func(ref string) string {
+		match := reference.FindStringSubmatch(ref)
+		resolverMu.RLock()
+		resolver, ok := resolvers[match[1]]
+		resolverMu.RUnlock()
+		if err != nil {
+			return ref
+		}
+		if !ok {
+			err = fmt.Errorf("config: unknown secret scheme %s of %s", match[1], key)
+			return ref
+		}
+
+		found = true
+		value, e := resolver(match[2])
+		if e != nil {
+			err = fmt.Errorf("config: resolve %s of %s: %w", match[1], key, e)
+			return ref
+		}
+		return value
+	})
+	return out, found, err
+}
+
+// resolveConfig 解析viper实例中的密钥引用
+func resolveConfig(c *Config) (map[string]bool, error) {
+	secrets := make(map[string]bool)
+	for _, key := range c.AllKeys() {
+		value, found, err := resolveValue(c.Get(key), key, secrets)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			c.Set(key, value)
+			secrets[key] = true
+		}
+	}
+	return secrets, nil
+}
+
+// Secret 敏感配置值，打印、JSON编码以及通过zap输出时显示为******，Value返回原值
+type Secret string
+
+// Value 原值
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	return redacted
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+// Redact 返回用于打印的配置，名称含password、secret、token等的配置项显示为******
+// c为Conf()时，DeployEnv中由密钥引用解析出的配置项同样显示为******
+func Redact(c *Config) map[string]interface{} {
+	if c != nil && c == conf {
+		return redact(c, secrets)
+	}
+	return redact(c, nil)
+}
+
+func redact(c *Config, secrets map[string]bool) map[string]interface{} {
+	out := make(map[string]interface{})
+	if c == nil {
+		return out
+	}
+	for _, key := range c.AllKeys() {
+		value := c.Get(key)
+		if secrets[key] || sensitive.MatchString(key[strings.LastIndex(key, ".")+1:]) {
+			value = redacted
+		}
+		set(out, key, value)
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mapSource 固定内容的来源
+type mapSource map[string]interface{}
+
+func (s mapSource) Load(map[string]interface{}) (map[string]interface{}, error) {
+	return s, nil
+}
+
+func TestLoader_Secrets(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "secret")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "redis")
+	writeConf(t, file, "redis-pass\n")
+
+	key := make([]byte, 32)
+	encrypted, err := Encrypt("s3cr3t", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Setenv(KeyEnv, base64.StdEncoding.EncodeToString(key))
+	defer os.Unsetenv(KeyEnv)
+	_ = os.Setenv("TEST_DB_USER", "admin")
+	defer os.Unsetenv("TEST_DB_USER")
+	RegisterResolver("vault", func(ref string) (string, error) {
+		return "vault-" + ref, nil
+	})
+
+	l, err := NewLoader(mapSource{
+		"mysql": map[string]interface{}{
+			"dsn":      "${env:TEST_DB_USER}:${enc:" + encrypted[6:len(encrypted)-1] + "}@tcp(127.0.0.1:3306)/demo",
+			"password": "plain",
+		},
+		"redis": map[string]interface{}{
+			"auth": "${file:" + file + "}",
+			"addr": "127.0.0.1:6379",
+		},
+		"token": "${vault:app}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := l.Config()
+	if got := conf.GetString("mysql.dsn"); got != "admin:s3cr3t@tcp(127.0.0.1:3306)/demo" {
+		t.Fatalf("unexpected dsn %s", got)
+	}
+	if conf.GetString("redis.auth") != "redis-pass" || conf.GetString("token") != "vault-app" {
+		t.Fatalf("unexpected settings %v", conf.AllSettings())
+	}
+
+	out := l.Redacted()
+	mysql := out["mysql"].(map[string]interface{})
+	redis := out["redis"].(map[string]interface{})
+	if mysql["dsn"] != redacted || mysql["password"] != redacted || redis["auth"] != redacted || redis["addr"] != "127.0.0.1:6379" {
+		t.Fatalf("unexpected redacted settings %v", out)
+	}
+
+	_, err = NewLoader(mapSource{"password": "${env:TEST_MISSING_PASS}"})
+	if err == nil {
+		t.Fatal("missing env should fail")
+	}
+	_, err = NewLoader(mapSource{"literal": "prefix-${unknown:x}"})
+	if err == nil {
+		t.Fatal("unknown scheme should fail")
+	}
+}
+
+func TestRedact_DeployEnv(t *testing.T) {
+	old, oldSecrets := conf, secrets
+	defer func() {
+		conf, secrets = old, oldSecrets
+	}()
+
+	l, _ := NewLoader(mapSource{"dsn": "root:p@ss@tcp(127.0.0.1:3306)/demo", "addr": "127.0.0.1"})
+	conf, secrets = l.Config(), map[string]bool{"dsn": true}
+	out := Redact(Conf())
+	if out["dsn"] != redacted || out["addr"] != "127.0.0.1" {
+		t.Fatalf("resolved secret should be redacted, got %v", out)
+	}
+}
+
+func TestSecret(t *testing.T) {
+	var conf struct {
+		User     string
+		Password Secret
+	}
+	c, _ := NewLoader(mapSource{"user": "root", "password": "p@ss"})
+	if err := Bind(c.Config(), &conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Password.Value() != "p@ss" {
+		t.Fatalf("unexpected password %s", conf.Password.Value())
+	}
+	if s := fmt.Sprintf("%+v", conf); s != "{User:root Password:******}" {
+		t.Fatalf("password should be redacted, got %s", s)
+	}
+}
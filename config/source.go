@@ -0,0 +1,273 @@
+package config
+
+import (
+	"context"
+	"flag"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/viper"
+	"github.com/fsnotify/fsnotify"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source 配置来源，base为之前的来源合并后的配置，返回的配置覆盖base
+type Source interface {
+	Load(base map[string]interface{}) (map[string]interface{}, error)
+}
+
+// Watcher 可监听变化的配置来源，变化时调用changed，ctx结束时返回
+type Watcher interface {
+	Watch(ctx context.Context, changed func()) error
+}
+
+// fileSource 本地配置文件
+type fileSource struct {
+	options []Option
+	m       sync.Mutex
+	path    string
+}
+
+// FileSource 本地配置文件，选项与File一致，修改文件后触发重新加载
+func FileSource(options ...Option) Source {
+	return &fileSource{options: options}
+}
+
+func (s *fileSource) Load(map[string]interface{}) (map[string]interface{}, error) {
+	v := viper.New()
+	for i := range s.options {
+		s.options[i](v)
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	s.m.Lock()
+	s.path = v.ConfigFileUsed()
+	s.m.Unlock()
+	return v.AllSettings(), nil
+}
+
+func (s *fileSource) Watch(ctx context.Context, changed func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// 监听目录以兼容编辑器先删除再创建文件、k8s ConfigMap替换软链接的方式
+	s.m.Lock()
+	file := filepath.Clean(s.path)
+	s.m.Unlock()
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		return err
+	}
+	real, _ := filepath.EvalSymlinks(file)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			current, _ := filepath.EvalSymlinks(file)
+			if filepath.Clean(ev.Name) == file && ev.Op&(fsnotify.Write|fsnotify.Create) != 0 || current != "" && current != real {
+				real = current
+				changed()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Warn(log.Message("watch config file error:", err))
+		}
+	}
+}
+
+// envSource 环境变量
+type envSource struct {
+	prefix string
+}
+
+// EnvSource 环境变量覆盖已有的配置项，server.port对应PREFIX_SERVER_PORT，prefix为空时为SERVER_PORT
+func EnvSource(prefix string) Source {
+	return &envSource{prefix: prefix}
+}
+
+func (s *envSource) Load(base map[string]interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+	for _, key := range keys(base, "") {
+		name := strings.ToUpper(strings.Replace(key, ".", "_", -1))
+		if s.prefix != "" {
+			name = strings.ToUpper(s.prefix) + "_" + name
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			set(out, key, value)
+		}
+	}
+	return out, nil
+}
+
+// remoteSource 远程配置中心
+type remoteSource struct {
+	provider  string
+	endpoint  string
+	keyOrPath string
+	options   []Option
+	interval  time.Duration
+}
+
+// RemoteSource 远程配置（consul、etcd），provider等参数同Provider，options为Type等其它选项
+// interval大于0时定时拉取，内容变化时触发重新加载；provider不支持或拉取失败时Load返回错误
+func RemoteSource(interval time.Duration, provider string, endpoint string, keyOrPath string, options ...Option) Source {
+	return &remoteSource{provider: provider, endpoint: endpoint, keyOrPath: keyOrPath, options: options, interval: interval}
+}
+
+func (s *remoteSource) Load(map[string]interface{}) (map[string]interface{}, error) {
+	v := viper.New()
+	if err := v.AddRemoteProvider(s.provider, s.endpoint, s.keyOrPath); err != nil {
+		return nil, err
+	}
+	for i := range s.options {
+		s.options[i](v)
+	}
+	if err := v.ReadRemoteConfig(); err != nil {
+		return nil, err
+	}
+	return v.AllSettings(), nil
+}
+
+func (s *remoteSource) Watch(ctx context.Context, changed func()) error {
+	if s.interval <= 0 {
+		return nil
+	}
+
+	last, _ := s.Load(nil)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			current, err := s.Load(nil)
+			if err != nil {
+				logger.Warn(log.Message("pull remote config error:", err))
+				continue
+			}
+			if !reflect.DeepEqual(current, last) {
+				last = current
+				changed()
+			}
+		}
+	}
+}
+
+// flagSource 命令行参数
+type flagSource struct {
+	fs *flag.FlagSet
+}
+
+// FlagSource 命令行参数，参数名即配置项（如-server.port=8080），只有显式设置的参数生效，需在fs.Parse之后加载
+func FlagSource(fs *flag.FlagSet) Source {
+	return &flagSource{fs: fs}
+}
+
+func (s *flagSource) Load(map[string]interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+	s.fs.Visit(func(f *flag.Flag) {
+		set(out, strings.ToLower(f.Name), f.Value.String())
+	})
+	return out, nil
+}
+
+// sectionSource 来源中的一节
+type sectionSource struct {
+	Source
+	key string
+}
+
+// Section 只取来源中key下的配置，用于按部署环境分节的配置文件
+func Section(key string, source Source) Source {
+	return &sectionSource{Source: source, key: strings.ToLower(key)}
+}
+
+func (s *sectionSource) Load(base map[string]interface{}) (map[string]interface{}, error) {
+	all, err := s.Source.Load(base)
+	if err != nil {
+		return nil, err
+	}
+	sub, _ := lookup(all, s.key).(map[string]interface{})
+	if sub == nil {
+		sub = make(map[string]interface{})
+	}
+	return sub, nil
+}
+
+func (s *sectionSource) Watch(ctx context.Context, changed func()) error {
+	if w, ok := s.Source.(Watcher); ok {
+		return w.Watch(ctx, changed)
+	}
+	return nil
+}
+
+// keys 所有叶子配置项
+func keys(m map[string]interface{}, prefix string) []string {
+	var out []string
+	for k, v := range m {
+		if sub, ok := v.(map[string]interface{}); ok {
+			out = append(out, keys(sub, prefix+k+".")...)
+			continue
+		}
+		out = append(out, prefix+k)
+	}
+	return out
+}
+
+// set 按点分隔的路径设置值
+func set(m map[string]interface{}, key string, value interface{}) {
+	path := strings.Split(key, ".")
+	for _, p := range path[:len(path)-1] {
+		sub, ok := m[p].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+			m[p] = sub
+		}
+		m = sub
+	}
+	m[path[len(path)-1]] = value
+}
+
+// lookup 按点分隔的路径取值
+func lookup(m map[string]interface{}, key string) interface{} {
+	var v interface{} = m
+	for _, p := range strings.Split(key, ".") {
+		sub, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = sub[p]
+	}
+	return v
+}
+
+// merge 将src深度合并到dst
+func merge(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if sub, ok := v.(map[string]interface{}); ok {
+			if d, ok := dst[k].(map[string]interface{}); ok {
+				merge(d, sub)
+				continue
+			}
+			copied := make(map[string]interface{})
+			merge(copied, sub)
+			dst[k] = copied
+			continue
+		}
+		dst[k] = v
+	}
+}
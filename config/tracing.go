@@ -0,0 +1,12 @@
+package config
+
+import "github.com/Jarnpher553/gemini/tracing"
+
+// NewTracer 按配置的tracing节构造Tracer，可通过service.Tracer设置到服务
+func NewTracer(c *Config) (*tracing.Tracer, error) {
+	var conf tracing.Config
+	if err := Bind(c, &conf); err != nil {
+		return nil, err
+	}
+	return tracing.FromConfig(conf)
+}
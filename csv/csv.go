@@ -38,27 +38,31 @@ func Marshal(in interface{}, withExplain bool, withBom bool) ([]byte, error) {
 }
 
 func getExplain(in reflect.Type, bIn []byte, withBom bool) ([]byte, error) {
-	num := in.NumField()
-	var out []byte
-	for i := 0; i < num; i++ {
-		name := in.Field(i).Tag.Get("name")
-		out = []byte(string(out) + name + ",")
-	}
-
 	var buffer bytes.Buffer
 
 	if withBom {
 		_ = bom(&buffer)
 	}
 
-	buffer.Write(out[:len(out)-1])
-	buffer.WriteByte('\r')
-	buffer.WriteByte('\n')
+	buffer.Write(explain(in))
 	buffer.Write(bIn)
 
 	return buffer.Bytes(), nil
 }
 
+// explain 由name标签组成的说明行
+func explain(in reflect.Type) []byte {
+	num := in.NumField()
+	var out []byte
+	for i := 0; i < num; i++ {
+		name := in.Field(i).Tag.Get("name")
+		out = []byte(string(out) + name + ",")
+	}
+
+	out = out[:len(out)-1]
+	return append(out, '\r', '\n')
+}
+
 func ClearExplain(reader io.Reader) ([]byte, error) {
 	b, err := ioutil.ReadAll(reader)
 	if err != nil {
@@ -0,0 +1,79 @@
+package csv
+
+import (
+	"errors"
+	"github.com/Jarnpher553/gemini/repo"
+	"github.com/gocarina/gocsv"
+	"io"
+	"reflect"
+)
+
+// Encode 逐行读取rows编码后写入w，内存占用与行数无关
+// row为行结构体或其指针，仅用于确定列，标签规则与Marshal一致
+func Encode(w io.Writer, rows repo.Rows, row interface{}, withExplain bool, withBom bool) error {
+	t := reflect.TypeOf(row)
+	if t == nil {
+		return errors.New("row type is required")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return errors.New("row must be a struct")
+	}
+
+	if withBom {
+		if _, err := w.Write([]byte{0xEF, 0xBB, 0xBF}); err != nil {
+			return err
+		}
+	}
+	if withExplain {
+		if _, err := w.Write(explain(t)); err != nil {
+			return err
+		}
+	}
+
+	first, err := scan(rows, t)
+	if err != nil {
+		return err
+	}
+	if first == nil {
+		// 没有数据时只写列名
+		return gocsv.Marshal(reflect.MakeSlice(reflect.SliceOf(t), 0, 0).Interface(), w)
+	}
+
+	ch := make(chan interface{})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gocsv.MarshalChan(ch, gocsv.DefaultCSVWriter(w))
+	}()
+
+	for v := first; v != nil; {
+		select {
+		case ch <- v:
+		case err := <-errCh:
+			return err
+		}
+
+		// 编码在另一协程进行，每行使用新的值
+		if v, err = scan(rows, t); err != nil {
+			close(ch)
+			<-errCh
+			return err
+		}
+	}
+	close(ch)
+	return <-errCh
+}
+
+// scan 读取下一行，没有更多行时返回nil
+func scan(rows repo.Rows, t reflect.Type) (interface{}, error) {
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	v := reflect.New(t).Interface()
+	if err := rows.Scan(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
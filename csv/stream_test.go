@@ -0,0 +1,36 @@
+package csv
+
+import (
+	"bytes"
+	"github.com/Jarnpher553/gemini/repo"
+	"testing"
+)
+
+type record struct {
+	ID   int    `csv:"id" name:"编号"`
+	Name string `csv:"name" name:"名称"`
+}
+
+func TestEncode(t *testing.T) {
+	data := []record{{1, "a"}, {2, "b,c"}}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, repo.SliceRows(data), record{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+	want, err := Marshal(data, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(want) {
+		t.Fatalf("want %q, got %q", want, buf.String())
+	}
+
+	buf.Reset()
+	if err := Encode(&buf, repo.SliceRows([]record{}), &record{}, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "id,name\n" {
+		t.Fatalf("unexpected empty output %q", buf.String())
+	}
+}
@@ -0,0 +1,163 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"github.com/Jarnpher553/gemini/redis"
+	REDIS "github.com/go-redis/redis/v7"
+	"path"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoSubscriber 非持久模式下发布时没有订阅者
+	ErrNoSubscriber = errors.New("event has no subscriber")
+	// ErrNotSupported 当前后端不支持的操作
+	ErrNotSupported = errors.New("operation is not supported by broker")
+)
+
+// message 后端投递的消息，处理成功后调用ack
+type message struct {
+	channel string
+	payload []byte
+	ack     func()
+}
+
+func noAck() {}
+
+// broker 发布订阅后端
+type broker interface {
+	publish(name string, payload []byte) error
+	subscribe(ctx context.Context, name string) (<-chan *message, error)
+	psubscribe(ctx context.Context, pattern string) (<-chan *message, error)
+	replay(name string, since time.Time) ([]*message, error)
+}
+
+// redisBroker 基于redis pub/sub的后端
+type redisBroker struct {
+	client *redis.RdClient
+}
+
+func (b *redisBroker) publish(name string, payload []byte) error {
+	n, err := b.client.Client.Publish(name, payload).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoSubscriber
+	}
+	return nil
+}
+
+func (b *redisBroker) subscribe(ctx context.Context, name string) (<-chan *message, error) {
+	return b.receive(ctx, b.client.Subscribe(name)), nil
+}
+
+func (b *redisBroker) psubscribe(ctx context.Context, pattern string) (<-chan *message, error) {
+	return b.receive(ctx, b.client.PSubscribe(pattern)), nil
+}
+
+func (b *redisBroker) receive(ctx context.Context, ps *REDIS.PubSub) <-chan *message {
+	ch := make(chan *message, 100)
+	go func() {
+		<-ctx.Done()
+		_ = ps.Close()
+	}()
+	go func() {
+		defer close(ch)
+		for msg := range ps.Channel() {
+			ch <- &message{channel: msg.Channel, payload: []byte(msg.Payload), ack: noAck}
+		}
+	}()
+	return ch
+}
+
+func (b *redisBroker) replay(name string, since time.Time) ([]*message, error) {
+	return nil, ErrNotSupported
+}
+
+// memoryBroker 进程内后端，用于测试，保留全部历史以支持回放
+type memoryBroker struct {
+	m       sync.RWMutex
+	subs    []*memorySub
+	history map[string][]*memoryRecord
+}
+
+type memorySub struct {
+	pattern string
+	glob    bool
+	ch      chan *message
+	ctx     context.Context
+}
+
+type memoryRecord struct {
+	at      time.Time
+	payload []byte
+}
+
+func newMemoryBroker() *memoryBroker {
+	return &memoryBroker{history: make(map[string][]*memoryRecord)}
+}
+
+func (s *memorySub) match(name string) bool {
+	if s.glob {
+		ok, _ := path.Match(s.pattern, name)
+		return ok
+	}
+	return s.pattern == name
+}
+
+func (b *memoryBroker) publish(name string, payload []byte) error {
+	b.m.Lock()
+	b.history[name] = append(b.history[name], &memoryRecord{at: time.Now(), payload: payload})
+	subs := make([]*memorySub, 0)
+	for _, s := range b.subs {
+		if s.ctx.Err() == nil && s.match(name) {
+			subs = append(subs, s)
+		}
+	}
+	b.m.Unlock()
+
+	if len(subs) == 0 {
+		return ErrNoSubscriber
+	}
+	for _, s := range subs {
+		select {
+		case s.ch <- &message{channel: name, payload: payload, ack: noAck}:
+		case <-s.ctx.Done():
+		}
+	}
+	return nil
+}
+
+func (b *memoryBroker) subscribe(ctx context.Context, name string) (<-chan *message, error) {
+	return b.add(ctx, &memorySub{pattern: name}), nil
+}
+
+func (b *memoryBroker) psubscribe(ctx context.Context, pattern string) (<-chan *message, error) {
+	return b.add(ctx, &memorySub{pattern: pattern, glob: true}), nil
+}
+
+func (b *memoryBroker) add(ctx context.Context, s *memorySub) <-chan *message {
+	s.ch = make(chan *message, 100)
+	s.ctx = ctx
+
+	b.m.Lock()
+	b.subs = append(b.subs, s)
+	b.m.Unlock()
+	return s.ch
+}
+
+func (b *memoryBroker) replay(name string, since time.Time) ([]*message, error) {
+	b.m.RLock()
+	defer b.m.RUnlock()
+
+	messages := make([]*message, 0)
+	for _, r := range b.history[name] {
+		if !r.at.Before(since) {
+			messages = append(messages, &message{channel: name, payload: r.payload, ack: noAck})
+		}
+	}
+	return messages, nil
+}
@@ -0,0 +1,40 @@
+package event
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryBroker(t *testing.T) {
+	b := newMemoryBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := b.publish("event/demo", []byte("lost")); err != ErrNoSubscriber {
+		t.Fatal("publish without subscriber should fail")
+	}
+
+	ch1, _ := b.subscribe(ctx, "event/demo")
+	ch2, _ := b.psubscribe(ctx, "event/*")
+
+	if err := b.publish("event/demo", []byte("do")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ch := range []<-chan *message{ch1, ch2} {
+		select {
+		case msg := <-ch:
+			if string(msg.payload) != "do" || msg.channel != "event/demo" {
+				t.Fatalf("want do on event/demo, got %s on %s", msg.payload, msg.channel)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("subscribe timeout")
+		}
+	}
+
+	messages, _ := b.replay("event/demo", time.Time{})
+	if len(messages) != 2 {
+		t.Fatalf("want 2 messages to replay, got %d", len(messages))
+	}
+}
@@ -1,28 +1,57 @@
 package event
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/Jarnpher553/gemini/log"
 	"github.com/Jarnpher553/gemini/redis"
 	"github.com/Jarnpher553/gemini/shortuuid/snow"
+	"github.com/opentracing/opentracing-go/ext"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Bus struct {
 	*redis.RdClient
-	ch   chan Event
-	name string
+	broker   broker
+	durable  *streamBroker
+	ch       chan Event
+	events   int32
+	m        sync.RWMutex
+	subs     map[string]bool
+	handlers map[string][]Handler
+	// listeners Listen注册的监听者
+	listeners map[*listener]struct{}
+	onError   func(*Event, error)
+	ctx       context.Context
+	cancel    context.CancelFunc
 }
 
+type Option func(*Bus)
+
 type Event struct {
 	ID        string
 	Timestamp int64
 	Action    string
 	Content   interface{}
+	// Trace 发布方的跟踪上下文
+	Trace map[string]string `json:",omitempty"`
+	// Channel 事件所在频道，订阅时设置
+	Channel string `json:"-"`
+	raw     json.RawMessage
 }
 
-var bus = &Bus{}
+// Any 匹配所有动作的处理函数
+const Any = "*"
+
+// bus 处理函数与监听者在Bind前后均可注册，重新Bind时保留
+var bus = &Bus{subs: make(map[string]bool), handlers: make(map[string][]Handler), listeners: make(map[*listener]struct{})}
+
+var logger = log.Zap.Mark("event")
 
 func NewEvent(action string, content interface{}) *Event {
 	return &Event{
@@ -33,36 +62,303 @@ func NewEvent(action string, content interface{}) *Event {
 	}
 }
 
-func Bind(client *redis.RdClient) {
+// UnmarshalJSON 保留原始内容以便Bind解码为具体类型
+func (ev *Event) UnmarshalJSON(b []byte) error {
+	type alias Event
+	aux := &struct {
+		*alias
+		Content json.RawMessage
+	}{alias: (*alias)(ev)}
+	if err := json.Unmarshal(b, aux); err != nil {
+		return err
+	}
+
+	ev.raw = aux.Content
+	ev.Content = nil
+	if len(aux.Content) > 0 {
+		return json.Unmarshal(aux.Content, &ev.Content)
+	}
+	return nil
+}
+
+// Bind 将事件内容解码到v
+func (ev *Event) Bind(v interface{}) error {
+	if ev.raw == nil {
+		b, err := json.Marshal(ev.Content)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(b, v)
+	}
+	return json.Unmarshal(ev.raw, v)
+}
+
+// Memory 使用进程内发布订阅代替redis，用于测试
+func Memory() Option {
+	return func(bus *Bus) {
+		bus.broker = newMemoryBroker()
+	}
+}
+
+// Durable 使用redis stream持久化事件，同组内每个事件只被一个实例处理，不支持模式订阅
+// group 消费组，通常为服务名 consumer 组内唯一的实例名
+func Durable(group string, consumer string) Option {
+	return func(bus *Bus) {
+		bus.durable = &streamBroker{group: group, consumer: consumer, maxLen: 100000, maxRetry: 3, idle: time.Minute, logger: logger}
+	}
+}
+
+// MaxLen 持久模式下每个stream保留的大致事件数，默认100000，需在Durable之后
+func MaxLen(maxLen int64) Option {
+	return func(bus *Bus) {
+		if bus.durable != nil {
+			bus.durable.maxLen = maxLen
+		}
+	}
+}
+
+// Retry 持久模式下未确认的事件空闲idle后重新投递，最多重试maxRetry次，默认3次、1分钟，需在Durable之后
+func Retry(maxRetry int64, idle time.Duration) Option {
+	return func(bus *Bus) {
+		if bus.durable != nil {
+			bus.durable.maxRetry = maxRetry
+			bus.durable.idle = idle
+		}
+	}
+}
+
+// OnError 处理失败时回调，默认记录日志
+func OnError(f func(ev *Event, err error)) Option {
+	return func(bus *Bus) {
+		bus.onError = f
+	}
+}
+
+func Bind(client *redis.RdClient, options ...Option) {
+	if bus.cancel != nil {
+		bus.cancel()
+	}
+
 	bus.RdClient = client
 	bus.ch = make(chan Event, 100)
+	bus.broker = nil
+	bus.durable = nil
+	// 上一次绑定的消费协程可能仍在分发
+	bus.m.Lock()
+	bus.subs = make(map[string]bool)
+	bus.onError = nil
+	bus.m.Unlock()
+	atomic.StoreInt32(&bus.events, 0)
+	bus.ctx, bus.cancel = context.WithCancel(context.Background())
+
+	for _, op := range options {
+		op(bus)
+	}
+
+	if bus.broker == nil {
+		if bus.durable != nil {
+			bus.durable.client = client
+			bus.broker = bus.durable
+		} else {
+			bus.broker = &redisBroker{client: client}
+		}
+	}
+}
+
+// On 注册动作的处理函数，action为Any时处理所有动作
+// handler 为 func(context.Context, *Event) error 或 func(context.Context, T) error
+func On(action string, handler interface{}) error {
+	h, err := adapt(handler)
+	if err != nil {
+		return err
+	}
+
+	bus.m.Lock()
+	bus.handlers[action] = append(bus.handlers[action], h)
+	bus.m.Unlock()
+	return nil
 }
 
-func Subscribe(name string) error {
-	if bus.name != "" {
-		return errors.New("event bus has existed")
+// Subscribe 订阅频道，可多次调用订阅多个频道
+func Subscribe(names ...string) error {
+	return subscribe(false, names)
+}
+
+// PSubscribe 按模式订阅频道，持久模式不支持
+func PSubscribe(patterns ...string) error {
+	return subscribe(true, patterns)
+}
+
+func subscribe(pattern bool, names []string) error {
+	bus.m.Lock()
+	defer bus.m.Unlock()
+
+	if bus.broker == nil {
+		return errors.New("event bus is not bound")
 	}
-	bus.name = name
-	ps := bus.RdClient.Subscribe(name)
-	go func() {
-		for message := range ps.Channel() {
-			var ev Event
-			_ = json.Unmarshal([]byte(message.Payload), &ev)
-			bus.ch <- ev
+
+	for _, name := range names {
+		if bus.subs[name] {
+			return fmt.Errorf("channel %s has subscribed", name)
+		}
+
+		var ch <-chan *message
+		var err error
+		if pattern {
+			ch, err = bus.broker.psubscribe(bus.ctx, name)
+		} else {
+			ch, err = bus.broker.subscribe(bus.ctx, name)
 		}
-	}()
+		if err != nil {
+			return err
+		}
+
+		bus.subs[name] = true
+		go consume(bus.ctx, ch)
+	}
 	return nil
 }
 
+func consume(ctx context.Context, ch <-chan *message) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			dispatch(msg)
+		}
+	}
+}
+
+// dispatch 解码并分发事件，全部处理成功后确认
+func dispatch(msg *message) {
+	var ev Event
+	if err := json.Unmarshal(msg.payload, &ev); err != nil {
+		report(&Event{Channel: msg.channel}, fmt.Errorf("decode event error: %w", err))
+		msg.ack()
+		return
+	}
+	ev.Channel = msg.channel
+
+	bus.m.RLock()
+	handlers := append(append([]Handler{}, bus.handlers[ev.Action]...), bus.handlers[Any]...)
+	onError := bus.onError
+	bus.m.RUnlock()
+
+	ctx, span := startSpan(&ev)
+	var failed bool
+	for _, h := range handlers {
+		if err := call(h, ctx, &ev); err != nil {
+			failed = true
+			ext.Error.Set(span, true)
+			span.LogKV("error", err.Error())
+			if onError != nil {
+				onError(&ev, err)
+			} else {
+				report(&ev, err)
+			}
+		}
+	}
+	span.Finish()
+
+	if !failed {
+		msg.ack()
+	}
+
+	notify(&ev)
+
+	if atomic.LoadInt32(&bus.events) == 1 {
+		bus.ch <- ev
+	}
+}
+
+func report(ev *Event, err error) {
+	logger.Error(log.Message("handle event error:", err), zap.String("channel", ev.Channel), zap.String("id", ev.ID), zap.String("action", ev.Action))
+}
+
+// listener 事件监听者
+type listener struct {
+	actions map[string]bool
+	ch      chan *Event
+}
+
+// Listen 监听订阅到的事件，不影响处理函数与确认，actions为空时监听所有动作
+// 监听者读取过慢时丢弃事件，不再需要时调用返回的cancel
+func Listen(buffer int, actions ...string) (<-chan *Event, func()) {
+	l := &listener{actions: make(map[string]bool), ch: make(chan *Event, buffer)}
+	for _, action := range actions {
+		l.actions[action] = true
+	}
+
+	bus.m.Lock()
+	bus.listeners[l] = struct{}{}
+	bus.m.Unlock()
+
+	var once sync.Once
+	return l.ch, func() {
+		once.Do(func() {
+			bus.m.Lock()
+			delete(bus.listeners, l)
+			bus.m.Unlock()
+		})
+	}
+}
+
+func notify(ev *Event) {
+	bus.m.RLock()
+	defer bus.m.RUnlock()
+	for l := range bus.listeners {
+		if len(l.actions) > 0 && !l.actions[ev.Action] {
+			continue
+		}
+		select {
+		case l.ch <- ev:
+		default:
+			logger.Warn(log.Message("listener is full, drop event"), zap.String("id", ev.ID), zap.String("action", ev.Action))
+		}
+	}
+}
+
+// Events 返回订阅到的事件，调用后才开始向通道投递，需持续读取
 func Events() <-chan Event {
+	atomic.StoreInt32(&bus.events, 1)
 	return bus.ch
 }
 
 func Publish(name string, ev *Event) error {
-	marshal, _ := json.Marshal(ev)
-	ret := bus.RdClient.Publish(name, marshal)
-	if !ret {
-		return errors.New("publish error")
+	return PublishContext(context.Background(), name, ev)
+}
+
+// PublishContext 发布事件并携带上下文中的跟踪信息
+func PublishContext(ctx context.Context, name string, ev *Event) error {
+	inject(ctx, ev)
+	marshal, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return bus.broker.publish(name, marshal)
+}
+
+// Replay 将频道中since之后的事件重新交给处理函数，仅持久模式与Memory支持
+func Replay(name string, since time.Time) error {
+	messages, err := bus.broker.replay(name, since)
+	if err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		dispatch(msg)
+	}
+	return nil
+}
+
+// Stop 停止所有订阅
+func Stop() error {
+	if bus.cancel == nil {
+		return errors.New("event bus is not bound")
 	}
+	bus.cancel()
 	return nil
 }
@@ -0,0 +1,104 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"reflect"
+	"runtime/debug"
+)
+
+// Handler 事件处理函数
+type Handler func(ctx context.Context, ev *Event) error
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	eventType   = reflect.TypeOf(&Event{})
+)
+
+// adapt 将处理函数转换为Handler
+// 支持 func(context.Context, *Event) error 与 func(context.Context, T) error，后者将事件内容解码为T
+func adapt(handler interface{}) (Handler, error) {
+	switch h := handler.(type) {
+	case Handler:
+		return h, nil
+	case func(context.Context, *Event) error:
+		return h, nil
+	}
+
+	fn := reflect.ValueOf(handler)
+	t := fn.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 1 || t.In(0) != contextType || t.Out(0) != errorType {
+		return nil, fmt.Errorf("handler must be func(context.Context, T) error, got %s", t)
+	}
+
+	in := t.In(1)
+	if in == eventType {
+		return func(ctx context.Context, ev *Event) error {
+			return callErr(fn.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(ev)}))
+		}, nil
+	}
+
+	return func(ctx context.Context, ev *Event) error {
+		var v reflect.Value
+		if in.Kind() == reflect.Ptr {
+			v = reflect.New(in.Elem())
+			if err := ev.Bind(v.Interface()); err != nil {
+				return err
+			}
+		} else {
+			v = reflect.New(in)
+			if err := ev.Bind(v.Interface()); err != nil {
+				return err
+			}
+			v = v.Elem()
+		}
+		return callErr(fn.Call([]reflect.Value{reflect.ValueOf(ctx), v}))
+	}, nil
+}
+
+func callErr(out []reflect.Value) error {
+	if err, ok := out[0].Interface().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// inject 将上下文中的span写入事件
+func inject(ctx context.Context, ev *Event) {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	carrier := opentracing.TextMapCarrier{}
+	if err := opentracing.GlobalTracer().Inject(span.Context(), opentracing.TextMap, carrier); err == nil {
+		ev.Trace = carrier
+	}
+}
+
+// startSpan 以事件中的span为起点创建处理span
+func startSpan(ev *Event) (context.Context, opentracing.Span) {
+	options := []opentracing.StartSpanOption{ext.SpanKindConsumer, opentracing.Tag{Key: "event.id", Value: ev.ID}, opentracing.Tag{Key: "event.channel", Value: ev.Channel}}
+	if len(ev.Trace) > 0 {
+		if sc, err := opentracing.GlobalTracer().Extract(opentracing.TextMap, opentracing.TextMapCarrier(ev.Trace)); err == nil {
+			options = append(options, opentracing.FollowsFrom(sc))
+		}
+	}
+
+	span := opentracing.StartSpan("event "+ev.Action, options...)
+	return opentracing.ContextWithSpan(context.Background(), span), span
+}
+
+// call 执行处理函数并恢复panic
+func call(h Handler, ctx context.Context, ev *Event) (e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			e = fmt.Errorf("%v", err)
+			logger.Error(log.Messagef("err info: %s, track: %s", e, string(debug.Stack())))
+		}
+	}()
+	return h(ctx, ev)
+}
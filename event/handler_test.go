@@ -0,0 +1,123 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type order struct {
+	No     string `json:"no"`
+	Amount int    `json:"amount"`
+}
+
+func TestOn(t *testing.T) {
+	errs := make(chan error, 10)
+	Bind(nil, Memory(), OnError(func(ev *Event, err error) {
+		errs <- err
+	}))
+	defer Stop()
+
+	if err := On("paid", func(order) {}); err == nil {
+		t.Fatal("invalid handler should return error")
+	}
+
+	orders := make(chan *order, 10)
+	_ = On("paid", func(ctx context.Context, o *order) error {
+		orders <- o
+		return nil
+	})
+	_ = On("refund", func(ctx context.Context, ev *Event) error {
+		return errors.New("refund failed")
+	})
+
+	if err := Subscribe("order/created", "order/paid"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Subscribe("order/paid"); err == nil {
+		t.Fatal("duplicate subscribe should return error")
+	}
+
+	_ = Publish("order/paid", NewEvent("paid", &order{No: "no_1", Amount: 100}))
+	select {
+	case o := <-orders:
+		if o.No != "no_1" || o.Amount != 100 {
+			t.Fatalf("unexpected order %+v", o)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handle timeout")
+	}
+
+	_ = Publish("order/created", NewEvent("refund", nil))
+	select {
+	case err := <-errs:
+		if err.Error() != "refund failed" {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("error should be reported")
+	}
+
+	if err := Replay("order/paid", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if o := <-orders; o.No != "no_1" {
+		t.Fatalf("unexpected replay order %+v", o)
+	}
+}
+
+func TestPSubscribe(t *testing.T) {
+	Bind(nil, Memory())
+	defer Stop()
+
+	_ = PSubscribe("device/*")
+	ch := Events()
+
+	_ = Publish("device/1", NewEvent("online", map[string]int{"rssi": -40}))
+
+	select {
+	case ev := <-ch:
+		var v map[string]int
+		if err := ev.Bind(&v); err != nil || v["rssi"] != -40 || ev.Channel != "device/1" {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscribe timeout")
+	}
+}
+
+func TestOn_BeforeBind(t *testing.T) {
+	done := make(chan string, 1)
+	if err := On("shipped", func(ctx context.Context, o *order) error {
+		done <- o.No
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ch, cancel := Listen(1, "shipped")
+	defer cancel()
+
+	Bind(nil, Memory())
+	defer Stop()
+
+	_ = Subscribe("order/shipped")
+	_ = Publish("order/shipped", NewEvent("shipped", &order{No: "no_2"}))
+
+	select {
+	case no := <-done:
+		if no != "no_2" {
+			t.Fatalf("unexpected order %s", no)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler registered before bind should be kept")
+	}
+	select {
+	case ev := <-ch:
+		if ev.Action != "shipped" {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("listener registered before bind should be kept")
+	}
+}
@@ -0,0 +1,179 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/redis"
+	REDIS "github.com/go-redis/redis/v7"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// streamBroker 基于redis stream与消费组的持久化后端
+// 处理失败或实例宕机未确认的消息，空闲超过idle后被重新认领投递，超过maxRetry次后丢弃
+type streamBroker struct {
+	client   *redis.RdClient
+	group    string
+	consumer string
+	maxLen   int64
+	maxRetry int64
+	idle     time.Duration
+	logger   *log.ZapLogger
+}
+
+func (b *streamBroker) publish(name string, payload []byte) error {
+	return b.client.XAdd(&REDIS.XAddArgs{
+		Stream:       name,
+		MaxLenApprox: b.maxLen,
+		Values:       map[string]interface{}{"payload": payload},
+	}).Err()
+}
+
+func (b *streamBroker) subscribe(ctx context.Context, name string) (<-chan *message, error) {
+	err := b.client.XGroupCreateMkStream(name, b.group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, err
+	}
+
+	ch := make(chan *message, 100)
+	go b.read(ctx, name, ch)
+	go b.reclaim(ctx, name, ch)
+	return ch, nil
+}
+
+func (b *streamBroker) psubscribe(ctx context.Context, pattern string) (<-chan *message, error) {
+	return nil, ErrNotSupported
+}
+
+// read 先投递本消费者上次未确认的消息，再阻塞读取新消息
+func (b *streamBroker) read(ctx context.Context, name string, ch chan<- *message) {
+	id := "0"
+	for ctx.Err() == nil {
+		streams, err := b.client.XReadGroup(&REDIS.XReadGroupArgs{
+			Group:    b.group,
+			Consumer: b.consumer,
+			Streams:  []string{name, id},
+			Count:    100,
+			Block:    5 * time.Second,
+		}).Result()
+		if err == REDIS.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				b.logger.Error(log.Message("read stream", name, "error:", err))
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		last := ""
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				last = msg.ID
+				if !b.deliver(ctx, name, msg, ch) {
+					return
+				}
+			}
+		}
+		// 未确认消息读完后开始读取新消息
+		if id != ">" {
+			if last == "" {
+				id = ">"
+			} else {
+				id = last
+			}
+		}
+	}
+}
+
+// reclaim 认领空闲超时的消息重新投递
+func (b *streamBroker) reclaim(ctx context.Context, name string, ch chan<- *message) {
+	ticker := time.NewTicker(b.idle)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pending, err := b.client.XPendingExt(&REDIS.XPendingExtArgs{
+			Stream: name,
+			Group:  b.group,
+			Start:  "-",
+			End:    "+",
+			Count:  100,
+		}).Result()
+		if err != nil {
+			b.logger.Error(log.Message("pending stream", name, "error:", err))
+			continue
+		}
+
+		ids := make([]string, 0, len(pending))
+		for _, p := range pending {
+			if p.Idle < b.idle {
+				continue
+			}
+			if p.RetryCount > b.maxRetry {
+				b.logger.Error("drop event after retries", zap.String("stream", name), zap.String("id", p.ID), zap.Int64("retry", p.RetryCount))
+				b.client.XAck(name, b.group, p.ID)
+				continue
+			}
+			ids = append(ids, p.ID)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		messages, err := b.client.XClaim(&REDIS.XClaimArgs{
+			Stream:   name,
+			Group:    b.group,
+			Consumer: b.consumer,
+			MinIdle:  b.idle,
+			Messages: ids,
+		}).Result()
+		if err != nil {
+			b.logger.Error(log.Message("claim stream", name, "error:", err))
+			continue
+		}
+		for _, msg := range messages {
+			b.logger.Warn(log.Messagef("redeliver event %s of stream %s", msg.ID, name))
+			if !b.deliver(ctx, name, msg, ch) {
+				return
+			}
+		}
+	}
+}
+
+func (b *streamBroker) deliver(ctx context.Context, name string, msg REDIS.XMessage, ch chan<- *message) bool {
+	payload, _ := msg.Values["payload"].(string)
+	id := msg.ID
+	m := &message{channel: name, payload: []byte(payload), ack: func() {
+		b.client.XAck(name, b.group, id)
+	}}
+	select {
+	case ch <- m:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (b *streamBroker) replay(name string, since time.Time) ([]*message, error) {
+	start := fmt.Sprintf("%d", since.UnixNano()/1e6)
+	values, err := b.client.XRange(name, start, "+").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*message, 0, len(values))
+	for _, v := range values {
+		payload, _ := v.Values["payload"].(string)
+		messages = append(messages, &message{channel: name, payload: []byte(payload), ack: noAck})
+	}
+	return messages, nil
+}
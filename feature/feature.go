@@ -0,0 +1,291 @@
+package feature
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Jarnpher553/gemini/config"
+	"github.com/Jarnpher553/gemini/event"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/redis"
+	"github.com/opentracing/opentracing-go"
+	"github.com/rcrowley/go-metrics"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	actionSet    = "feature:set"
+	actionDelete = "feature:delete"
+)
+
+var logger = log.Zap.Mark("feature")
+
+// Flag 功能开关
+// Enabled为false时对所有请求关闭；没有任何定向规则时对所有请求开启；否则命中任一规则时开启
+type Flag struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// Users 定向的用户
+	Users []string `json:"users,omitempty"`
+	// Tenants 定向的租户
+	Tenants []string `json:"tenants,omitempty"`
+	// Percent 按用户（没有用户时按租户）哈希灰度的百分比，0-100
+	Percent int `json:"percent,omitempty"`
+	// Headers 请求头定向，值为*时只要求请求头存在
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Target 评估开关的对象
+type Target struct {
+	User   string
+	Tenant string
+	Header http.Header
+}
+
+// Evaluate 对目标评估开关
+func (f *Flag) Evaluate(t *Target) bool {
+	if !f.Enabled {
+		return false
+	}
+	if len(f.Users) == 0 && len(f.Tenants) == 0 && f.Percent <= 0 && len(f.Headers) == 0 {
+		return true
+	}
+	if t == nil {
+		t = &Target{}
+	}
+
+	if t.User != "" && contains(f.Users, t.User) {
+		return true
+	}
+	if t.Tenant != "" && contains(f.Tenants, t.Tenant) {
+		return true
+	}
+	for name, value := range f.Headers {
+		if got := t.Header.Get(name); got != "" && (value == "*" || got == value) {
+			return true
+		}
+	}
+
+	if f.Percent >= 100 {
+		return true
+	}
+	key := t.User
+	if key == "" {
+		key = t.Tenant
+	}
+	if f.Percent > 0 && key != "" {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(f.Name + ":" + key))
+		return int(h.Sum32()%100) < f.Percent
+	}
+	return false
+}
+
+func contains(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Features 功能开关集合
+type Features struct {
+	m        sync.RWMutex
+	flags    map[string]*Flag
+	client   *redis.RdClient
+	key      string
+	channel  string
+	registry metrics.Registry
+}
+
+var features = &Features{flags: make(map[string]*Flag), registry: metrics.DefaultRegistry}
+
+type Option func(*Features)
+
+// Redis 开关持久化到redis哈希key，Bind时加载其中所有开关
+func Redis(client *redis.RdClient, key string) Option {
+	return func(f *Features) {
+		f.client = client
+		f.key = key
+	}
+}
+
+// Channel 通过event总线同步开关修改的频道，需先调用event.Bind
+func Channel(channel string) Option {
+	return func(f *Features) {
+		f.channel = channel
+	}
+}
+
+// Registry 记录评估次数的指标注册表，默认metrics.DefaultRegistry
+func Registry(registry metrics.Registry) Option {
+	return func(f *Features) {
+		f.registry = registry
+	}
+}
+
+// Bind 初始化，设置Redis时加载其中的开关，设置Channel时订阅其它实例的修改
+func Bind(options ...Option) error {
+	features.m.Lock()
+	features.flags = make(map[string]*Flag)
+	features.client, features.key, features.channel = nil, "", ""
+	features.registry = metrics.DefaultRegistry
+	for _, op := range options {
+		op(features)
+	}
+	features.m.Unlock()
+
+	if features.client != nil {
+		values, err := features.client.Client.HGetAll(features.key).Result()
+		if err != nil {
+			return err
+		}
+		for name, value := range values {
+			flag := &Flag{}
+			if err := json.Unmarshal([]byte(value), flag); err != nil {
+				logger.Warn(log.Message("decode flag error:", name, err))
+				continue
+			}
+			put(flag)
+		}
+	}
+
+	if features.channel != "" {
+		if err := event.On(actionSet, func(_ context.Context, flag *Flag) error {
+			put(flag)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := event.On(actionDelete, func(_ context.Context, name string) error {
+			remove(name)
+			return nil
+		}); err != nil {
+			return err
+		}
+		return event.Subscribe(features.channel)
+	}
+	return nil
+}
+
+// Load 加载开关，同名的开关被覆盖，只影响本实例
+func Load(flags ...*Flag) {
+	for _, flag := range flags {
+		put(flag)
+	}
+}
+
+// LoadConfig 从配置节加载开关，节下每个键为开关名，可在config.Loader的OnChange中调用以随配置更新
+func LoadConfig(c *config.Config) error {
+	if c == nil {
+		return nil
+	}
+	for name := range c.AllSettings() {
+		flag := &Flag{}
+		if err := c.Sub(name).Unmarshal(flag); err != nil {
+			return err
+		}
+		flag.Name = name
+		put(flag)
+	}
+	return nil
+}
+
+// Set 新增或修改开关，设置Redis时持久化，设置Channel时同步到所有实例
+func Set(flag *Flag) error {
+	put(flag)
+
+	features.m.RLock()
+	client, key, channel := features.client, features.key, features.channel
+	features.m.RUnlock()
+
+	if client != nil {
+		b, err := json.Marshal(flag)
+		if err != nil {
+			return err
+		}
+		if err := client.Client.HSet(key, flag.Name, b).Err(); err != nil {
+			return err
+		}
+	}
+	if channel != "" {
+		return event.Publish(channel, event.NewEvent(actionSet, flag))
+	}
+	return nil
+}
+
+// Delete 删除开关，同步方式与Set一致
+func Delete(name string) error {
+	remove(name)
+
+	features.m.RLock()
+	client, key, channel := features.client, features.key, features.channel
+	features.m.RUnlock()
+
+	if client != nil {
+		if err := client.Client.HDel(key, name).Err(); err != nil {
+			return err
+		}
+	}
+	if channel != "" {
+		return event.Publish(channel, event.NewEvent(actionDelete, name))
+	}
+	return nil
+}
+
+// Get 获取开关
+func Get(name string) (*Flag, bool) {
+	features.m.RLock()
+	defer features.m.RUnlock()
+	flag, ok := features.flags[strings.ToLower(name)]
+	return flag, ok
+}
+
+// All 所有开关
+func All() []*Flag {
+	features.m.RLock()
+	defer features.m.RUnlock()
+	flags := make([]*Flag, 0, len(features.flags))
+	for _, flag := range features.flags {
+		flags = append(flags, flag)
+	}
+	return flags
+}
+
+// Enabled 对目标评估开关，开关不存在时为false，结果记录到ctx中的span与指标feature.<name>.on/off
+func Enabled(ctx context.Context, name string, target *Target) bool {
+	flag, ok := Get(name)
+	enabled := ok && flag.Evaluate(target)
+
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		span.SetTag("feature."+name, enabled)
+	}
+
+	features.m.RLock()
+	registry := features.registry
+	features.m.RUnlock()
+	if enabled {
+		metrics.GetOrRegisterCounter("feature."+name+".on", registry).Inc(1)
+	} else {
+		metrics.GetOrRegisterCounter("feature."+name+".off", registry).Inc(1)
+	}
+	return enabled
+}
+
+// put 开关名不区分大小写，与配置的键保持一致
+func put(flag *Flag) {
+	flag.Name = strings.ToLower(flag.Name)
+	features.m.Lock()
+	features.flags[flag.Name] = flag
+	features.m.Unlock()
+}
+
+func remove(name string) {
+	features.m.Lock()
+	delete(features.flags, strings.ToLower(name))
+	features.m.Unlock()
+}
@@ -0,0 +1,114 @@
+package feature
+
+import (
+	"context"
+	"github.com/Jarnpher553/gemini/event"
+	"github.com/Jarnpher553/viper"
+	"github.com/rcrowley/go-metrics"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFlag_Evaluate(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Beta", "1")
+
+	tests := []struct {
+		name   string
+		flag   Flag
+		target *Target
+		want   bool
+	}{
+		{"disabled", Flag{Users: []string{"1"}}, &Target{User: "1"}, false},
+		{"all", Flag{Enabled: true}, nil, true},
+		{"user", Flag{Enabled: true, Users: []string{"1"}}, &Target{User: "1"}, true},
+		{"other user", Flag{Enabled: true, Users: []string{"1"}}, &Target{User: "2"}, false},
+		{"tenant", Flag{Enabled: true, Tenants: []string{"t1"}}, &Target{Tenant: "t1"}, true},
+		{"header", Flag{Enabled: true, Headers: map[string]string{"x-beta": "1"}}, &Target{Header: header}, true},
+		{"header present", Flag{Enabled: true, Headers: map[string]string{"X-Beta": "*"}}, &Target{Header: header}, true},
+		{"header mismatch", Flag{Enabled: true, Headers: map[string]string{"X-Beta": "2"}}, &Target{Header: header}, false},
+		{"full rollout", Flag{Enabled: true, Percent: 100}, nil, true},
+		{"rollout without key", Flag{Enabled: true, Percent: 50}, &Target{}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.flag.Evaluate(tt.target); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFlag_Percent(t *testing.T) {
+	flag := &Flag{Name: "checkout", Enabled: true, Percent: 30}
+	on := 0
+	for i := 0; i < 10000; i++ {
+		target := &Target{User: strconv.Itoa(i)}
+		enabled := flag.Evaluate(target)
+		if enabled != flag.Evaluate(target) {
+			t.Fatal("evaluation should be sticky")
+		}
+		if enabled {
+			on++
+		}
+	}
+	if on < 2500 || on > 3500 {
+		t.Fatalf("rollout out of range: %d", on)
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	registry := metrics.NewRegistry()
+	if err := Bind(Registry(registry)); err != nil {
+		t.Fatal(err)
+	}
+
+	v := viper.New()
+	_ = v.MergeConfigMap(map[string]interface{}{
+		"new-checkout": map[string]interface{}{"enabled": true, "users": []string{"7"}},
+	})
+	if err := LoadConfig(v); err != nil {
+		t.Fatal(err)
+	}
+
+	if !Enabled(context.Background(), "New-Checkout", &Target{User: "7"}) {
+		t.Fatal("flag should be enabled for user 7")
+	}
+	if Enabled(context.Background(), "new-checkout", &Target{User: "8"}) || Enabled(context.Background(), "missing", nil) {
+		t.Fatal("flag should be disabled")
+	}
+	if n := metrics.GetOrRegisterCounter("feature.new-checkout.off", registry).Count(); n != 1 {
+		t.Fatalf("unexpected off count %d", n)
+	}
+}
+
+func TestBind_Channel(t *testing.T) {
+	event.Bind(nil, event.Memory())
+	defer event.Stop()
+	if err := Bind(Channel("feature")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟其它实例的修改
+	_ = event.Publish("feature", event.NewEvent(actionSet, &Flag{Name: "dark-mode", Enabled: true}))
+	waitFor(t, func() bool {
+		_, ok := Get("dark-mode")
+		return ok
+	})
+
+	_ = event.Publish("feature", event.NewEvent(actionDelete, "dark-mode"))
+	waitFor(t, func() bool {
+		_, ok := Get("dark-mode")
+		return !ok
+	})
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,13 +1,18 @@
 package httpclient
 
 import (
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/tracing"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/openzipkin/zipkin-go/model"
+	"go.uber.org/zap"
 	"net/http"
 	"time"
 )
 
+var logger = log.Zap.Mark("httpclient")
+
 // Transport http客户端自定义传输类
 type Transport struct {
 	http.RoundTripper
@@ -26,30 +31,29 @@ func (tran *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
 	defer span.Finish()
 
 	_ = opentracing.GlobalTracer().Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
+	if state := tracing.TraceState(ctx); state != "" && r.Header.Get("traceparent") != "" {
+		r.Header.Set("tracestate", state)
+	}
 
-	return tran.RoundTripper.RoundTrip(r)
+	begin := time.Now()
+	resp, err := tran.RoundTripper.RoundTrip(r)
+
+	l := logger.Ctx(ctx).With(
+		zap.String("method", r.Method),
+		zap.String("url", r.URL.String()),
+		zap.String("cost", time.Since(begin).String()),
+	)
+	if err != nil {
+		l.Error(log.Message("request error:", err))
+	} else {
+		l.Debug("request", zap.Int("status", resp.StatusCode))
+	}
+	return resp, err
 }
 
-// InjectHttp 将context写入http请求头
+// InjectHttp 将SpanContext写入jar-*请求头
 func InjectHttp(r *http.Request) func(model.SpanContext) {
 	return func(sc model.SpanContext) {
-		if sc.Debug {
-			r.Header.Set("jar-flags", "1")
-		}
-
-		if *sc.Sampled {
-			r.Header.Set("jar-sampled", "1")
-		} else {
-			r.Header.Set("jar-sampled", "0")
-		}
-
-		r.Header.Set("jar-traceid", sc.TraceID.String())
-		r.Header.Set("jar-spanid", sc.ID.String())
-
-		if sc.ParentID != nil {
-			r.Header.Set("jar-parentid", sc.ParentID.String())
-		} else {
-			r.Header.Set("jar-parentid", "0")
-		}
+		tracing.Jar().Inject(sc, r.Header)
 	}
 }
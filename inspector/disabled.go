@@ -0,0 +1,7 @@
+//go:build nodebug
+// +build nodebug
+
+package inspector
+
+// Enabled 以-tags nodebug构建时为false，此时不记录也不挂载页面
+const Enabled = false
@@ -0,0 +1,157 @@
+package inspector
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Handler 调试页面与JSON接口，path为挂载路径，routes返回当前的路由表
+//
+//	path/              HTML页面，?trace=只显示该链路的Span
+//	path/api/spans     Span，?trace=只返回该链路的Span
+//	path/api/requests  请求
+//	path/api/sql       SQL
+//	path/api/routes    路由表
+func Handler(path string, routes func() []Route) http.Handler {
+	path = strings.TrimSuffix(path, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		trace := r.URL.Query().Get("trace")
+		switch strings.TrimPrefix(r.URL.Path, path) {
+		case "", "/":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_ = page.Execute(w, &pageData{
+				Path:       path,
+				Trace:      trace,
+				Spans:      spanRows(Spans(trace), trace != ""),
+				Requests:   Requests(),
+				Statements: Statements(),
+				Routes:     routes(),
+			})
+		case "/api/spans":
+			writeJSON(w, Spans(trace))
+		case "/api/requests":
+			writeJSON(w, Requests())
+		case "/api/sql":
+			writeJSON(w, Statements())
+		case "/api/routes":
+			writeJSON(w, routes())
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type pageData struct {
+	Path       string
+	Trace      string
+	Spans      []*spanRow
+	Requests   []*Request
+	Statements []*Statement
+	Routes     []Route
+}
+
+type spanRow struct {
+	*Span
+	Indent float64
+}
+
+// spanRows 查看单条链路时按开始时间排序并按父子关系缩进
+func spanRows(spans []*Span, tree bool) []*spanRow {
+	rows := make([]*spanRow, 0, len(spans))
+	if !tree {
+		for _, s := range spans {
+			rows = append(rows, &spanRow{Span: s})
+		}
+		return rows
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Start.Before(spans[j].Start)
+	})
+	parents := make(map[string]string, len(spans))
+	for _, s := range spans {
+		parents[s.ID] = s.ParentID
+	}
+	for _, s := range spans {
+		depth := 0
+		for p := s.ParentID; p != "" && depth < len(spans); p = parents[p] {
+			if _, ok := parents[p]; !ok {
+				break
+			}
+			depth++
+		}
+		rows = append(rows, &spanRow{Span: s, Indent: 1.5 * float64(depth)})
+	}
+	return rows
+}
+
+var page = template.Must(template.New("inspector").Parse(pageTemplate))
+
+const pageTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gemini inspector</title>
+<style>
+body{font-family:-apple-system,Helvetica,Arial,sans-serif;font-size:13px;margin:16px;color:#222}
+h2{margin-top:28px;border-bottom:1px solid #ddd;padding-bottom:4px}
+table{border-collapse:collapse;width:100%}
+th,td{text-align:left;padding:3px 8px;border-bottom:1px solid #eee;vertical-align:top}
+th{background:#f6f6f6}
+code{white-space:pre-wrap;word-break:break-all}
+.err{color:#c00}
+nav a{margin-right:12px}
+</style>
+</head>
+<body>
+<nav><a href="#requests">requests</a><a href="#spans">spans</a><a href="#sql">sql</a><a href="#routes">routes</a><a href="{{.Path}}/api/requests">json</a></nav>
+
+<h2 id="requests">Requests</h2>
+<table>
+<tr><th>time</th><th>method</th><th>path</th><th>route</th><th>status</th><th>cost</th><th>client</th><th>trace</th><th>error</th></tr>
+{{range .Requests}}<tr>
+<td>{{.Time.Format "15:04:05.000"}}</td><td>{{.Method}}</td><td>{{.Path}}</td><td>{{.Route}}</td>
+<td{{if ge .Status 500}} class="err"{{end}}>{{.Status}}</td><td>{{.Cost}}</td><td>{{.ClientIP}}</td>
+<td>{{if .TraceID}}<a href="{{$.Path}}/?trace={{.TraceID}}#spans">{{.TraceID}}</a>{{end}}</td><td class="err">{{.Error}}</td>
+</tr>{{end}}
+</table>
+
+<h2 id="spans">Spans{{if .Trace}} of {{.Trace}} <a href="{{.Path}}/#spans">all</a>{{end}}</h2>
+<table>
+<tr><th>start</th><th>name</th><th>kind</th><th>service</th><th>duration</th><th>trace</th><th>tags</th></tr>
+{{range .Spans}}<tr>
+<td>{{.Start.Format "15:04:05.000"}}</td><td style="padding-left:{{.Indent}}em">{{.Name}}</td><td>{{.Kind}}</td><td>{{.Service}}</td><td>{{.Duration}}</td>
+<td><a href="{{$.Path}}/?trace={{.TraceID}}#spans">{{.TraceID}}</a></td>
+<td>{{range $k, $v := .Tags}}<div{{if eq $k "error"}} class="err"{{end}}>{{$k}}: <code>{{$v}}</code></div>{{end}}</td>
+</tr>{{end}}
+</table>
+
+<h2 id="sql">SQL</h2>
+<table>
+<tr><th>time</th><th>sql</th><th>cost</th><th>rows</th><th>source</th></tr>
+{{range .Statements}}<tr>
+<td>{{.Time.Format "15:04:05.000"}}</td><td><code>{{.SQL}}</code></td><td>{{.Cost}}</td><td>{{.Rows}}</td><td>{{.Source}}</td>
+</tr>{{end}}
+</table>
+
+<h2 id="routes">Routes</h2>
+<table>
+<tr><th>method</th><th>path</th><th>handler</th></tr>
+{{range .Routes}}<tr><td>{{.Method}}</td><td>{{.Path}}</td><td>{{.Handler}}</td></tr>{{end}}
+</table>
+</body>
+</html>
+`
@@ -0,0 +1,198 @@
+// Package inspector 开发模式下的进程内调试数据，保存最近的Span、请求与SQL，由router.Inspector挂载页面
+package inspector
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Span 上报的Span
+type Span struct {
+	TraceID  string            `json:"traceId"`
+	ID       string            `json:"id"`
+	ParentID string            `json:"parentId,omitempty"`
+	Name     string            `json:"name"`
+	Kind     string            `json:"kind,omitempty"`
+	Service  string            `json:"service,omitempty"`
+	Start    time.Time         `json:"start"`
+	Duration time.Duration     `json:"duration"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+// Request 请求记录
+type Request struct {
+	Time     time.Time     `json:"time"`
+	Method   string        `json:"method"`
+	Path     string        `json:"path"`
+	Route    string        `json:"route"`
+	Status   int           `json:"status"`
+	Cost     time.Duration `json:"cost"`
+	ClientIP string        `json:"clientIp"`
+	TraceID  string        `json:"traceId,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Statement SQL记录，只有repo开启LogMode时才有
+type Statement struct {
+	Time   time.Time `json:"time"`
+	SQL    string    `json:"sql"`
+	Cost   string    `json:"cost"`
+	Rows   string    `json:"rows"`
+	Source string    `json:"source"`
+}
+
+// Route 路由
+type Route struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Handler string `json:"handler"`
+}
+
+// ring 定长环形缓冲，写满后覆盖最早的记录
+type ring struct {
+	m     sync.Mutex
+	items []interface{}
+	next  int
+	full  bool
+}
+
+func newRing(size int) *ring {
+	return &ring{items: make([]interface{}, size)}
+}
+
+func (r *ring) push(v interface{}) {
+	r.m.Lock()
+	r.items[r.next] = v
+	r.next++
+	if r.next == len(r.items) {
+		r.next, r.full = 0, true
+	}
+	r.m.Unlock()
+}
+
+// list 由新到旧
+func (r *ring) list() []interface{} {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.items)
+	}
+	out := make([]interface{}, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, r.items[(r.next-i+len(r.items))%len(r.items)])
+	}
+	return out
+}
+
+type state struct {
+	spans      *ring
+	requests   *ring
+	statements *ring
+}
+
+var (
+	active int32
+	prefix atomic.Value
+	m      sync.RWMutex
+	st     = newState(200)
+)
+
+func newState(size int) *state {
+	return &state{spans: newRing(size), requests: newRing(size), statements: newRing(size)}
+}
+
+func current() *state {
+	m.RLock()
+	defer m.RUnlock()
+	return st
+}
+
+// Start 开始记录，path为页面路径，该路径下的请求不记录
+func Start(path string) {
+	if !Enabled {
+		return
+	}
+	prefix.Store(path)
+	atomic.StoreInt32(&active, 1)
+}
+
+// Stop 停止记录，已有的记录保留
+func Stop() {
+	atomic.StoreInt32(&active, 0)
+}
+
+// Active 是否正在记录
+func Active() bool {
+	return Enabled && atomic.LoadInt32(&active) == 1
+}
+
+// SetSize 每类记录保留的条数，默认200，修改后清空已有记录
+func SetSize(size int) {
+	if size <= 0 {
+		return
+	}
+	m.Lock()
+	st = newState(size)
+	m.Unlock()
+}
+
+// RecordSpan 记录Span，通常由Reporter调用
+func RecordSpan(s *Span) {
+	if Active() {
+		current().spans.push(s)
+	}
+}
+
+// RecordRequest 记录请求，通常由router的recover中间件调用
+func RecordRequest(r *Request) {
+	if !Active() {
+		return
+	}
+	if p, _ := prefix.Load().(string); p != "" && strings.HasPrefix(r.Path, p) {
+		return
+	}
+	current().requests.push(r)
+}
+
+// RecordStatement 记录SQL，通常由repo.Repository.Print调用
+func RecordStatement(stmt *Statement) {
+	if Active() {
+		current().statements.push(stmt)
+	}
+}
+
+// Spans 最近的Span，由新到旧，traceID不为空时只返回该链路的Span
+func Spans(traceID string) []*Span {
+	items := current().spans.list()
+	out := make([]*Span, 0, len(items))
+	for _, v := range items {
+		if s := v.(*Span); traceID == "" || s.TraceID == traceID {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Requests 最近的请求，由新到旧
+func Requests() []*Request {
+	items := current().requests.list()
+	out := make([]*Request, 0, len(items))
+	for _, v := range items {
+		out = append(out, v.(*Request))
+	}
+	return out
+}
+
+// Statements 最近的SQL，由新到旧
+func Statements() []*Statement {
+	items := current().statements.list()
+	out := make([]*Statement, 0, len(items))
+	for _, v := range items {
+		out = append(out, v.(*Statement))
+	}
+	return out
+}
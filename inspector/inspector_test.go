@@ -0,0 +1,73 @@
+package inspector
+
+import (
+	"encoding/json"
+	"github.com/openzipkin/zipkin-go/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRing(t *testing.T) {
+	r := newRing(3)
+	for i := 1; i <= 5; i++ {
+		r.push(i)
+	}
+	items := r.list()
+	if len(items) != 3 || items[0] != 5 || items[2] != 3 {
+		t.Fatalf("unexpected items %v", items)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	if !Enabled {
+		t.Skip("built with nodebug")
+	}
+	SetSize(10)
+	Start("/debug/gemini")
+	defer Stop()
+
+	rep := Reporter(nil)
+	parent := model.ID(1)
+	rep.Send(model.SpanModel{SpanContext: model.SpanContext{TraceID: model.TraceID{Low: 1}, ID: 1}, Name: "request", Timestamp: time.Now()})
+	rep.Send(model.SpanModel{SpanContext: model.SpanContext{TraceID: model.TraceID{Low: 1}, ID: 2, ParentID: &parent}, Name: "gorm query", Timestamp: time.Now()})
+	rep.Send(model.SpanModel{SpanContext: model.SpanContext{TraceID: model.TraceID{Low: 2}, ID: 3}, Name: "other", Timestamp: time.Now()})
+	RecordRequest(&Request{Method: "GET", Path: "/api/users", Status: 200, TraceID: "0000000000000001"})
+	RecordRequest(&Request{Method: "GET", Path: "/debug/gemini/api/requests"})
+	RecordStatement(&Statement{SQL: "SELECT * FROM `users`"})
+
+	h := Handler("/debug/gemini", func() []Route {
+		return []Route{{Method: "GET", Path: "/api/users"}}
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/gemini/api/spans?trace=0000000000000001", nil))
+	var spans []*Span
+	_ = json.Unmarshal(w.Body.Bytes(), &spans)
+	if len(spans) != 2 || spans[0].Name != "gorm query" || spans[0].ParentID != "0000000000000001" {
+		t.Fatalf("unexpected spans %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/gemini/api/requests", nil))
+	var requests []*Request
+	_ = json.Unmarshal(w.Body.Bytes(), &requests)
+	if len(requests) != 1 || requests[0].Path != "/api/users" {
+		t.Fatalf("requests of inspector should be ignored, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/gemini/?trace=0000000000000001", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "gorm query") || strings.Contains(body, "other") || !strings.Contains(body, "SELECT * FROM `users`") || !strings.Contains(body, "/api/users") {
+		t.Fatalf("unexpected page %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/gemini/unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+}
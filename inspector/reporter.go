@@ -0,0 +1,59 @@
+package inspector
+
+import (
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/reporter"
+)
+
+// ringReporter 记录Span后交给next上报
+type ringReporter struct {
+	next reporter.Reporter
+}
+
+// Reporter 包装next，记录时将Span写入环形缓冲，next为nil时只记录
+func Reporter(next reporter.Reporter) reporter.Reporter {
+	if !Enabled {
+		if next == nil {
+			return reporter.NewNoopReporter()
+		}
+		return next
+	}
+	return &ringReporter{next: next}
+}
+
+// Send 实现Reporter接口
+func (r *ringReporter) Send(s model.SpanModel) {
+	if Active() {
+		RecordSpan(spanOf(s))
+	}
+	if r.next != nil {
+		r.next.Send(s)
+	}
+}
+
+// Close 实现Reporter接口
+func (r *ringReporter) Close() error {
+	if r.next != nil {
+		return r.next.Close()
+	}
+	return nil
+}
+
+func spanOf(s model.SpanModel) *Span {
+	span := &Span{
+		TraceID:  s.TraceID.String(),
+		ID:       s.ID.String(),
+		Name:     s.Name,
+		Kind:     string(s.Kind),
+		Start:    s.Timestamp,
+		Duration: s.Duration,
+		Tags:     s.Tags,
+	}
+	if s.ParentID != nil {
+		span.ParentID = s.ParentID.String()
+	}
+	if s.LocalEndpoint != nil {
+		span.Service = s.LocalEndpoint.ServiceName
+	}
+	return span
+}
@@ -0,0 +1,158 @@
+package log
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"sync"
+	"time"
+)
+
+// Config 日志配置，通常由config.SetupLog从配置的log节绑定
+type Config struct {
+	// Level 全局级别，debug、info、warn、error，运行时可由SetLevel修改
+	Level string `default:"debug"`
+	// Encoding Outputs与File的编码，json或console，其它输出固定为json
+	Encoding string `default:"json" binding:"oneof=json console"`
+	// Outputs 输出，stdout、stderr或文件路径
+	Outputs []string `default:"stderr"`
+	// ErrorOutputs 日志内部错误的输出
+	ErrorOutputs []string `default:"stderr"`
+	// Sampling 采样，Initial为0时不采样
+	Sampling SamplingConfig
+	// File 滚动文件
+	File *FileConfig
+	// ErrorFile 只写入error及以上级别的滚动文件
+	ErrorFile *FileConfig
+	// Syslog syslog输出
+	Syslog *SyslogConfig
+	// Net TCP/UDP输出
+	Net *NetConfig
+	// HTTP 攒批的HTTP输出
+	HTTP *HTTPConfig
+	// Development 开发模式，DPanic级别的日志会panic
+	Development bool
+}
+
+// SamplingConfig 每秒内同样的日志先输出Initial条，之后每Thereafter条输出一条
+type SamplingConfig struct {
+	Initial    int
+	Thereafter int
+}
+
+// Setup 按配置替换所有日志的级别、编码与输出，包括已经Mark出的日志，原有的文件与连接被关闭
+func Setup(conf Config) error {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(conf.Level)); err != nil {
+		return err
+	}
+	if len(conf.Outputs) == 0 {
+		conf.Outputs = []string{"stderr"}
+	}
+	if len(conf.ErrorOutputs) == 0 {
+		conf.ErrorOutputs = []string{"stderr"}
+	}
+
+	var (
+		cores   []zapcore.Core
+		closers []func()
+		ok      bool
+	)
+	defer func() {
+		if !ok {
+			for _, c := range closers {
+				c()
+			}
+		}
+	}()
+
+	enc := encoder(conf.Encoding)
+	out, closeOut, err := zap.Open(conf.Outputs...)
+	if err != nil {
+		return err
+	}
+	closers = append(closers, closeOut)
+	cores = append(cores, zapcore.NewCore(enc, out, zapcore.DebugLevel))
+
+	errOut, closeErrOut, err := zap.Open(conf.ErrorOutputs...)
+	if err != nil {
+		return err
+	}
+	closers = append(closers, closeErrOut)
+
+	if conf.File != nil && conf.File.Filename != "" {
+		w := newFileWriter(conf.File)
+		closers = append(closers, func() { _ = w.Close() })
+		cores = append(cores, zapcore.NewCore(enc.Clone(), w, zapcore.DebugLevel))
+	}
+	if conf.ErrorFile != nil && conf.ErrorFile.Filename != "" {
+		w := newFileWriter(conf.ErrorFile)
+		closers = append(closers, func() { _ = w.Close() })
+		cores = append(cores, zapcore.NewCore(enc.Clone(), w, zapcore.ErrorLevel))
+	}
+	if conf.Syslog != nil {
+		core, closeSyslog, err := newSyslogCore(conf.Syslog, encoder("json"))
+		if err != nil {
+			return err
+		}
+		closers = append(closers, closeSyslog)
+		cores = append(cores, core)
+	}
+	if conf.Net != nil && conf.Net.Addr != "" {
+		w := newNetWriter(conf.Net)
+		closers = append(closers, w.Close)
+		cores = append(cores, zapcore.NewCore(encoder("json"), w, zapcore.DebugLevel))
+	}
+	if conf.HTTP != nil && conf.HTTP.URL != "" {
+		w := newHTTPWriter(conf.HTTP)
+		closers = append(closers, w.Close)
+		cores = append(cores, zapcore.NewCore(encoder("json"), w, zapcore.DebugLevel))
+	}
+
+	core := zapcore.NewTee(cores...)
+	if conf.Sampling.Initial > 0 {
+		core = zapcore.NewSampler(core, time.Second, conf.Sampling.Initial, conf.Sampling.Thereafter)
+	}
+	if conf.Development {
+		core = &developmentCore{Core: core}
+	}
+
+	ok = true
+	level.SetLevel(l)
+	errorOutput.set(errOut)
+	root.store(core, closers...)
+	return nil
+}
+
+func encoder(encoding string) zapcore.Encoder {
+	if encoding == "console" {
+		return zapcore.NewConsoleEncoder(encoderConfig())
+	}
+	return zapcore.NewJSONEncoder(encoderConfig())
+}
+
+// errorOutput 日志内部错误的输出，Setup时替换
+var errorOutput = &swapSyncer{ws: zapcore.Lock(os.Stderr)}
+
+type swapSyncer struct {
+	m  sync.RWMutex
+	ws zapcore.WriteSyncer
+}
+
+func (s *swapSyncer) set(ws zapcore.WriteSyncer) {
+	s.m.Lock()
+	s.ws = ws
+	s.m.Unlock()
+}
+
+func (s *swapSyncer) Write(p []byte) (int, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.ws.Write(p)
+}
+
+func (s *swapSyncer) Sync() error {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.ws.Sync()
+}
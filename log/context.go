@@ -0,0 +1,63 @@
+package log
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"sync"
+)
+
+type fieldsKey struct{}
+
+// Extractor 从context中提取日志字段，如tracing包注册的trace_id与span_id
+type Extractor func(ctx context.Context) []zap.Field
+
+var (
+	extractorsM sync.RWMutex
+	extractors  []Extractor
+)
+
+// RegisterExtractor 注册字段提取函数，通常在init中调用
+func RegisterExtractor(e Extractor) {
+	extractorsM.Lock()
+	extractors = append(extractors, e)
+	extractorsM.Unlock()
+}
+
+// WithFields 将字段写入context，之后由该context取出的日志都带有这些字段
+func WithFields(ctx context.Context, fields ...zap.Field) context.Context {
+	old, _ := ctx.Value(fieldsKey{}).([]zap.Field)
+	all := make([]zap.Field, 0, len(old)+len(fields))
+	all = append(all, old...)
+	all = append(all, fields...)
+	return context.WithValue(ctx, fieldsKey{}, all)
+}
+
+// Fields context中的日志字段，包括WithFields写入的字段与提取函数的结果
+func Fields(ctx context.Context) []zap.Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]zap.Field)
+	fields = append([]zap.Field{}, fields...)
+
+	extractorsM.RLock()
+	defer extractorsM.RUnlock()
+	for _, e := range extractors {
+		fields = append(fields, e(ctx)...)
+	}
+	return fields
+}
+
+// Ctx 附加context中的日志字段，如 logger.Ctx(ctx).Info("...")
+func (l *ZapLogger) Ctx(ctx context.Context) *ZapLogger {
+	fields := Fields(ctx)
+	if len(fields) == 0 {
+		return l
+	}
+	return &ZapLogger{l.Logger.With(fields...)}
+}
+
+// FromContext 带有context中日志字段的Zap
+func FromContext(ctx context.Context) *ZapLogger {
+	return Zap.Ctx(ctx)
+}
@@ -0,0 +1,77 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "log")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "app.log")
+
+	// 包初始化时Mark出的日志在Setup后同样生效
+	logger := Zap.Mark("test")
+	if err := Setup(Config{Level: "info", Outputs: []string{file}}); err != nil {
+		t.Fatal(err)
+	}
+	defer new()
+
+	RegisterExtractor(func(ctx context.Context) []zap.Field {
+		if id, ok := ctx.Value("trace").(string); ok {
+			return []zap.Field{zap.String("trace_id", id)}
+		}
+		return nil
+	})
+	ctx := context.WithValue(context.Background(), "trace", "t1")
+	ctx = WithFields(ctx, zap.Int("user_id", 7))
+
+	logger.Ctx(ctx).Debug("dropped")
+	logger.Ctx(ctx).Info("kept")
+	_ = Zap.Sync()
+
+	b, _ := ioutil.ReadFile(file)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["msg"] != "kept" || entry["mod"] != "test" || entry["trace_id"] != "t1" || entry["user_id"] != float64(7) {
+		t.Fatalf("unexpected entry %v", entry)
+	}
+
+	if err := Setup(Config{Level: "verbose"}); err == nil {
+		t.Fatal("invalid level should fail")
+	}
+}
+
+func TestSetup_Development(t *testing.T) {
+	logger := Zap.Mark("test")
+	if err := Setup(Config{Level: "info", Outputs: []string{os.DevNull}, Development: true}); err != nil {
+		t.Fatal(err)
+	}
+	defer new()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("DPanic should panic in development mode")
+			}
+		}()
+		logger.With(zap.String("k", "v")).DPanic("boom")
+	}()
+
+	if err := Setup(Config{Level: "info", Outputs: []string{os.DevNull}}); err != nil {
+		t.Fatal(err)
+	}
+	logger.DPanic("no panic")
+}
@@ -0,0 +1,121 @@
+package log
+
+import (
+	"go.uber.org/zap/zapcore"
+	"sync"
+	"sync/atomic"
+)
+
+// root 所有日志共用的底层core，Setup等替换它后，包括包初始化时Mark出的日志都随之生效
+// 底层core不过滤级别，级别由proxyCore按全局或模块级别判断
+var root = &rootCore{}
+
+type rootCore struct {
+	m       sync.RWMutex
+	core    zapcore.Core
+	gen     uint64
+	closers []func()
+}
+
+func (r *rootCore) load() (zapcore.Core, uint64) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return r.core, r.gen
+}
+
+// store 替换core并关闭原core的文件、连接等输出
+func (r *rootCore) store(core zapcore.Core, closers ...func()) {
+	r.m.Lock()
+	oldCore, old := r.core, r.closers
+	r.core = core
+	r.closers = closers
+	r.gen++
+	r.m.Unlock()
+
+	//Sync可能等待HTTP输出发送完积压的日志，释放锁后再进行，避免阻塞所有日志
+	if oldCore != nil {
+		_ = oldCore.Sync()
+	}
+	for _, c := range old {
+		c()
+	}
+}
+
+// proxyCore 将调用转发给root，With的字段在root替换后重新附加
+type proxyCore struct {
+	module string
+	fields []zapcore.Field
+	cache  atomic.Value
+}
+
+type cachedCore struct {
+	gen  uint64
+	core zapcore.Core
+}
+
+func newProxyCore() *proxyCore {
+	return &proxyCore{}
+}
+
+func (p *proxyCore) current() zapcore.Core {
+	core, gen := root.load()
+	if len(p.fields) == 0 {
+		return core
+	}
+	if c, ok := p.cache.Load().(*cachedCore); ok && c.gen == gen {
+		return c.core
+	}
+	core = core.With(p.fields)
+	p.cache.Store(&cachedCore{gen: gen, core: core})
+	return core
+}
+
+// withModule 使用模块级别判断的core，见SetLevel
+func (p *proxyCore) withModule(module string) *proxyCore {
+	return &proxyCore{module: module, fields: p.fields}
+}
+
+func (p *proxyCore) Enabled(lvl zapcore.Level) bool {
+	return enabled(p.module, lvl)
+}
+
+func (p *proxyCore) With(fields []zapcore.Field) zapcore.Core {
+	all := make([]zapcore.Field, 0, len(p.fields)+len(fields))
+	all = append(all, p.fields...)
+	all = append(all, fields...)
+	return &proxyCore{module: p.module, fields: all}
+}
+
+func (p *proxyCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !p.Enabled(entry.Level) {
+		return ce
+	}
+	return p.current().Check(entry, ce)
+}
+
+func (p *proxyCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return p.current().Write(entry, fields)
+}
+
+func (p *proxyCore) Sync() error {
+	core, _ := root.load()
+	return core.Sync()
+}
+
+// developmentCore 同zap.Development()，DPanic级别的日志写入后panic
+// 日志实例创建后只替换core，开发模式需由core实现
+type developmentCore struct {
+	zapcore.Core
+}
+
+func (d *developmentCore) With(fields []zapcore.Field) zapcore.Core {
+	return &developmentCore{Core: d.Core.With(fields)}
+}
+
+func (d *developmentCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	ce = d.Core.Check(entry, ce)
+	if entry.Level == zapcore.DPanicLevel {
+		ce = ce.Should(entry, zapcore.WriteThenPanic)
+	}
+	return ce
+}
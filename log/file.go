@@ -0,0 +1,74 @@
+package log
+
+import (
+	"gopkg.in/natefinch/lumberjack.v2"
+	"sync"
+	"time"
+)
+
+// FileConfig 滚动文件输出，按大小切分，设置Interval时同时按时间切分
+type FileConfig struct {
+	// Filename 文件路径，切分后的文件名带有时间，如app-2020-01-02T15-04-05.000.log
+	Filename string
+	// MaxSize 单个文件的最大大小，单位MB，默认100
+	MaxSize int
+	// MaxAge 保留天数，0为不按天数清理
+	MaxAge int
+	// MaxBackups 保留的文件数，0为不按数量清理
+	MaxBackups int
+	// Compress 是否gzip压缩切分后的文件
+	Compress bool
+	// Interval 按时间切分的间隔，如24h在每天零点切分，0为不按时间切分
+	Interval time.Duration
+}
+
+// fileWriter 在lumberjack按大小切分的基础上按时间切分
+type fileWriter struct {
+	*lumberjack.Logger
+	interval time.Duration
+	m        sync.Mutex
+	next     time.Time
+}
+
+func newFileWriter(conf *FileConfig) *fileWriter {
+	return &fileWriter{
+		Logger: &lumberjack.Logger{
+			Filename:   conf.Filename,
+			MaxSize:    conf.MaxSize,
+			MaxAge:     conf.MaxAge,
+			MaxBackups: conf.MaxBackups,
+			Compress:   conf.Compress,
+			LocalTime:  true,
+		},
+		interval: conf.Interval,
+	}
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	if w.interval > 0 {
+		now := time.Now()
+		w.m.Lock()
+		if w.next.IsZero() {
+			w.next = boundary(now, w.interval)
+		} else if !now.Before(w.next) {
+			w.next = boundary(now, w.interval)
+			if err := w.Logger.Rotate(); err != nil {
+				w.m.Unlock()
+				return 0, err
+			}
+		}
+		w.m.Unlock()
+	}
+	return w.Logger.Write(p)
+}
+
+func (w *fileWriter) Sync() error {
+	return nil
+}
+
+// boundary t之后下一个按本地时间对齐的切分时间
+func boundary(t time.Time, d time.Duration) time.Time {
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(d).Add(d).Add(-shift)
+}
@@ -0,0 +1,58 @@
+package log
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"strings"
+	"sync"
+)
+
+// level 全局级别，未单独设置级别的模块使用
+var level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+
+// modules 按Mark名称单独设置的级别
+var modules sync.Map
+
+// SetLevel 运行时修改级别，module为Mark的名称，为空时修改全局级别
+func SetLevel(module string, l string) error {
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(l)); err != nil {
+		return err
+	}
+	module = strings.ToLower(module)
+	if module == "" {
+		level.SetLevel(lvl)
+		return nil
+	}
+	if v, ok := modules.Load(module); ok {
+		v.(zap.AtomicLevel).SetLevel(lvl)
+		return nil
+	}
+	modules.Store(module, zap.NewAtomicLevelAt(lvl))
+	return nil
+}
+
+// ResetLevel 取消模块单独设置的级别，恢复使用全局级别
+func ResetLevel(module string) {
+	modules.Delete(strings.ToLower(module))
+}
+
+// Levels 全局级别与单独设置级别的模块
+func Levels() (string, map[string]string) {
+	m := make(map[string]string)
+	modules.Range(func(key, value interface{}) bool {
+		m[key.(string)] = value.(zap.AtomicLevel).String()
+		return true
+	})
+	return level.String(), m
+}
+
+// enabled 模块单独设置了级别时按模块级别判断，否则按全局级别
+func enabled(module string, lvl zapcore.Level) bool {
+	if module != "" {
+		if v, ok := modules.Load(module); ok {
+			return v.(zap.AtomicLevel).Enabled(lvl)
+		}
+	}
+	return level.Enabled(lvl)
+}
@@ -0,0 +1,225 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// NetConfig TCP/UDP输出，每条日志为一行JSON
+type NetConfig struct {
+	// Network tcp或udp，默认tcp
+	Network string
+	Addr    string
+}
+
+// errWriterClosed 输出已关闭，配置替换前获取旧core的日志写入时返回
+var errWriterClosed = errors.New("log: writer is closed")
+
+// netWriter 写入失败时断开，下次写入时重连，关闭后不再重连
+type netWriter struct {
+	network string
+	addr    string
+	m       sync.Mutex
+	conn    net.Conn
+	closed  bool
+}
+
+func newNetWriter(conf *NetConfig) *netWriter {
+	network := conf.Network
+	if network == "" {
+		network = "tcp"
+	}
+	return &netWriter{network: network, addr: conf.Addr}
+}
+
+func (w *netWriter) Write(p []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.closed {
+		return 0, errWriterClosed
+	}
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.network, w.addr, 3*time.Second)
+		if err != nil {
+			return 0, err
+		}
+		w.conn = conn
+	}
+	n, err := w.conn.Write(p)
+	if err != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	return n, err
+}
+
+func (w *netWriter) Sync() error {
+	return nil
+}
+
+func (w *netWriter) Close() {
+	w.m.Lock()
+	defer w.m.Unlock()
+	w.closed = true
+	if w.conn != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// HTTPConfig HTTP输出，日志攒批后以JSON数组POST到URL
+type HTTPConfig struct {
+	URL string
+	// BatchSize 每批条数，默认100
+	BatchSize int
+	// Interval 未攒满时的发送间隔，默认1s
+	Interval time.Duration
+	// Timeout 请求超时，默认5s
+	Timeout time.Duration
+	// Headers 附加的请求头，如鉴权
+	Headers map[string]string
+}
+
+// httpWriter 积压超过10批时丢弃最早的日志
+type httpWriter struct {
+	conf   HTTPConfig
+	client *http.Client
+	m      sync.Mutex
+	lines  [][]byte
+	flush  chan chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newHTTPWriter(conf *HTTPConfig) *httpWriter {
+	w := &httpWriter{
+		conf:  *conf,
+		flush: make(chan chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if w.conf.BatchSize <= 0 {
+		w.conf.BatchSize = 100
+	}
+	if w.conf.Interval <= 0 {
+		w.conf.Interval = time.Second
+	}
+	if w.conf.Timeout <= 0 {
+		w.conf.Timeout = 5 * time.Second
+	}
+	w.client = &http.Client{Timeout: w.conf.Timeout}
+
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+func (w *httpWriter) Write(p []byte) (int, error) {
+	line := make([]byte, len(bytes.TrimRight(p, "\n")))
+	copy(line, p)
+
+	w.m.Lock()
+	w.lines = append(w.lines, line)
+	if over := len(w.lines) - w.conf.BatchSize*10; over > 0 {
+		w.lines = w.lines[over:]
+	}
+	full := len(w.lines) >= w.conf.BatchSize
+	w.m.Unlock()
+
+	if full {
+		select {
+		case w.flush <- nil:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Sync 发送所有积压的日志
+func (w *httpWriter) Sync() error {
+	ch := make(chan struct{})
+	select {
+	case w.flush <- ch:
+		<-ch
+	case <-w.done:
+	}
+	return nil
+}
+
+func (w *httpWriter) Close() {
+	_ = w.Sync()
+	close(w.done)
+	w.wg.Wait()
+}
+
+func (w *httpWriter) run() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.send()
+		case ch := <-w.flush:
+			w.send()
+			if ch != nil {
+				close(ch)
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *httpWriter) send() {
+	for {
+		w.m.Lock()
+		n := len(w.lines)
+		if n > w.conf.BatchSize {
+			n = w.conf.BatchSize
+		}
+		batch := w.lines[:n]
+		w.lines = w.lines[n:]
+		w.m.Unlock()
+
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.post(batch); err != nil {
+			_, _ = fmt.Fprintf(errorOutput, "log: http sink error: %v\n", err)
+			return
+		}
+	}
+}
+
+func (w *httpWriter) post(batch [][]byte) error {
+	body := bytes.NewBuffer(nil)
+	body.WriteByte('[')
+	body.Write(bytes.Join(batch, []byte(",")))
+	body.WriteByte(']')
+
+	req, err := http.NewRequest(http.MethodPost, w.conf.URL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.conf.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package log
+
+import (
+	"bufio"
+	"encoding/json"
+	"go.uber.org/zap/zapcore"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetup_Sinks(t *testing.T) {
+	var (
+		m       sync.Mutex
+		batches [][]map[string]interface{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Error(err)
+		}
+		m.Lock()
+		batches = append(batches, batch)
+		m.Unlock()
+	}))
+	defer server.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	dir, _ := ioutil.TempDir("", "log")
+	defer os.RemoveAll(dir)
+
+	err = Setup(Config{
+		Level:     "debug",
+		Outputs:   []string{filepath.Join(dir, "out.log")},
+		File:      &FileConfig{Filename: filepath.Join(dir, "app.log"), Interval: time.Hour},
+		ErrorFile: &FileConfig{Filename: filepath.Join(dir, "error.log")},
+		Net:       &NetConfig{Network: "tcp", Addr: ln.Addr().String()},
+		HTTP:      &HTTPConfig{URL: server.URL, BatchSize: 2, Interval: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer new()
+
+	logger := Zap.Mark("sink")
+	logger.Info("one")
+	logger.Info("two")
+	logger.Error("three")
+	_ = Zap.Sync()
+
+	m.Lock()
+	count := 0
+	for _, batch := range batches {
+		count += len(batch)
+	}
+	m.Unlock()
+	if count != 3 {
+		t.Fatalf("http sink should receive 3 entries, got %d", count)
+	}
+
+	select {
+	case line := <-lines:
+		if !strings.Contains(line, `"msg":"one"`) {
+			t.Fatalf("unexpected tcp line %s", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("tcp sink timeout")
+	}
+
+	app, _ := ioutil.ReadFile(filepath.Join(dir, "app.log"))
+	errs, _ := ioutil.ReadFile(filepath.Join(dir, "error.log"))
+	if strings.Count(string(app), "\n") != 3 || strings.Count(string(errs), "\n") != 1 || !strings.Contains(string(errs), "three") {
+		t.Fatalf("unexpected files:\n%s\n%s", app, errs)
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "log")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "app.log")
+	if err := Setup(Config{Level: "info", Outputs: []string{file}}); err != nil {
+		t.Fatal(err)
+	}
+	defer new()
+
+	redis := Zap.Mark("Redis")
+	other := Zap.Mark("other")
+	if err := SetLevel("redis", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	defer ResetLevel("redis")
+
+	redis.Debug("redis debug")
+	other.Debug("other debug")
+	if global, m := Levels(); global != "info" || m["redis"] != "debug" {
+		t.Fatalf("unexpected levels %s %v", global, m)
+	}
+
+	_ = SetLevel("", "error")
+	ResetLevel("redis")
+	redis.Warn("redis warn")
+	_ = Zap.Sync()
+
+	b, _ := ioutil.ReadFile(file)
+	if s := string(b); !strings.Contains(s, "redis debug") || strings.Contains(s, "other debug") || strings.Contains(s, "redis warn") {
+		t.Fatalf("unexpected output %s", s)
+	}
+	if err := SetLevel("redis", "verbose"); err == nil {
+		t.Fatal("invalid level should fail")
+	}
+}
+
+func TestBoundary(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	next := boundary(time.Date(2020, 1, 2, 15, 4, 5, 0, loc), 24*time.Hour)
+	if !next.Equal(time.Date(2020, 1, 3, 0, 0, 0, 0, loc)) {
+		t.Fatalf("unexpected boundary %s", next)
+	}
+}
+
+func TestNetWriter_Closed(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	w := newNetWriter(&NetConfig{Addr: ln.Addr().String()})
+	if _, err := w.Write([]byte("a\n")); err != nil {
+		t.Fatal(err)
+	}
+	<-accepted
+	w.Close()
+
+	if _, err := w.Write([]byte("b\n")); err != errWriterClosed {
+		t.Fatalf("write after close should fail, got %v", err)
+	}
+	select {
+	case <-accepted:
+		t.Fatal("closed writer should not reconnect")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// blockingCore Sync阻塞直到release关闭
+type blockingCore struct {
+	zapcore.Core
+	release chan struct{}
+}
+
+func (c *blockingCore) Sync() error {
+	<-c.release
+	return nil
+}
+
+func TestRootCore_StoreSyncUnlocked(t *testing.T) {
+	r := &rootCore{}
+	release := make(chan struct{})
+	r.store(&blockingCore{Core: zapcore.NewNopCore(), release: release})
+
+	done := make(chan struct{})
+	go func() {
+		r.store(zapcore.NewNopCore())
+		close(done)
+	}()
+
+	loaded := make(chan struct{})
+	go func() {
+		for {
+			if _, gen := r.load(); gen == 2 {
+				close(loaded)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	select {
+	case <-loaded:
+	case <-time.After(time.Second):
+		t.Fatal("load should not wait for the old core to sync")
+	}
+	close(release)
+	<-done
+}
@@ -0,0 +1,74 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package log
+
+import (
+	"go.uber.org/zap/zapcore"
+	"log/syslog"
+)
+
+// SyslogConfig syslog输出，Network与Addr为空时写入本机syslog
+type SyslogConfig struct {
+	Network string
+	Addr    string
+	// Tag 默认为进程名
+	Tag string
+}
+
+// syslogCore 按日志级别写入对应的syslog优先级
+type syslogCore struct {
+	zapcore.LevelEnabler
+	enc    zapcore.Encoder
+	writer *syslog.Writer
+}
+
+func newSyslogCore(conf *SyslogConfig, enc zapcore.Encoder) (zapcore.Core, func(), error) {
+	w, err := syslog.Dial(conf.Network, conf.Addr, syslog.LOG_INFO|syslog.LOG_LOCAL0, conf.Tag)
+	if err != nil {
+		return nil, nil, err
+	}
+	core := &syslogCore{LevelEnabler: zapcore.DebugLevel, enc: enc, writer: w}
+	return core, func() { _ = w.Close() }, nil
+}
+
+func (c *syslogCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for i := range fields {
+		fields[i].AddTo(enc)
+	}
+	return &syslogCore{LevelEnabler: c.LevelEnabler, enc: enc, writer: c.writer}
+}
+
+func (c *syslogCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c *syslogCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(entry, fields)
+	if err != nil {
+		return err
+	}
+	msg := buf.String()
+	buf.Free()
+
+	switch entry.Level {
+	case zapcore.DebugLevel:
+		return c.writer.Debug(msg)
+	case zapcore.InfoLevel:
+		return c.writer.Info(msg)
+	case zapcore.WarnLevel:
+		return c.writer.Warning(msg)
+	case zapcore.ErrorLevel:
+		return c.writer.Err(msg)
+	default:
+		return c.writer.Crit(msg)
+	}
+}
+
+func (c *syslogCore) Sync() error {
+	return nil
+}
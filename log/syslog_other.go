@@ -0,0 +1,20 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package log
+
+import (
+	"errors"
+	"go.uber.org/zap/zapcore"
+)
+
+// SyslogConfig syslog输出，当前系统不支持
+type SyslogConfig struct {
+	Network string
+	Addr    string
+	Tag     string
+}
+
+func newSyslogCore(conf *SyslogConfig, enc zapcore.Encoder) (zapcore.Core, func(), error) {
+	return nil, nil, errors.New("log: syslog is not supported on this platform")
+}
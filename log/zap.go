@@ -23,53 +23,73 @@ func init() {
 }
 
 func new() {
-	config := zap.Config{
-		Level:       zap.NewAtomicLevelAt(zapcore.DebugLevel),
-		Development: false,
-		Sampling: &zap.SamplingConfig{
+	Zap = &ZapLogger{Logger: zap.New(newProxyCore(), zap.AddCaller(), zap.ErrorOutput(errorOutput))}
+	Logger = Zap
+
+	_ = Setup(Config{
+		Level:    "debug",
+		Encoding: "json",
+		Outputs:  []string{"stderr"},
+		Sampling: SamplingConfig{
 			Initial:    100,
 			Thereafter: 100,
 		},
-		Encoding:          "json",
-		DisableStacktrace: true,
-		EncoderConfig: zapcore.EncoderConfig{
-			MessageKey:     "msg",
-			LevelKey:       "level",
-			TimeKey:        "time",
-			NameKey:        "logger",
-			CallerKey:      "caller",
-			StacktraceKey:  "stacktrace",
-			LineEnding:     zapcore.DefaultLineEnding,
-			EncodeLevel:    zapcore.LowercaseLevelEncoder,
-			EncodeTime:     zapcore.ISO8601TimeEncoder,
-			EncodeDuration: zapcore.StringDurationEncoder,
-			EncodeCaller:   zapcore.ShortCallerEncoder,
-		},
-		OutputPaths:      []string{"stderr"},
-		ErrorOutputPaths: []string{"stderr"},
+	})
+}
+
+func encoderConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		MessageKey:     "msg",
+		LevelKey:       "level",
+		TimeKey:        "time",
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		StacktraceKey:  "stacktrace",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
 	}
+}
 
-	logger, _ := config.Build()
-	Zap = &ZapLogger{Logger: logger}
-	Logger = Zap
+// build 按zap配置构建core并替换root，级别写入全局级别
+func build(config zap.Config) error {
+	level.SetLevel(config.Level.Level())
+	config.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+
+	logger, err := config.Build()
+	if err != nil {
+		return err
+	}
+	core := logger.Core()
+	if config.Development {
+		core = &developmentCore{Core: core}
+	}
+	root.store(core)
+	return nil
 }
 
+// Producation 使用zap的生产环境配置，已创建的日志同时生效
 func Producation() {
-	logger, _ := zap.NewProduction()
-	Zap = &ZapLogger{
-		logger,
-	}
+	_ = build(zap.NewProductionConfig())
 }
 
+// Development 使用zap的开发环境配置，已创建的日志同时生效
 func Development() {
-	logger, _ := zap.NewDevelopment()
-	Zap = &ZapLogger{
-		logger,
-	}
+	_ = build(zap.NewDevelopmentConfig())
 }
 
+// Mark 标记模块，日志带有mod字段，级别可由SetLevel按模块单独设置
 func (l *ZapLogger) Mark(key string) *ZapLogger {
-	return &ZapLogger{l.Logger.With(zap.String("mod", strings.ToLower(key)))}
+	key = strings.ToLower(key)
+	logger := l.Logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		if p, ok := core.(*proxyCore); ok {
+			return p.withModule(key)
+		}
+		return core
+	}))
+	return &ZapLogger{logger.With(zap.String("mod", key))}
 }
 
 func (l *ZapLogger) Caller(skip int) *ZapLogger {
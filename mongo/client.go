@@ -46,7 +46,7 @@ func New(opts ...Option) *MgoClient {
 		opt(mgo)
 	}
 
-	client, err := mongo.NewClient(options.Client().ApplyURI(fmt.Sprintf("mongodb://%s", mgo.addr)))
+	client, err := mongo.NewClient(options.Client().ApplyURI(fmt.Sprintf("mongodb://%s", mgo.addr)).SetMonitor(monitor()))
 	if err != nil {
 		entry.Fatal(log.Message(err))
 	}
@@ -0,0 +1,45 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"github.com/Jarnpher553/gemini/tracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"go.mongodb.org/mongo-driver/event"
+	"sync"
+)
+
+// monitor 命令监视器，操作的ctx中有Span时为命令创建子Span，不记录命令内容
+func monitor() *event.CommandMonitor {
+	var spans sync.Map
+
+	finish := func(requestID int64, err error) {
+		if span, ok := spans.Load(requestID); ok {
+			spans.Delete(requestID)
+			tracing.Finish(span.(opentracing.Span), err)
+		}
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			collection, _ := e.Command.Lookup(e.CommandName).StringValueOK()
+			span, _ := tracing.StartChild(ctx, "mongo "+e.CommandName,
+				ext.SpanKindRPCClient,
+				opentracing.Tag{Key: string(ext.DBType), Value: "mongo"},
+				opentracing.Tag{Key: string(ext.DBInstance), Value: e.DatabaseName},
+				opentracing.Tag{Key: "db.collection", Value: collection},
+				opentracing.Tag{Key: string(ext.PeerAddress), Value: e.ConnectionID},
+			)
+			if span != nil {
+				spans.Store(e.RequestID, span)
+			}
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			finish(e.RequestID, nil)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			finish(e.RequestID, errors.New(e.Failure))
+		},
+	}
+}
@@ -0,0 +1,216 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Jarnpher553/gemini/event"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/mqtt"
+	"github.com/Jarnpher553/gemini/queue"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// ErrSkip 由Transform返回时丢弃消息且不视为失败
+var ErrSkip = errors.New("skip message")
+
+// Transform 转换mqtt消息，投递到queue时结果须为string或[]byte，其它类型按JSON编码；投递到event时结果作为事件内容
+type Transform func(ctx *mqtt.Context) (interface{}, error)
+
+// Bridge 将mqtt消息转发到queue或event
+// 转发在paho的消息回调中同步执行，QoS 1/2的消息在转发成功或重试耗尽后才会被确认；
+// 并发数达到上限时回调阻塞，paho停止读取连接，从而向broker施加背压
+type Bridge struct {
+	client       *mqtt.Client
+	maxRetry     int
+	backoff      time.Duration
+	sem          chan struct{}
+	onFailure    func(ctx *mqtt.Context, err error)
+	logger       *log.ZapLogger
+	publishQueue func(name string, payload interface{}) error
+	publishEvent func(channel string, ev *event.Event) error
+}
+
+// Option 配置函数
+type Option func(*Bridge)
+
+// MaxRetry QoS 1/2消息转发失败时的最大重试次数，默认5，QoS 0消息不重试
+func MaxRetry(n int) Option {
+	return func(b *Bridge) {
+		b.maxRetry = n
+	}
+}
+
+// Backoff 重试间隔，按重试次数递增，默认200ms
+func Backoff(d time.Duration) Option {
+	return func(b *Bridge) {
+		b.backoff = d
+	}
+}
+
+// Concurrency 同时转发的最大消息数，默认16，客户端需设置OrderMatters(false)才会并发回调
+func Concurrency(n int) Option {
+	return func(b *Bridge) {
+		b.sem = make(chan struct{}, n)
+	}
+}
+
+// OnFailure 重试耗尽时回调，默认记录日志
+func OnFailure(f func(ctx *mqtt.Context, err error)) Option {
+	return func(b *Bridge) {
+		b.onFailure = f
+	}
+}
+
+// New 构造函数
+func New(client *mqtt.Client, options ...Option) *Bridge {
+	b := &Bridge{
+		client:       client,
+		maxRetry:     5,
+		backoff:      200 * time.Millisecond,
+		sem:          make(chan struct{}, 16),
+		logger:       log.Zap.Mark("mqttBridge"),
+		publishQueue: queue.Publish,
+		publishEvent: event.Publish,
+	}
+	for _, op := range options {
+		op(b)
+	}
+	return b
+}
+
+// route 单条转发规则
+type route struct {
+	transform  Transform
+	middleware []mqtt.Middleware
+}
+
+// RouteOption 转发规则配置函数
+type RouteOption func(*route)
+
+// WithTransform 设置消息转换函数
+func WithTransform(transform Transform) RouteOption {
+	return func(r *route) {
+		r.transform = transform
+	}
+}
+
+// WithMiddleware 设置转发规则的中间件
+func WithMiddleware(middleware ...mqtt.Middleware) RouteOption {
+	return func(r *route) {
+		r.middleware = append(r.middleware, middleware...)
+	}
+}
+
+// ToQueue 将匹配pattern的消息发布到队列，name中的{param}替换为主题中对应的参数
+func (b *Bridge) ToQueue(pattern string, qos byte, name string, options ...RouteOption) error {
+	r := &route{transform: raw}
+	for _, op := range options {
+		op(r)
+	}
+
+	return b.client.Handle(pattern, qos, b.handler(r, func(ctx *mqtt.Context, v interface{}) error {
+		payload, err := text(v)
+		if err != nil {
+			return err
+		}
+		return b.publishQueue(expand(name, ctx), payload)
+	}), r.middleware...)
+}
+
+// ToEvent 将匹配pattern的消息作为action事件发布到频道，channel中的{param}替换为主题中对应的参数
+func (b *Bridge) ToEvent(pattern string, qos byte, channel string, action string, options ...RouteOption) error {
+	r := &route{transform: content}
+	for _, op := range options {
+		op(r)
+	}
+
+	return b.client.Handle(pattern, qos, b.handler(r, func(ctx *mqtt.Context, v interface{}) error {
+		err := b.publishEvent(expand(channel, ctx), event.NewEvent(action, v))
+		if err == event.ErrNoSubscriber {
+			return nil
+		}
+		return err
+	}), r.middleware...)
+}
+
+func (b *Bridge) handler(r *route, forward func(*mqtt.Context, interface{}) error) mqtt.HandlerFunc {
+	return func(ctx *mqtt.Context) error {
+		b.sem <- struct{}{}
+		defer func() { <-b.sem }()
+
+		v, err := r.transform(ctx)
+		if err == ErrSkip {
+			return nil
+		}
+		if err != nil {
+			return b.fail(ctx, fmt.Errorf("transform error: %w", err))
+		}
+
+		attempts := 1
+		if ctx.Message.Qos() > 0 {
+			attempts += b.maxRetry
+		}
+		for i := 1; ; i++ {
+			err = forward(ctx, v)
+			if err == nil {
+				return nil
+			}
+			if i >= attempts {
+				return b.fail(ctx, err)
+			}
+
+			b.logger.Warn(log.Message("forward error:", err), zap.String("topic", ctx.Topic()), zap.Int("attempts", i))
+			select {
+			case <-time.After(time.Duration(i) * b.backoff):
+			case <-ctx.Done():
+				return b.fail(ctx, ctx.Err())
+			}
+		}
+	}
+}
+
+func (b *Bridge) fail(ctx *mqtt.Context, err error) error {
+	if b.onFailure != nil {
+		b.onFailure(ctx, err)
+		return nil
+	}
+	return err
+}
+
+// raw 默认的队列转换，原样转发
+func raw(ctx *mqtt.Context) (interface{}, error) {
+	return string(ctx.Payload()), nil
+}
+
+// content 默认的事件转换，JSON内容原样嵌入，其它作为字符串
+func content(ctx *mqtt.Context) (interface{}, error) {
+	if json.Valid(ctx.Payload()) {
+		return json.RawMessage(ctx.Payload()), nil
+	}
+	return string(ctx.Payload()), nil
+}
+
+func text(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case []byte:
+		return string(t), nil
+	default:
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+}
+
+func expand(name string, ctx *mqtt.Context) string {
+	if !strings.Contains(name, "{") {
+		return name
+	}
+	for k, v := range ctx.Params {
+		name = strings.Replace(name, "{"+k+"}", v, -1)
+	}
+	return name
+}
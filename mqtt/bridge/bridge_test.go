@@ -0,0 +1,154 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"github.com/Jarnpher553/gemini/event"
+	"github.com/Jarnpher553/gemini/mqtt"
+	"github.com/Jarnpher553/gemini/mqtt/broker"
+	"github.com/Jarnpher553/gemini/queue"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type reading struct {
+	Temp float64 `json:"temp"`
+}
+
+func connect(t *testing.T) (*broker.Server, *mqtt.Client) {
+	s := broker.New(broker.Addr("127.0.0.1:0"))
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	c, err := mqtt.New(mqtt.Broker(s.URL()), mqtt.ClientID(t.Name()))
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return s, c
+}
+
+func TestToQueue(t *testing.T) {
+	s, c := connect(t)
+	defer s.Close()
+	defer c.Disconnect(0)
+
+	got := make(chan string, 1)
+	queue.Assign("telemetry.d1", 10, 10*time.Millisecond, func(delivery queue.Delivery, _ *queue.Configuration) {
+		got <- delivery.Payload()
+		_ = delivery.Ack()
+	})
+	queue.Bind(queue.Memory())
+
+	b := New(c)
+	if err := b.ToQueue("devices/{id}/telemetry", 1, "telemetry.{id}"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Publish("devices/d1/telemetry", 1, false, `{"temp":20}`); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-got:
+		if p != `{"temp":20}` {
+			t.Fatalf("unexpected payload %s", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("delivery timeout")
+	}
+}
+
+func TestToEvent(t *testing.T) {
+	s, c := connect(t)
+	defer s.Close()
+	defer c.Disconnect(0)
+
+	event.Bind(nil, event.Memory())
+	defer event.Stop()
+
+	got := make(chan *reading, 1)
+	_ = event.On("reading", func(ctx context.Context, r *reading) error {
+		got <- r
+		return nil
+	})
+	if err := event.Subscribe("device/d2"); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(c)
+	err := b.ToEvent("sensors/{id}", 1, "device/{id}", "reading", WithTransform(func(ctx *mqtt.Context) (interface{}, error) {
+		if ctx.Param("id") == "skip" {
+			return nil, ErrSkip
+		}
+		r := &reading{}
+		return r, ctx.Bind(r)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = c.Publish("sensors/d2", 1, false, `{"temp":21.5}`)
+	select {
+	case r := <-got:
+		if r.Temp != 21.5 {
+			t.Fatalf("unexpected reading %+v", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("handle timeout")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	failed := make(chan error, 2)
+	b := New(nil, MaxRetry(2), Backoff(time.Millisecond), OnFailure(func(ctx *mqtt.Context, err error) {
+		failed <- err
+	}))
+	b.publishQueue = func(name string, payload interface{}) error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return errors.New("redis timeout")
+		}
+		return nil
+	}
+
+	h := b.handler(&route{transform: raw}, func(ctx *mqtt.Context, v interface{}) error {
+		return b.publishQueue("q", v)
+	})
+
+	// QoS 1 重试直到成功
+	if err := h(&mqtt.Context{Context: context.Background(), Message: message{qos: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Fatalf("want 3 calls, got %d", calls)
+	}
+
+	// QoS 0 只尝试一次
+	atomic.StoreInt32(&calls, 0)
+	_ = h(&mqtt.Context{Context: context.Background(), Message: message{qos: 0}})
+	if calls != 1 {
+		t.Fatalf("want 1 call, got %d", calls)
+	}
+	select {
+	case err := <-failed:
+		if err.Error() != "redis timeout" {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatal("failure should be reported")
+	}
+}
+
+// message 测试用的mqtt消息
+type message struct {
+	qos byte
+}
+
+func (m message) Duplicate() bool   { return false }
+func (m message) Qos() byte         { return m.qos }
+func (m message) Retained() bool    { return false }
+func (m message) Topic() string     { return "devices/d1/telemetry" }
+func (m message) MessageID() uint16 { return 0 }
+func (m message) Payload() []byte   { return []byte("1") }
+func (m message) Ack()              {}
@@ -0,0 +1,276 @@
+package broker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// 控制报文类型
+const (
+	typeConnect     byte = 1
+	typeConnack     byte = 2
+	typePublish     byte = 3
+	typePuback      byte = 4
+	typePubrec      byte = 5
+	typePubrel      byte = 6
+	typePubcomp     byte = 7
+	typeSubscribe   byte = 8
+	typeSuback      byte = 9
+	typeUnsubscribe byte = 10
+	typeUnsuback    byte = 11
+	typePingreq     byte = 12
+	typePingresp    byte = 13
+	typeDisconnect  byte = 14
+)
+
+// CONNACK返回码
+const (
+	accepted            byte = 0
+	refusedProtocol     byte = 1
+	refusedIdentifier   byte = 2
+	refusedBadUserOrPwd byte = 4
+	refusedNotAuthorize byte = 5
+)
+
+var errMalformed = errors.New("malformed packet")
+
+// packet 控制报文
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+func readPacket(r *bufio.Reader) (*packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length += int(b&127) * multiplier
+		if b&128 == 0 {
+			break
+		}
+		if i == 3 {
+			return nil, errMalformed
+		}
+		multiplier *= 128
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return &packet{kind: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+func (p *packet) bytes() []byte {
+	buf := []byte{p.kind<<4 | p.flags}
+	length := len(p.body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 128
+		}
+		buf = append(buf, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(buf, p.body...)
+}
+
+// decoder 报文可变头与载荷的解码
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.b) < 1 {
+		d.err = errMalformed
+		return 0
+	}
+	v := d.b[0]
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *decoder) uint16() uint16 {
+	if d.err != nil || len(d.b) < 2 {
+		d.err = errMalformed
+		return 0
+	}
+	v := binary.BigEndian.Uint16(d.b)
+	d.b = d.b[2:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	n := int(d.uint16())
+	if d.err != nil || len(d.b) < n {
+		d.err = errMalformed
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+// connect CONNECT报文
+type connect struct {
+	protocol     string
+	level        byte
+	cleanSession bool
+	keepAlive    uint16
+	clientID     string
+	will         *message
+	username     string
+	password     string
+	hasUsername  bool
+	hasPassword  bool
+}
+
+func decodeConnect(p *packet) (*connect, error) {
+	d := &decoder{b: p.body}
+	c := &connect{}
+	c.protocol = d.string()
+	c.level = d.byte()
+	flags := d.byte()
+	c.keepAlive = d.uint16()
+	c.clientID = d.string()
+	c.cleanSession = flags&0x02 != 0
+
+	if flags&0x04 != 0 {
+		topic := d.string()
+		payload := d.bytes()
+		c.will = &message{topic: topic, payload: append([]byte{}, payload...), qos: (flags >> 3) & 0x03, retain: flags&0x20 != 0}
+	}
+	if flags&0x80 != 0 {
+		c.username = d.string()
+		c.hasUsername = true
+	}
+	if flags&0x40 != 0 {
+		c.password = string(d.bytes())
+		c.hasPassword = true
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if flags&0x01 != 0 {
+		return nil, errMalformed
+	}
+	return c, nil
+}
+
+// message 应用消息
+type message struct {
+	topic   string
+	payload []byte
+	qos     byte
+	retain  bool
+}
+
+// publish PUBLISH报文
+type publish struct {
+	message
+	id  uint16
+	dup bool
+}
+
+func decodePublish(p *packet) (*publish, error) {
+	d := &decoder{b: p.body}
+	pub := &publish{}
+	pub.dup = p.flags&0x08 != 0
+	pub.qos = (p.flags >> 1) & 0x03
+	pub.retain = p.flags&0x01 != 0
+	pub.topic = d.string()
+	if pub.qos > 0 {
+		pub.id = d.uint16()
+	}
+	if d.err != nil || pub.qos > 2 {
+		return nil, errMalformed
+	}
+	pub.payload = d.b
+	return pub, nil
+}
+
+func (pub *publish) packet() *packet {
+	flags := pub.qos << 1
+	if pub.dup {
+		flags |= 0x08
+	}
+	if pub.retain {
+		flags |= 0x01
+	}
+
+	body := appendString(make([]byte, 0, len(pub.topic)+len(pub.payload)+4), pub.topic)
+	if pub.qos > 0 {
+		body = appendUint16(body, pub.id)
+	}
+	return &packet{kind: typePublish, flags: flags, body: append(body, pub.payload...)}
+}
+
+// subscription 订阅的主题过滤器
+type subscription struct {
+	filter string
+	qos    byte
+}
+
+func decodeSubscribe(p *packet) (uint16, []subscription, error) {
+	d := &decoder{b: p.body}
+	id := d.uint16()
+	subs := make([]subscription, 0)
+	for d.err == nil && len(d.b) > 0 {
+		filter := d.string()
+		qos := d.byte()
+		subs = append(subs, subscription{filter: filter, qos: qos})
+	}
+	if d.err != nil || len(subs) == 0 {
+		return 0, nil, errMalformed
+	}
+	return id, subs, nil
+}
+
+func decodeUnsubscribe(p *packet) (uint16, []string, error) {
+	d := &decoder{b: p.body}
+	id := d.uint16()
+	filters := make([]string, 0)
+	for d.err == nil && len(d.b) > 0 {
+		filters = append(filters, d.string())
+	}
+	if d.err != nil || len(filters) == 0 {
+		return 0, nil, errMalformed
+	}
+	return id, filters, nil
+}
+
+func ack(kind byte, id uint16) *packet {
+	flags := byte(0)
+	if kind == typePubrel {
+		flags = 0x02
+	}
+	return &packet{kind: kind, flags: flags, body: appendUint16(nil, id)}
+}
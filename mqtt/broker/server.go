@@ -0,0 +1,518 @@
+package broker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
+	"go.uber.org/zap"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Server 进程内mqtt 3.1.1 broker，用于本地开发与测试
+// 支持QoS 0/1（QoS 2降级为1投递）、保留消息、遗嘱与认证鉴权钩子，不持久化会话
+type Server struct {
+	addr         string
+	authenticate func(clientID, username, password string) bool
+	authorize    func(clientID, topic string, write bool) bool
+	logger       *log.ZapLogger
+	listener     net.Listener
+	m            sync.RWMutex
+	sessions     map[string]*session
+	retained     map[string]*message
+	wg           sync.WaitGroup
+	seq          uint64
+	closed       int32
+}
+
+// Option 配置函数
+type Option func(*Server)
+
+// Addr 监听地址，默认127.0.0.1:1883，端口为0时随机分配
+func Addr(addr string) Option {
+	return func(s *Server) {
+		s.addr = addr
+	}
+}
+
+// Authenticate 连接认证，返回false时拒绝连接
+func Authenticate(f func(clientID, username, password string) bool) Option {
+	return func(s *Server) {
+		s.authenticate = f
+	}
+}
+
+// Authorize 发布与订阅鉴权，write为true时表示发布，返回false时丢弃发布或拒绝订阅
+func Authorize(f func(clientID, topic string, write bool) bool) Option {
+	return func(s *Server) {
+		s.authorize = f
+	}
+}
+
+// New 构造函数
+func New(options ...Option) *Server {
+	s := &Server{
+		addr:     "127.0.0.1:1883",
+		logger:   log.Zap.Mark("mqttBroker"),
+		sessions: make(map[string]*session),
+		retained: make(map[string]*message),
+	}
+	for _, op := range options {
+		op(s)
+	}
+	return s
+}
+
+// Start 开始监听，监听成功后返回
+func (s *Server) Start() error {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.listener = l
+	s.logger.Info(log.Message("listening on", l.Addr().String()))
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				if atomic.LoadInt32(&s.closed) == 0 {
+					s.logger.Error(log.Message("accept error:", err))
+				}
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// Addr 实际监听地址
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// URL 供mqtt.Broker使用的地址
+func (s *Server) URL() string {
+	return "tcp://" + s.Addr()
+}
+
+// Close 关闭监听与所有连接
+func (s *Server) Close() error {
+	if !atomic.CompareAndSwapInt32(&s.closed, 0, 1) {
+		return errors.New("server has closed")
+	}
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+
+	s.m.RLock()
+	for _, ss := range s.sessions {
+		_ = ss.conn.Close()
+	}
+	s.m.RUnlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// Publish 以服务端身份发布消息
+func (s *Server) Publish(topic string, qos byte, retain bool, payload []byte) error {
+	if !validTopic(topic) {
+		return fmt.Errorf("invalid topic %s", topic)
+	}
+	s.route(&message{topic: topic, payload: payload, qos: qos, retain: retain})
+	return nil
+}
+
+// Clients 当前连接的客户端
+func (s *Server) Clients() []string {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	ids := make([]string, 0, len(s.sessions))
+	for id := range s.sessions {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (s *Server) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	p, err := readPacket(r)
+	if err != nil || p.kind != typeConnect {
+		_ = conn.Close()
+		return
+	}
+
+	c, err := decodeConnect(p)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	ss, code := s.accept(conn, c)
+	_, _ = conn.Write((&packet{kind: typeConnack, body: []byte{0, code}}).bytes())
+	if code != accepted {
+		_ = conn.Close()
+		return
+	}
+
+	ss.run(r)
+}
+
+// accept 校验CONNECT并登记会话，同一clientID的旧连接被断开
+func (s *Server) accept(conn net.Conn, c *connect) (*session, byte) {
+	if !(c.protocol == "MQTT" && c.level == 4) && !(c.protocol == "MQIsdp" && c.level == 3) {
+		return nil, refusedProtocol
+	}
+	if c.clientID == "" {
+		if !c.cleanSession {
+			return nil, refusedIdentifier
+		}
+		c.clientID = fmt.Sprintf("auto-%d", atomic.AddUint64(&s.seq, 1))
+	}
+	if s.authenticate != nil && !s.authenticate(c.clientID, c.username, c.password) {
+		return nil, refusedBadUserOrPwd
+	}
+	if c.will != nil && !validTopic(c.will.topic) {
+		return nil, refusedNotAuthorize
+	}
+
+	ss := newSession(s, conn, c)
+
+	s.m.Lock()
+	old := s.sessions[c.clientID]
+	s.sessions[c.clientID] = ss
+	s.m.Unlock()
+
+	if old != nil {
+		s.logger.Info(log.Message("client", c.clientID, "takes over an existing session"))
+		_ = old.conn.Close()
+	}
+	return ss, accepted
+}
+
+func (s *Server) remove(ss *session) {
+	s.m.Lock()
+	if s.sessions[ss.clientID] == ss {
+		delete(s.sessions, ss.clientID)
+	}
+	s.m.Unlock()
+}
+
+// route 处理保留消息并投递到所有匹配的订阅
+func (s *Server) route(msg *message) {
+	s.m.Lock()
+	if msg.retain {
+		if len(msg.payload) == 0 {
+			delete(s.retained, msg.topic)
+		} else {
+			s.retained[msg.topic] = msg
+		}
+	}
+	sessions := make([]*session, 0, len(s.sessions))
+	for _, ss := range s.sessions {
+		sessions = append(sessions, ss)
+	}
+	s.m.Unlock()
+
+	for _, ss := range sessions {
+		if qos, ok := ss.matches(msg.topic); ok {
+			ss.deliver(msg, min(qos, msg.qos), false)
+		}
+	}
+}
+
+// retain 返回与过滤器匹配的保留消息
+func (s *Server) retain(filter string) []*message {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	messages := make([]*message, 0)
+	for topic, msg := range s.retained {
+		if match(filter, topic) {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// session 客户端会话
+type session struct {
+	server    *Server
+	conn      net.Conn
+	clientID  string
+	will      *message
+	keepAlive time.Duration
+	logger    *log.ZapLogger
+	m         sync.Mutex
+	subs      map[string]byte
+	nextID    uint16
+	received  map[uint16]bool
+	out       chan *packet
+	done      chan struct{}
+}
+
+func newSession(s *Server, conn net.Conn, c *connect) *session {
+	return &session{
+		server:    s,
+		conn:      conn,
+		clientID:  c.clientID,
+		will:      c.will,
+		keepAlive: time.Duration(c.keepAlive) * time.Second,
+		logger:    &log.ZapLogger{Logger: s.logger.With(zap.String("client", c.clientID))},
+		subs:      make(map[string]byte),
+		received:  make(map[uint16]bool),
+		out:       make(chan *packet, 256),
+		done:      make(chan struct{}),
+	}
+}
+
+func (ss *session) run(r *bufio.Reader) {
+	go ss.write()
+
+	graceful := false
+	for {
+		if ss.keepAlive > 0 {
+			_ = ss.conn.SetReadDeadline(time.Now().Add(ss.keepAlive * 3 / 2))
+		} else {
+			_ = ss.conn.SetReadDeadline(time.Time{})
+		}
+
+		p, err := readPacket(r)
+		if err != nil {
+			break
+		}
+		if p.kind == typeDisconnect {
+			graceful = true
+			break
+		}
+		if err := ss.handle(p); err != nil {
+			ss.logger.Warn(log.Message("close connection:", err))
+			break
+		}
+	}
+
+	close(ss.done)
+	_ = ss.conn.Close()
+	ss.server.remove(ss)
+
+	if !graceful && ss.will != nil {
+		ss.server.route(ss.will)
+	}
+}
+
+func (ss *session) write() {
+	w := bufio.NewWriter(ss.conn)
+	for {
+		select {
+		case <-ss.done:
+			return
+		case p := <-ss.out:
+			if _, err := w.Write(p.bytes()); err != nil {
+				_ = ss.conn.Close()
+				return
+			}
+			// 批量写出已排队的报文
+			for n := len(ss.out); n > 0; n-- {
+				_, _ = w.Write((<-ss.out).bytes())
+			}
+			if err := w.Flush(); err != nil {
+				_ = ss.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (ss *session) send(p *packet) {
+	select {
+	case ss.out <- p:
+	case <-ss.done:
+	}
+}
+
+func (ss *session) handle(p *packet) error {
+	switch p.kind {
+	case typePublish:
+		pub, err := decodePublish(p)
+		if err != nil {
+			return err
+		}
+		if !validTopic(pub.topic) {
+			return fmt.Errorf("invalid topic %s", pub.topic)
+		}
+
+		allowed := ss.server.authorize == nil || ss.server.authorize(ss.clientID, pub.topic, true)
+		if !allowed {
+			ss.logger.Warn(log.Message("publish to", pub.topic, "is not authorized"))
+		}
+
+		switch pub.qos {
+		case 0:
+			if allowed {
+				ss.server.route(&pub.message)
+			}
+		case 1:
+			if allowed {
+				ss.server.route(&pub.message)
+			}
+			ss.send(ack(typePuback, pub.id))
+		case 2:
+			ss.m.Lock()
+			first := !ss.received[pub.id]
+			ss.received[pub.id] = true
+			ss.m.Unlock()
+			if first && allowed {
+				ss.server.route(&pub.message)
+			}
+			ss.send(ack(typePubrec, pub.id))
+		}
+	case typePubrel:
+		id := (&decoder{b: p.body}).uint16()
+		ss.m.Lock()
+		delete(ss.received, id)
+		ss.m.Unlock()
+		ss.send(ack(typePubcomp, id))
+	case typePuback, typePubrec, typePubcomp:
+		// 服务端只以QoS 0/1投递，PUBACK无需处理
+	case typeSubscribe:
+		id, subs, err := decodeSubscribe(p)
+		if err != nil {
+			return err
+		}
+
+		codes := appendUint16(nil, id)
+		granted := make([]subscription, 0, len(subs))
+		for _, sub := range subs {
+			if !validFilter(sub.filter) || sub.qos > 2 || (ss.server.authorize != nil && !ss.server.authorize(ss.clientID, sub.filter, false)) {
+				codes = append(codes, 0x80)
+				continue
+			}
+			qos := min(sub.qos, 1)
+			ss.m.Lock()
+			ss.subs[sub.filter] = qos
+			ss.m.Unlock()
+			codes = append(codes, qos)
+			granted = append(granted, subscription{filter: sub.filter, qos: qos})
+		}
+		ss.send(&packet{kind: typeSuback, body: codes})
+
+		for _, sub := range granted {
+			for _, msg := range ss.server.retain(sub.filter) {
+				ss.deliver(msg, min(sub.qos, msg.qos), true)
+			}
+		}
+	case typeUnsubscribe:
+		id, filters, err := decodeUnsubscribe(p)
+		if err != nil {
+			return err
+		}
+		ss.m.Lock()
+		for _, filter := range filters {
+			delete(ss.subs, filter)
+		}
+		ss.m.Unlock()
+		ss.send(ack(typeUnsuback, id))
+	case typePingreq:
+		ss.send(&packet{kind: typePingresp})
+	default:
+		return fmt.Errorf("unexpected packet type %d", p.kind)
+	}
+	return nil
+}
+
+// matches 返回匹配主题的订阅中的最大QoS
+func (ss *session) matches(topic string) (byte, bool) {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+
+	var qos byte
+	ok := false
+	for filter, q := range ss.subs {
+		if match(filter, topic) {
+			ok = true
+			if q > qos {
+				qos = q
+			}
+		}
+	}
+	return qos, ok
+}
+
+func (ss *session) deliver(msg *message, qos byte, retain bool) {
+	pub := &publish{message: message{topic: msg.topic, payload: msg.payload, qos: qos, retain: retain}}
+	if qos > 0 {
+		ss.m.Lock()
+		ss.nextID++
+		if ss.nextID == 0 {
+			ss.nextID = 1
+		}
+		pub.id = ss.nextID
+		ss.m.Unlock()
+	}
+	ss.send(pub.packet())
+}
+
+func min(a, b byte) byte {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// match 判断主题是否匹配过滤器，以$开头的主题不匹配首层通配符
+func match(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	fs := strings.Split(filter, "/")
+	ts := strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) {
+			return false
+		}
+		if f != "+" && f != ts[i] {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
+
+func validTopic(topic string) bool {
+	return topic != "" && !strings.ContainsAny(topic, "+#\x00")
+}
+
+func validFilter(filter string) bool {
+	if filter == "" || strings.Contains(filter, "\x00") {
+		return false
+	}
+	levels := strings.Split(filter, "/")
+	for i, l := range levels {
+		if strings.Contains(l, "#") && (l != "#" || i != len(levels)-1) {
+			return false
+		}
+		if strings.Contains(l, "+") && l != "+" {
+			return false
+		}
+	}
+	return true
+}
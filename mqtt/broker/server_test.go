@@ -0,0 +1,155 @@
+package broker
+
+import (
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"testing"
+	"time"
+)
+
+func start(t *testing.T, options ...Option) *Server {
+	s := New(append([]Option{Addr("127.0.0.1:0")}, options...)...)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func dial(t *testing.T, s *Server, id string, options ...func(*MQTT.ClientOptions)) MQTT.Client {
+	opts := MQTT.NewClientOptions().AddBroker(s.URL()).SetClientID(id).SetAutoReconnect(false)
+	for _, op := range options {
+		op(opts)
+	}
+	c := MQTT.NewClient(opts)
+	if token := c.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+	return c
+}
+
+func receive(t *testing.T, ch <-chan MQTT.Message) MQTT.Message {
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("receive timeout")
+		return nil
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	s := start(t)
+	defer s.Close()
+
+	sub := dial(t, s, "sub")
+	defer sub.Disconnect(0)
+	pub := dial(t, s, "pub")
+	defer pub.Disconnect(0)
+
+	ch := make(chan MQTT.Message, 10)
+	sub.Subscribe("devices/+/telemetry", 1, func(_ MQTT.Client, msg MQTT.Message) {
+		ch <- msg
+	}).Wait()
+
+	pub.Publish("devices/d1/telemetry", 1, false, "21.5").Wait()
+	msg := receive(t, ch)
+	if msg.Topic() != "devices/d1/telemetry" || string(msg.Payload()) != "21.5" || msg.Qos() != 1 {
+		t.Fatalf("unexpected message %s %s %d", msg.Topic(), msg.Payload(), msg.Qos())
+	}
+
+	pub.Publish("devices/d1/status", 0, false, "online").Wait()
+	select {
+	case msg := <-ch:
+		t.Fatalf("unexpected message on %s", msg.Topic())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRetainedAndWill(t *testing.T) {
+	s := start(t)
+	defer s.Close()
+
+	pub := dial(t, s, "pub")
+	defer pub.Disconnect(0)
+	pub.Publish("config/d1", 1, true, "v1").Wait()
+
+	dead := dial(t, s, "dead", func(o *MQTT.ClientOptions) {
+		o.SetWill("status/dead", "offline", 1, false)
+	})
+
+	sub := dial(t, s, "sub")
+	defer sub.Disconnect(0)
+	ch := make(chan MQTT.Message, 10)
+	sub.Subscribe("config/#", 1, func(_ MQTT.Client, msg MQTT.Message) { ch <- msg }).Wait()
+	sub.Subscribe("status/+", 1, func(_ MQTT.Client, msg MQTT.Message) { ch <- msg }).Wait()
+
+	if msg := receive(t, ch); !msg.Retained() || string(msg.Payload()) != "v1" {
+		t.Fatalf("want retained v1, got %s", msg.Payload())
+	}
+
+	// 非正常断开时发布遗嘱
+	s.m.RLock()
+	conn := s.sessions["dead"].conn
+	s.m.RUnlock()
+	_ = conn.Close()
+	_ = dead
+
+	if msg := receive(t, ch); msg.Topic() != "status/dead" || string(msg.Payload()) != "offline" {
+		t.Fatalf("want will message, got %s %s", msg.Topic(), msg.Payload())
+	}
+}
+
+func TestAuth(t *testing.T) {
+	s := start(t,
+		Authenticate(func(clientID, username, password string) bool {
+			return username == "admin" && password == "secret"
+		}),
+		Authorize(func(clientID, topic string, write bool) bool {
+			return topic != "private"
+		}),
+	)
+	defer s.Close()
+
+	c := MQTT.NewClient(MQTT.NewClientOptions().AddBroker(s.URL()).SetClientID("bad").SetUsername("admin").SetPassword("wrong"))
+	if token := c.Connect(); token.Wait() && token.Error() == nil {
+		t.Fatal("connect with wrong password should fail")
+	}
+
+	ok := dial(t, s, "ok", func(o *MQTT.ClientOptions) {
+		o.SetUsername("admin")
+		o.SetPassword("secret")
+	})
+	defer ok.Disconnect(0)
+
+	token := ok.Subscribe("private", 1, func(MQTT.Client, MQTT.Message) {})
+	token.Wait()
+	if token.(*MQTT.SubscribeToken).Result()["private"] != 0x80 {
+		t.Fatal("subscribe private should be refused")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/#", "a", true},
+		{"a/#", "a/b/c", true},
+		{"#", "$SYS/uptime", false},
+		{"+/+", "a", false},
+	}
+	for _, c := range cases {
+		if got := match(c.filter, c.topic); got != c.want {
+			t.Errorf("match(%s, %s) = %v", c.filter, c.topic, got)
+		}
+	}
+}
+
+func TestClose_NotStarted(t *testing.T) {
+	if err := New().Close(); err != nil {
+		t.Fatal(err)
+	}
+}
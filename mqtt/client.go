@@ -0,0 +1,161 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/tracing"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"go.uber.org/zap"
+	"sync"
+)
+
+// Client mqtt客户端，连接建立或重连后自动重新订阅已注册的路由
+type Client struct {
+	MQTT.Client
+	m          sync.RWMutex
+	routes     map[string]*route
+	middleware []Middleware
+	logger     *log.ZapLogger
+}
+
+// New 构造函数，连接失败时返回错误
+func New(options ...Option) (*Client, error) {
+	opts := MQTT.NewClientOptions()
+	for _, op := range options {
+		op(opts)
+	}
+
+	c := newClient()
+
+	onConnect := opts.OnConnect
+	opts.SetOnConnectHandler(func(client MQTT.Client) {
+		c.resubscribe()
+		if onConnect != nil {
+			onConnect(client)
+		}
+	})
+
+	c.Client = MQTT.NewClient(opts)
+	if token := c.Client.Connect(); token.Wait() && token.Error() != nil {
+		return nil, token.Error()
+	}
+	return c, nil
+}
+
+func newClient() *Client {
+	return &Client{routes: make(map[string]*route), logger: log.Zap.Mark("mqtt")}
+}
+
+// Use 添加全局中间件，先添加的在外层
+func (c *Client) Use(middleware ...Middleware) {
+	c.m.Lock()
+	c.middleware = append(c.middleware, middleware...)
+	c.m.Unlock()
+}
+
+// Handle 注册路由并订阅，pattern支持+、#以及{name}形式的参数
+func (c *Client) Handle(pattern string, qos byte, handler HandlerFunc, middleware ...Middleware) error {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
+	r, err := newRoute(pattern, qos, handler)
+	if err != nil {
+		return err
+	}
+
+	c.m.Lock()
+	if exist, ok := c.routes[r.topic]; ok {
+		c.m.Unlock()
+		return fmt.Errorf("topic %s of %s has been handled by %s", r.topic, pattern, exist.pattern)
+	}
+	c.routes[r.topic] = r
+	c.m.Unlock()
+
+	if c.Client != nil && c.IsConnectionOpen() {
+		return c.subscribe(r)
+	}
+	return nil
+}
+
+// Remove 取消路由并退订
+func (c *Client) Remove(pattern string) error {
+	r, err := newRoute(pattern, 0, nil)
+	if err != nil {
+		return err
+	}
+
+	c.m.Lock()
+	delete(c.routes, r.topic)
+	c.m.Unlock()
+
+	token := c.Unsubscribe(r.topic)
+	token.Wait()
+	return token.Error()
+}
+
+// Publish 发布消息并等待完成
+func (c *Client) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	token := c.Client.Publish(topic, qos, retained, payload)
+	token.Wait()
+	return token.Error()
+}
+
+// PublishContext 发布消息并等待完成，ctx中有Span时创建发布Span
+func (c *Client) PublishContext(ctx context.Context, topic string, qos byte, retained bool, payload interface{}) error {
+	span, _ := tracing.StartChild(ctx, "mqtt publish",
+		ext.SpanKindProducer,
+		opentracing.Tag{Key: "mqtt.topic", Value: topic},
+		opentracing.Tag{Key: "mqtt.qos", Value: qos},
+	)
+	err := c.Publish(topic, qos, retained, payload)
+	tracing.Finish(span, err)
+	return err
+}
+
+func (c *Client) subscribe(r *route) error {
+	token := c.Subscribe(r.topic, r.qos, func(_ MQTT.Client, msg MQTT.Message) {
+		c.dispatch(r, msg)
+	})
+	token.Wait()
+	if err := token.Error(); err != nil {
+		c.logger.Error(log.Message("subscribe", r.topic, "error:", err))
+		return err
+	}
+	return nil
+}
+
+func (c *Client) resubscribe() {
+	c.m.RLock()
+	routes := make([]*route, 0, len(c.routes))
+	for _, r := range c.routes {
+		routes = append(routes, r)
+	}
+	c.m.RUnlock()
+
+	for _, r := range routes {
+		_ = c.subscribe(r)
+	}
+}
+
+func (c *Client) dispatch(r *route, msg MQTT.Message) {
+	params, ok := r.params(msg.Topic())
+	if !ok {
+		return
+	}
+
+	c.m.RLock()
+	handler := r.handler
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		handler = c.middleware[i](handler)
+	}
+	c.m.RUnlock()
+
+	ctx := &Context{Context: context.Background(), Client: c, Message: msg, Pattern: r.pattern, Params: params}
+	if err := handler(ctx); err != nil {
+		c.logger.Error(log.Message("handle error:", err), zap.String("topic", msg.Topic()), zap.String("pattern", r.pattern))
+	}
+}
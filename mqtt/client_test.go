@@ -0,0 +1,43 @@
+package mqtt
+
+import (
+	"github.com/Jarnpher553/gemini/mqtt/broker"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	s := broker.New(broker.Addr("127.0.0.1:0"))
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	c, err := New(Broker(s.URL()), ClientID("client_test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Disconnect(0)
+
+	got := make(chan string, 1)
+	err = c.Handle("devices/{id}/telemetry", 1, JSON(func(ctx *Context, v *telemetry) error {
+		got <- ctx.Param("id")
+		return nil
+	}), Recovery())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Publish("devices/d2/telemetry", 1, false, `{"temp":20}`); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case id := <-got:
+		if id != "d2" {
+			t.Fatalf("want d2, got %s", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("receive timeout")
+	}
+}
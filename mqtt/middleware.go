@@ -0,0 +1,92 @@
+package mqtt
+
+import (
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/rcrowley/go-metrics"
+	"go.uber.org/zap"
+	"runtime/debug"
+	"time"
+)
+
+// Logging 日志中间件，记录主题与耗时
+func Logging() Middleware {
+	logger := log.Zap.Mark("mqtt")
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			begin := time.Now()
+			err := next(c)
+
+			fields := []zap.Field{
+				zap.String("topic", c.Topic()),
+				zap.String("pattern", c.Pattern),
+				zap.Uint8("qos", c.Message.Qos()),
+				zap.String("cost", time.Since(begin).String()),
+			}
+			if err != nil {
+				fields = append(fields, zap.String("error", err.Error()))
+			}
+			logger.Info("message", fields...)
+			return err
+		}
+	}
+}
+
+// Recovery 恢复处理函数中的panic并转换为错误
+func Recovery() Middleware {
+	logger := log.Zap.Mark("mqtt")
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) (e error) {
+			defer func() {
+				if err := recover(); err != nil {
+					e = fmt.Errorf("%v", err)
+					logger.Error(log.Messagef("err info: %s, track: %s", e, string(debug.Stack())))
+				}
+			}()
+			return next(c)
+		}
+	}
+}
+
+// Tracing 跟踪中间件，为每条消息创建span并写入上下文
+func Tracing() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			span := opentracing.StartSpan("mqtt "+c.Pattern,
+				ext.SpanKindConsumer,
+				opentracing.Tag{Key: "mqtt.topic", Value: c.Topic()},
+				opentracing.Tag{Key: "mqtt.qos", Value: c.Message.Qos()},
+			)
+			defer span.Finish()
+
+			c.Context = opentracing.ContextWithSpan(c.Context, span)
+			err := next(c)
+			if err != nil {
+				ext.Error.Set(span, true)
+				span.LogKV("error", err.Error())
+			}
+			return err
+		}
+	}
+}
+
+// Metrics 指标中间件，按路由统计耗时与失败数，registry为nil时使用metrics.DefaultRegistry
+func Metrics(registry metrics.Registry) Middleware {
+	if registry == nil {
+		registry = metrics.DefaultRegistry
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			begin := time.Now()
+			err := next(c)
+
+			metrics.GetOrRegisterTimer("mqtt."+c.Pattern+".duration", registry).UpdateSince(begin)
+			if err != nil {
+				metrics.GetOrRegisterCounter("mqtt."+c.Pattern+".failed", registry).Inc(1)
+			}
+			return err
+		}
+	}
+}
@@ -225,15 +225,16 @@ func LogMode(a bool) Option {
 	}
 }
 
-func Bind(options ...Option) {
-	opts := MQTT.NewClientOptions()
+// Default Bind创建的默认客户端
+var Default *Client
 
-	for _, op := range options {
-		op(opts)
+// Bind 创建默认客户端，连接失败时退出，需要处理错误时使用New
+func Bind(options ...Option) {
+	c, err := New(options...)
+	if err != nil {
+		log.Zap.Mark("mqtt").Fatal(log.Message(err))
 	}
 
-	MqttClient = MQTT.NewClient(opts)
-	if token := MqttClient.Connect(); token.Wait() && token.Error() != nil {
-		log.Zap.Mark("mqtt").Fatal(log.Message(token.Error()))
-	}
+	Default = c
+	MqttClient = c.Client
 }
@@ -0,0 +1,137 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"reflect"
+	"strings"
+)
+
+// HandlerFunc 消息处理函数
+type HandlerFunc func(*Context) error
+
+// Middleware 处理函数中间件
+type Middleware func(HandlerFunc) HandlerFunc
+
+// Context 消息上下文
+type Context struct {
+	context.Context
+	Client  *Client
+	Message MQTT.Message
+	Pattern string
+	Params  map[string]string
+}
+
+// Topic 消息主题
+func (c *Context) Topic() string {
+	return c.Message.Topic()
+}
+
+// Payload 消息内容
+func (c *Context) Payload() []byte {
+	return c.Message.Payload()
+}
+
+// Param 获取路由参数，#通配的部分通过Param("#")获取
+func (c *Context) Param(name string) string {
+	return c.Params[name]
+}
+
+// Bind 将JSON消息内容解码到v
+func (c *Context) Bind(v interface{}) error {
+	return json.Unmarshal(c.Message.Payload(), v)
+}
+
+// Publish 通过当前客户端发布消息，使用Tracing中间件时记录发布Span
+func (c *Context) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	return c.Client.PublishContext(c.Context, topic, qos, retained, payload)
+}
+
+// route 路由，pattern形如devices/{id}/telemetry，{name}等价于+并提取为参数
+type route struct {
+	pattern  string
+	topic    string
+	segments []string
+	qos      byte
+	handler  HandlerFunc
+}
+
+func newRoute(pattern string, qos byte, handler HandlerFunc) (*route, error) {
+	segments := strings.Split(pattern, "/")
+	topics := make([]string, len(segments))
+	for i, s := range segments {
+		switch {
+		case s == "+":
+			topics[i] = s
+		case s == "#":
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("# must be the last level of %s", pattern)
+			}
+			topics[i] = s
+		case strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}"):
+			if len(s) == 2 {
+				return nil, fmt.Errorf("empty parameter name in %s", pattern)
+			}
+			topics[i] = "+"
+		case strings.ContainsAny(s, "+#{}"):
+			return nil, fmt.Errorf("invalid level %s in %s", s, pattern)
+		default:
+			topics[i] = s
+		}
+	}
+
+	return &route{pattern: pattern, topic: strings.Join(topics, "/"), segments: segments, qos: qos, handler: handler}, nil
+}
+
+// params 按路由提取主题中的参数，主题不匹配时返回false
+func (r *route) params(topic string) (map[string]string, bool) {
+	levels := strings.Split(topic, "/")
+	params := make(map[string]string)
+
+	for i, s := range r.segments {
+		if s == "#" {
+			params["#"] = strings.Join(levels[i:], "/")
+			return params, true
+		}
+		if i >= len(levels) {
+			return nil, false
+		}
+		switch {
+		case s == "+":
+		case strings.HasPrefix(s, "{"):
+			params[s[1:len(s)-1]] = levels[i]
+		case s != levels[i]:
+			return nil, false
+		}
+	}
+	return params, len(levels) == len(r.segments)
+}
+
+var (
+	contextType = reflect.TypeOf(&Context{})
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// JSON 将 func(*Context, *T) error 转换为HandlerFunc，消息内容按JSON解码为T
+func JSON(handler interface{}) HandlerFunc {
+	fn := reflect.ValueOf(handler)
+	t := fn.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 1 || t.In(0) != contextType || t.Out(0) != errorType || t.In(1).Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("handler must be func(*mqtt.Context, *T) error, got %s", t))
+	}
+
+	in := t.In(1).Elem()
+	return func(c *Context) error {
+		v := reflect.New(in)
+		if err := c.Bind(v.Interface()); err != nil {
+			return err
+		}
+		out := fn.Call([]reflect.Value{reflect.ValueOf(c), v})
+		if err, ok := out[0].Interface().(error); ok {
+			return err
+		}
+		return nil
+	}
+}
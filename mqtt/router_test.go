@@ -0,0 +1,94 @@
+package mqtt
+
+import (
+	"errors"
+	"testing"
+)
+
+type message struct {
+	topic   string
+	payload []byte
+}
+
+func (m *message) Duplicate() bool   { return false }
+func (m *message) Qos() byte         { return 1 }
+func (m *message) Retained() bool    { return false }
+func (m *message) Topic() string     { return m.topic }
+func (m *message) MessageID() uint16 { return 1 }
+func (m *message) Payload() []byte   { return m.payload }
+func (m *message) Ack()              {}
+
+func TestRoute(t *testing.T) {
+	r, err := newRoute("devices/{id}/telemetry/#", 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.topic != "devices/+/telemetry/#" {
+		t.Fatalf("unexpected topic %s", r.topic)
+	}
+
+	params, ok := r.params("devices/d1/telemetry/temp/room")
+	if !ok || params["id"] != "d1" || params["#"] != "temp/room" {
+		t.Fatalf("unexpected params %v", params)
+	}
+	if _, ok := r.params("devices/d1/status"); ok {
+		t.Fatal("topic should not match")
+	}
+
+	for _, pattern := range []string{"a/#/b", "a/{}/b", "a/x+/b"} {
+		if _, err := newRoute(pattern, 0, nil); err == nil {
+			t.Fatalf("pattern %s should be invalid", pattern)
+		}
+	}
+}
+
+type telemetry struct {
+	Temp float64 `json:"temp"`
+}
+
+func TestDispatch(t *testing.T) {
+	c := newClient()
+
+	var order []string
+	c.Use(Recovery(), func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) error {
+			order = append(order, "global")
+			return next(ctx)
+		}
+	})
+
+	var got *telemetry
+	var id string
+	err := c.Handle("devices/{id}/telemetry", 1, JSON(func(ctx *Context, v *telemetry) error {
+		order = append(order, "handler")
+		got = v
+		id = ctx.Param("id")
+		return nil
+	}), func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) error {
+			order = append(order, "route")
+			return next(ctx)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Handle("devices/+/telemetry", 0, nil); err == nil {
+		t.Fatal("duplicate topic should return error")
+	}
+
+	r := c.routes["devices/+/telemetry"]
+	c.dispatch(r, &message{topic: "devices/d1/telemetry", payload: []byte(`{"temp":21.5}`)})
+
+	if got == nil || got.Temp != 21.5 || id != "d1" {
+		t.Fatalf("unexpected telemetry %+v of %s", got, id)
+	}
+	if len(order) != 3 || order[0] != "global" || order[1] != "route" || order[2] != "handler" {
+		t.Fatalf("unexpected middleware order %v", order)
+	}
+
+	_ = c.Handle("panic", 0, func(ctx *Context) error {
+		panic(errors.New("boom"))
+	})
+	c.dispatch(c.routes["panic"], &message{topic: "panic"})
+}
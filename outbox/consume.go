@@ -0,0 +1,141 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/mqtt"
+	"github.com/Jarnpher553/gemini/queue"
+	"github.com/Jarnpher553/gemini/redis"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"go.uber.org/zap"
+	"time"
+)
+
+// envelopeVersion Envelope的版本，消费方以此识别发件箱投递的消息
+const envelopeVersion = 1
+
+// Envelope 投递到queue与mqtt的消息格式，带有消息的Key供消费方去重
+// mqtt 3.1.1没有用户属性，同样使用此格式，JSON为{"outbox":1,"key":"ob_xxx","payload":"base64负载"}
+// 消费方通过QueueDedup、MQTTDedup或Open解出原负载
+type Envelope struct {
+	Version int    `json:"outbox"`
+	Key     string `json:"key"`
+	Payload []byte `json:"payload"`
+}
+
+// seal 将消息封装为Envelope
+func seal(m *Message) []byte {
+	b, _ := json.Marshal(&Envelope{Version: envelopeVersion, Key: m.Key, Payload: m.Payload})
+	return b
+}
+
+// Open 解析Envelope，data不是发件箱投递的消息时返回false
+func Open(data []byte) (*Envelope, bool) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Version != envelopeVersion || env.Key == "" {
+		return nil, false
+	}
+	return &env, true
+}
+
+func seenKey(key string) string {
+	return "outbox:seen:" + key
+}
+
+// Seen 消费方去重，key已处理过时返回true，处理成功后需调用Mark
+// 同一消息并发投递时两方都可能处理，处理逻辑仍需幂等
+func Seen(rd *redis.RdClient, key string) (bool, error) {
+	n, err := rd.Client.Exists(seenKey(key)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Mark 标记key已处理，ttl需大于消息可能重复投递的时间窗口
+func Mark(rd *redis.RdClient, key string, ttl time.Duration) error {
+	return rd.Client.Set(seenKey(key), 1, ttl).Err()
+}
+
+// dedupDelivery 解出原负载的投递，Ack时标记已处理
+type dedupDelivery struct {
+	queue.Delivery
+	rd      *redis.RdClient
+	key     string
+	payload string
+	ttl     time.Duration
+}
+
+func (d *dedupDelivery) Payload() string {
+	return d.payload
+}
+
+func (d *dedupDelivery) Ack() error {
+	if err := Mark(d.rd, d.key, d.ttl); err != nil {
+		box.logger.Error(log.Message("mark error:", err), zap.String("key", d.key))
+	}
+	return d.Delivery.Ack()
+}
+
+// Context 保留queue的链路信息
+func (d *dedupDelivery) Context() context.Context {
+	return queue.DeliveryContext(d.Delivery)
+}
+
+// QueueDedup 包装queue的消费函数，解出原负载并按Key去重，f调用Ack即视为处理成功
+// 已处理过的消息直接确认，redis出错时拒绝消息，可通过queue.Return重新投递
+func QueueDedup(rd *redis.RdClient, ttl time.Duration, f queue.Func) queue.Func {
+	return func(d queue.Delivery, c *queue.Configuration) {
+		env, ok := Open([]byte(d.Payload()))
+		if !ok {
+			f(d, c)
+			return
+		}
+
+		seen, err := Seen(rd, env.Key)
+		if err != nil {
+			box.logger.Error(log.Message("seen error:", err), zap.String("key", env.Key))
+			_ = d.Reject()
+			return
+		}
+		if seen {
+			_ = d.Ack()
+			return
+		}
+		f(&dedupDelivery{Delivery: d, rd: rd, key: env.Key, payload: string(env.Payload), ttl: ttl}, c)
+	}
+}
+
+// envelopeMessage 解出原负载的mqtt消息
+type envelopeMessage struct {
+	paho.Message
+	payload []byte
+}
+
+func (m *envelopeMessage) Payload() []byte {
+	return m.payload
+}
+
+// MQTTDedup mqtt中间件，解出原负载并按Key去重，处理函数返回nil后标记已处理
+func MQTTDedup(rd *redis.RdClient, ttl time.Duration) mqtt.Middleware {
+	return func(next mqtt.HandlerFunc) mqtt.HandlerFunc {
+		return func(c *mqtt.Context) error {
+			env, ok := Open(c.Payload())
+			if !ok {
+				return next(c)
+			}
+
+			seen, err := Seen(rd, env.Key)
+			if err != nil || seen {
+				return err
+			}
+
+			c.Message = &envelopeMessage{Message: c.Message, payload: env.Payload}
+			if err := next(c); err != nil {
+				return err
+			}
+			return Mark(rd, env.Key, ttl)
+		}
+	}
+}
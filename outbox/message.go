@@ -0,0 +1,68 @@
+package outbox
+
+import (
+	"time"
+)
+
+// Target 消息投递的目标
+type Target string
+
+const (
+	// TargetQueue 投递到queue
+	TargetQueue Target = "queue"
+	// TargetEvent 投递到event
+	TargetEvent Target = "event"
+	// TargetMQTT 投递到mqtt
+	TargetMQTT Target = "mqtt"
+)
+
+// Status 消息状态
+type Status int
+
+const (
+	// Pending 待投递
+	Pending Status = iota
+	// Sent 已投递
+	Sent
+	// Dead 超过最大尝试次数
+	Dead
+)
+
+// Message 发件箱消息，与业务数据在同一事务内写入
+type Message struct {
+	ID        uint64     `gorm:"primary_key;AUTO_INCREMENT" json:"id"`
+	Key       string     `gorm:"type:varchar(64);unique_index;not null" json:"key"`
+	Target    Target     `gorm:"type:varchar(16);not null" json:"target"`
+	Topic     string     `gorm:"type:varchar(255);not null" json:"topic"`
+	Payload   []byte     `gorm:"type:mediumblob" json:"payload"`
+	QoS       byte       `json:"qos"`
+	Retained  bool       `json:"retained"`
+	Status    Status     `gorm:"index:idx_outbox_status_next;not null" json:"status"`
+	Attempts  int        `gorm:"not null" json:"attempts"`
+	NextAt    time.Time  `gorm:"index:idx_outbox_status_next;not null" json:"nextAt"`
+	Claim     string     `gorm:"type:varchar(64);index" json:"-"`
+	Error     string     `gorm:"type:text" json:"error"`
+	CreatedAt time.Time  `json:"createdAt"`
+	SentAt    *time.Time `json:"sentAt"`
+}
+
+func (Message) TableName() string {
+	return "outbox_message"
+}
+
+// MessageOption 消息配置函数
+type MessageOption func(*Message)
+
+// Key 消息唯一标识，供消费方去重，默认自动生成
+func Key(key string) MessageOption {
+	return func(m *Message) {
+		m.Key = key
+	}
+}
+
+// Delay 延迟投递
+func Delay(d time.Duration) MessageOption {
+	return func(m *Message) {
+		m.NextAt = m.NextAt.Add(d)
+	}
+}
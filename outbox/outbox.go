@@ -0,0 +1,305 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Jarnpher553/gemini/event"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/mqtt"
+	"github.com/Jarnpher553/gemini/queue"
+	"github.com/Jarnpher553/gemini/repo"
+	"github.com/Jarnpher553/gemini/shortuuid/snow"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// Sender 将消息投递到目标
+type Sender func(m *Message) error
+
+// Outbox 发件箱
+type Outbox struct {
+	repo        *repo.Repository
+	senders     map[Target]Sender
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	backoff     func(attempts int) time.Duration
+	lease       time.Duration
+	logger      *log.ZapLogger
+	wake        chan struct{}
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+// Option 配置函数
+type Option func(*Outbox)
+
+var box = &Outbox{
+	senders:     map[Target]Sender{TargetQueue: sendQueue, TargetEvent: sendEvent},
+	interval:    time.Second,
+	batchSize:   100,
+	maxAttempts: 10,
+	backoff:     func(attempts int) time.Duration { return time.Duration(attempts) * time.Second },
+	lease:       time.Minute,
+	logger:      log.Zap.Mark("outbox"),
+	wake:        make(chan struct{}, 1),
+}
+
+// Interval 轮询间隔，默认1s
+func Interval(d time.Duration) Option {
+	return func(o *Outbox) {
+		o.interval = d
+	}
+}
+
+// BatchSize 每次轮询认领的消息数，默认100
+func BatchSize(n int) Option {
+	return func(o *Outbox) {
+		o.batchSize = n
+	}
+}
+
+// MaxAttempts 最大尝试次数，超过后标记为Dead，默认10
+func MaxAttempts(n int) Option {
+	return func(o *Outbox) {
+		o.maxAttempts = n
+	}
+}
+
+// Backoff 重试间隔，默认为尝试次数乘以d
+func Backoff(d time.Duration) Option {
+	return func(o *Outbox) {
+		o.backoff = func(attempts int) time.Duration { return time.Duration(attempts) * d }
+	}
+}
+
+// Lease 认领后的租约时长，实例宕机后租约过期的消息由其它实例重新投递，默认1min
+func Lease(d time.Duration) Option {
+	return func(o *Outbox) {
+		o.lease = d
+	}
+}
+
+// MQTTClient 发往mqtt的消息使用的客户端，未配置时mqtt消息无法投递
+func MQTTClient(c *mqtt.Client) Option {
+	return func(o *Outbox) {
+		o.senders[TargetMQTT] = sendMQTT(c)
+	}
+}
+
+// WithSender 替换或新增目标的投递函数
+func WithSender(target Target, sender Sender) Option {
+	return func(o *Outbox) {
+		o.senders[target] = sender
+	}
+}
+
+// Bind 迁移发件箱表并启动转发
+func Bind(rp *repo.Repository, options ...Option) {
+	for _, op := range options {
+		op(box)
+	}
+	box.repo = rp
+	rp.Migrate(nil, &Message{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	box.cancel = cancel
+	box.wg.Add(1)
+	go func() {
+		defer box.wg.Done()
+		box.relay(ctx)
+	}()
+}
+
+// Stop 停止转发并等待当前批次结束
+func Stop() {
+	if box.cancel != nil {
+		box.cancel()
+		box.wg.Wait()
+	}
+}
+
+// Add 在事务内写入消息，tx为repo.Transaction传入的*Repository
+func Add(tx *repo.Repository, target Target, topic string, payload []byte, options ...MessageOption) (string, error) {
+	m := &Message{
+		Key:     fmt.Sprintf("ob_%s", snow.NextID()),
+		Target:  target,
+		Topic:   topic,
+		Payload: payload,
+		Status:  Pending,
+		NextAt:  time.Now(),
+	}
+	for _, op := range options {
+		op(m)
+	}
+
+	if err := tx.Insert(m); err != nil {
+		return "", err
+	}
+	return m.Key, nil
+}
+
+// Queue 在事务内写入发往queue的消息，以Envelope投递，消费方通过QueueDedup去重
+func Queue(tx *repo.Repository, name string, payload string, options ...MessageOption) (string, error) {
+	return Add(tx, TargetQueue, name, []byte(payload), options...)
+}
+
+// Event 在事务内写入发往event的事件，事件ID作为去重标识，消费方以ev.ID调用Seen与Mark
+func Event(tx *repo.Repository, channel string, ev *event.Event, options ...MessageOption) (string, error) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return "", err
+	}
+	return Add(tx, TargetEvent, channel, payload, append([]MessageOption{Key(ev.ID)}, options...)...)
+}
+
+// MQTT 在事务内写入发往mqtt的消息，以Envelope投递，消费方通过MQTTDedup去重，需通过MQTTClient配置客户端
+func MQTT(tx *repo.Repository, topic string, qos byte, retained bool, payload []byte, options ...MessageOption) (string, error) {
+	return Add(tx, TargetMQTT, topic, payload, append([]MessageOption{func(m *Message) {
+		m.QoS = qos
+		m.Retained = retained
+	}}, options...)...)
+}
+
+// Flush 立即触发一次转发，通常在事务提交后调用以减少延迟
+func Flush() {
+	select {
+	case box.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) relay(ctx context.Context) {
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+
+		for ctx.Err() == nil {
+			n, err := o.forward()
+			if err != nil {
+				o.logger.Error(log.Message("relay error:", err))
+			}
+			if n < o.batchSize {
+				break
+			}
+		}
+	}
+}
+
+// forward 认领一批到期的消息并投递，返回认领的数量
+func (o *Outbox) forward() (int, error) {
+	messages, err := o.claim()
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
+
+	for _, m := range messages {
+		o.send(m)
+	}
+	return len(messages), nil
+}
+
+// claim 通过条件更新认领消息，多个实例并发转发时每条消息只被一个实例认领
+func (o *Outbox) claim() ([]*Message, error) {
+	now := time.Now()
+
+	ids := make([]uint64, 0)
+	err := o.repo.DB.Model(&Message{}).
+		Where("status = ? AND next_at <= ?", Pending, now).
+		Order("id").
+		Limit(o.batchSize).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	token := fmt.Sprintf("%s_%d", snow.NextID(), now.UnixNano())
+	err = o.repo.DB.Model(&Message{}).
+		Where("id IN (?) AND status = ? AND next_at <= ?", ids, Pending, now).
+		UpdateColumns(map[string]interface{}{"claim": token, "next_at": now.Add(o.lease)}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*Message, 0, len(ids))
+	err = o.repo.DB.Where("claim = ?", token).Order("id").Find(&messages).Error
+	return messages, err
+}
+
+func (o *Outbox) send(m *Message) {
+	l := o.logger.With(zap.String("key", m.Key), zap.String("target", string(m.Target)), zap.String("topic", m.Topic))
+
+	sender, ok := o.senders[m.Target]
+	var err error
+	if !ok {
+		err = fmt.Errorf("has no sender for target %s", m.Target)
+	} else {
+		err = call(sender, m)
+	}
+
+	columns := map[string]interface{}{"attempts": m.Attempts + 1}
+	if err == nil {
+		now := time.Now()
+		columns["status"] = Sent
+		columns["sent_at"] = &now
+		columns["error"] = ""
+	} else {
+		columns["error"] = err.Error()
+		if m.Attempts+1 >= o.maxAttempts {
+			columns["status"] = Dead
+			l.Error(log.Message("message is dead:", err))
+		} else {
+			columns["next_at"] = time.Now().Add(o.backoff(m.Attempts + 1))
+			l.Warn(log.Message("send error:", err))
+		}
+	}
+
+	if err := o.repo.DB.Model(&Message{}).Where("id = ? AND claim = ?", m.ID, m.Claim).UpdateColumns(columns).Error; err != nil {
+		l.Error(log.Message("mark message error:", err))
+	}
+}
+
+func call(sender Sender, m *Message) (e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			e = fmt.Errorf("%v", err)
+		}
+	}()
+	return sender(m)
+}
+
+func sendQueue(m *Message) error {
+	return queue.Publish(m.Topic, string(seal(m)))
+}
+
+func sendEvent(m *Message) error {
+	var ev event.Event
+	if err := json.Unmarshal(m.Payload, &ev); err != nil {
+		return err
+	}
+	// 非持久模式下没有订阅者时消息本就会丢弃，视为投递成功
+	if err := event.Publish(m.Topic, &ev); err != nil && err != event.ErrNoSubscriber {
+		return err
+	}
+	return nil
+}
+
+func sendMQTT(c *mqtt.Client) Sender {
+	return func(m *Message) error {
+		token := c.Client.Publish(m.Topic, m.QoS, m.Retained, seal(m))
+		if !token.WaitTimeout(10 * time.Second) {
+			return errors.New("mqtt publish timeout")
+		}
+		return token.Error()
+	}
+}
@@ -0,0 +1,264 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"github.com/Jarnpher553/gemini/event"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/mqtt"
+	"github.com/Jarnpher553/gemini/queue"
+	"github.com/Jarnpher553/gemini/redis"
+	"github.com/Jarnpher553/gemini/repo"
+	"github.com/alicebob/miniredis/v2"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"testing"
+	"time"
+)
+
+func newRepo(t *testing.T) *repo.Repository {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接独立
+	db.DB().SetMaxOpenConns(1)
+	rp := &repo.Repository{DB: db, Logger: log.Zap.Mark("repo")}
+	rp.Migrate(nil, &Message{})
+	return rp
+}
+
+func newOutbox(rp *repo.Repository, sender Sender) *Outbox {
+	return &Outbox{
+		repo:        rp,
+		senders:     map[Target]Sender{TargetQueue: sender},
+		batchSize:   10,
+		maxAttempts: 2,
+		backoff:     func(attempts int) time.Duration { return time.Hour },
+		lease:       time.Minute,
+		logger:      box.logger,
+	}
+}
+
+func count(rp *repo.Repository, status Status) int {
+	var n int
+	rp.DB.Model(&Message{}).Where("status = ?", status).Count(&n)
+	return n
+}
+
+func TestAdd_Transaction(t *testing.T) {
+	rp := newRepo(t)
+	defer rp.Close()
+
+	err := rp.Transaction(func(tx *repo.Repository) error {
+		_, err := Queue(tx, "order", "rollback")
+		if err != nil {
+			return err
+		}
+		return errors.New("business failed")
+	})
+	if err == nil || count(rp, Pending) != 0 {
+		t.Fatal("rollback should leave no message")
+	}
+
+	var key string
+	err = rp.Transaction(func(tx *repo.Repository) error {
+		key, err = Queue(tx, "order", "commit", Key("order_1"))
+		return err
+	})
+	if err != nil || key != "order_1" || count(rp, Pending) != 1 {
+		t.Fatalf("commit should keep message, key %s error %v", key, err)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	rp := newRepo(t)
+	defer rp.Close()
+
+	fail := true
+	sent := make([]string, 0)
+	o := newOutbox(rp, func(m *Message) error {
+		if fail {
+			return errors.New("broker down")
+		}
+		sent = append(sent, m.Key)
+		return nil
+	})
+
+	_, _ = Queue(rp, "order", "a", Key("a"))
+	_, _ = Queue(rp, "order", "b", Key("b"), Delay(time.Hour))
+
+	// 认领后租约内不会被再次认领
+	claimed, err := o.claim()
+	if err != nil || len(claimed) != 1 || claimed[0].Key != "a" {
+		t.Fatalf("want a claimed, got %v %v", claimed, err)
+	}
+	if again, _ := o.claim(); len(again) != 0 {
+		t.Fatal("leased message should not be claimed again")
+	}
+
+	// 投递失败按退避重试，未到时间不会被认领
+	o.send(claimed[0])
+	var m Message
+	rp.DB.Where("`key` = ?", "a").First(&m)
+	if m.Status != Pending || m.Attempts != 1 || m.Error != "broker down" || m.NextAt.Before(time.Now().Add(30*time.Minute)) {
+		t.Fatalf("unexpected message after failure %+v", m)
+	}
+	if n, _ := o.forward(); n != 0 {
+		t.Fatal("message should wait for backoff")
+	}
+
+	// 到期后投递成功标记为Sent
+	fail = false
+	rp.DB.Model(&Message{}).Where("`key` = ?", "a").UpdateColumn("next_at", time.Now().Add(-time.Second))
+	if n, err := o.forward(); n != 1 || err != nil {
+		t.Fatalf("want 1 forwarded, got %d %v", n, err)
+	}
+	rp.DB.Where("`key` = ?", "a").First(&m)
+	if m.Status != Sent || m.SentAt == nil || m.Attempts != 2 || len(sent) != 1 {
+		t.Fatalf("unexpected message after sent %+v", m)
+	}
+
+	// 超过最大尝试次数标记为Dead
+	fail = true
+	rp.DB.Model(&Message{}).Where("`key` = ?", "b").UpdateColumns(map[string]interface{}{"next_at": time.Now().Add(-time.Second), "attempts": 1})
+	_, _ = o.forward()
+	if count(rp, Dead) != 1 {
+		t.Fatal("message should be dead after max attempts")
+	}
+}
+
+func newRedis(t *testing.T) *redis.RdClient {
+	return redis.New(redis.Addr(miniredis.RunT(t).Addr()))
+}
+
+func TestDedup_Queue(t *testing.T) {
+	rd := newRedis(t)
+	rp := newRepo(t)
+	defer rp.Close()
+
+	got := make(chan string, 10)
+	queue.Assign("outbox_order", 10, 10*time.Millisecond, QueueDedup(rd, time.Hour, func(d queue.Delivery, _ *queue.Configuration) {
+		got <- d.Payload()
+		_ = d.Ack()
+	}))
+	queue.Bind(queue.Memory())
+	defer func() {
+		_ = queue.StopAllConsuming()
+	}()
+
+	_, _ = Queue(rp, "outbox_order", "paid", Key("order_1"))
+	o := newOutbox(rp, sendQueue)
+	if n, err := o.forward(); n != 1 || err != nil {
+		t.Fatalf("want 1 forwarded, got %d %v", n, err)
+	}
+	// 模拟重复投递
+	_ = sendQueue(&Message{Key: "order_1", Topic: "outbox_order", Payload: []byte("paid")})
+
+	select {
+	case payload := <-got:
+		if payload != "paid" {
+			t.Fatalf("want original payload, got %s", payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("consume timeout")
+	}
+	select {
+	case payload := <-got:
+		t.Fatalf("duplicate should be dropped, got %s", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDedup_Event(t *testing.T) {
+	rd := newRedis(t)
+	rp := newRepo(t)
+	defer rp.Close()
+
+	event.Bind(nil, event.Memory())
+	defer event.Stop()
+
+	handled := make(chan string, 10)
+	_ = event.On("outbox_paid", func(ctx context.Context, ev *event.Event) error {
+		if seen, err := Seen(rd, ev.ID); err != nil || seen {
+			return err
+		}
+		handled <- ev.ID
+		return Mark(rd, ev.ID, time.Hour)
+	})
+	_ = event.Subscribe("outbox/order")
+
+	ev := event.NewEvent("outbox_paid", "order_1")
+	_, _ = Event(rp, "outbox/order", ev)
+	var m Message
+	rp.DB.First(&m)
+	if m.Key != ev.ID {
+		t.Fatal("event id should be the message key")
+	}
+	_ = sendEvent(&m)
+	_ = sendEvent(&m)
+
+	select {
+	case id := <-handled:
+		if id != ev.ID {
+			t.Fatalf("unexpected event %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handle timeout")
+	}
+	select {
+	case id := <-handled:
+		t.Fatalf("duplicate should be dropped, got %s", id)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+type message struct {
+	paho.Message
+	payload []byte
+}
+
+func (m *message) Payload() []byte {
+	return m.payload
+}
+
+func TestDedup_MQTT(t *testing.T) {
+	rd := newRedis(t)
+
+	var payloads []string
+	fail := true
+	h := MQTTDedup(rd, time.Hour)(func(c *mqtt.Context) error {
+		if fail {
+			fail = false
+			return errors.New("handle failed")
+		}
+		payloads = append(payloads, string(c.Payload()))
+		return nil
+	})
+
+	sealed := seal(&Message{Key: "device_1", Payload: []byte("on")})
+	for i := 0; i < 3; i++ {
+		_ = h(&mqtt.Context{Context: context.Background(), Message: &message{payload: sealed}})
+	}
+	if len(payloads) != 1 || payloads[0] != "on" {
+		t.Fatalf("failed message should be retried once then deduplicated, got %v", payloads)
+	}
+
+	_ = h(&mqtt.Context{Context: context.Background(), Message: &message{payload: []byte("raw")}})
+	if len(payloads) != 2 || payloads[1] != "raw" {
+		t.Fatalf("raw message should pass through, got %v", payloads)
+	}
+}
+
+func TestMQTTClient(t *testing.T) {
+	if _, ok := box.senders[TargetMQTT]; ok {
+		t.Fatal("mqtt sender should not be registered without client")
+	}
+
+	o := &Outbox{senders: map[Target]Sender{}}
+	MQTTClient(&mqtt.Client{})(o)
+	if _, ok := o.senders[TargetMQTT]; !ok {
+		t.Fatal("mqtt sender should be registered with client")
+	}
+}
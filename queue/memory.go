@@ -0,0 +1,333 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrAlreadyConsuming = errors.New("queue is already consuming")
+	ErrNotConsuming     = errors.New("queue is not consuming")
+	ErrNotFound         = errors.New("delivery not found")
+)
+
+// memoryBackend 进程内队列后端，语义与rmq一致，用于测试
+type memoryBackend struct {
+	m      sync.Mutex
+	queues map[string]*memoryQueue
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{queues: make(map[string]*memoryQueue)}
+}
+
+func (b *memoryBackend) open(name string) (messageQueue, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	q, ok := b.queues[name]
+	if !ok {
+		q = &memoryQueue{name: name, unacked: make(map[uint64]string), notify: make(chan struct{}, 1)}
+		b.queues[name] = q
+	}
+	return q, nil
+}
+
+func (b *memoryBackend) stopAllConsuming() <-chan struct{} {
+	b.m.Lock()
+	chs := make([]<-chan struct{}, 0, len(b.queues))
+	for _, q := range b.queues {
+		chs = append(chs, q.stopConsuming())
+	}
+	b.m.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		for _, ch := range chs {
+			<-ch
+		}
+		close(finished)
+	}()
+	return finished
+}
+
+type memoryQueue struct {
+	m         sync.Mutex
+	name      string
+	seq       uint64
+	ready     []string
+	unacked   map[uint64]string
+	rejected  []string
+	pushQueue *memoryQueue
+
+	consuming     bool
+	prefetchLimit int64
+	deliveries    chan Delivery
+	notify        chan struct{}
+	stop          chan struct{}
+	consumers     sync.WaitGroup
+}
+
+func (q *memoryQueue) publish(payload string) error {
+	q.m.Lock()
+	q.ready = append(q.ready, payload)
+	q.m.Unlock()
+
+	q.wake()
+	return nil
+}
+
+func (q *memoryQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *memoryQueue) setPushQueue(pushQueue messageQueue) {
+	q.m.Lock()
+	q.pushQueue = pushQueue.(*memoryQueue)
+	q.m.Unlock()
+}
+
+func (q *memoryQueue) startConsuming(prefetchLimit int64, pollDuration time.Duration) error {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	if q.consuming {
+		return ErrAlreadyConsuming
+	}
+	q.consuming = true
+	q.prefetchLimit = prefetchLimit
+	q.deliveries = make(chan Delivery, prefetchLimit)
+	q.stop = make(chan struct{})
+
+	go q.consume(q.deliveries, q.stop, pollDuration)
+	return nil
+}
+
+// consume 将ready中的消息按预取上限投递给消费者
+func (q *memoryQueue) consume(deliveries chan Delivery, stop chan struct{}, pollDuration time.Duration) {
+	for {
+		for _, d := range q.fetch() {
+			deliveries <- d
+		}
+
+		select {
+		case <-stop:
+			close(deliveries)
+			return
+		case <-q.notify:
+		case <-time.After(pollDuration):
+		}
+	}
+}
+
+func (q *memoryQueue) fetch() []Delivery {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	var fetched []Delivery
+	for len(q.ready) > 0 && int64(len(q.unacked)) < q.prefetchLimit {
+		q.seq++
+		payload := q.ready[0]
+		q.ready = q.ready[1:]
+		q.unacked[q.seq] = payload
+		fetched = append(fetched, &memoryDelivery{q: q, id: q.seq, payload: payload})
+	}
+	return fetched
+}
+
+func (q *memoryQueue) stopConsuming() <-chan struct{} {
+	finished := make(chan struct{})
+
+	q.m.Lock()
+	if !q.consuming {
+		q.m.Unlock()
+		close(finished)
+		return finished
+	}
+	q.consuming = false
+	close(q.stop)
+	q.m.Unlock()
+
+	go func() {
+		q.consumers.Wait()
+		close(finished)
+	}()
+	return finished
+}
+
+func (q *memoryQueue) addConsumerFunc(tag string, f func(Delivery)) (string, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	if !q.consuming {
+		return "", ErrNotConsuming
+	}
+
+	deliveries := q.deliveries
+	q.consumers.Add(1)
+	go func() {
+		defer q.consumers.Done()
+		for d := range deliveries {
+			f(d)
+		}
+	}()
+	return fmt.Sprintf("%s-%s", q.name, tag), nil
+}
+
+func (q *memoryQueue) addBatchConsumer(tag string, batchSize int64, timeout time.Duration, f func(Deliveries)) (string, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	if !q.consuming {
+		return "", ErrNotConsuming
+	}
+
+	deliveries := q.deliveries
+	q.consumers.Add(1)
+	go func() {
+		defer q.consumers.Done()
+		for d := range deliveries {
+			batch := Deliveries{d}
+			timer := time.NewTimer(timeout)
+			closed := false
+		Collect:
+			for int64(len(batch)) < batchSize {
+				select {
+				case d, ok := <-deliveries:
+					if !ok {
+						closed = true
+						break Collect
+					}
+					batch = append(batch, d)
+				case <-timer.C:
+					break Collect
+				}
+			}
+			timer.Stop()
+			f(batch)
+			if closed {
+				return
+			}
+		}
+	}()
+	return fmt.Sprintf("%s-%s", q.name, tag), nil
+}
+
+func (q *memoryQueue) purgeReady() (int64, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	count := int64(len(q.ready))
+	q.ready = nil
+	return count, nil
+}
+
+func (q *memoryQueue) purgeRejected() (int64, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	count := int64(len(q.rejected))
+	q.rejected = nil
+	return count, nil
+}
+
+func (q *memoryQueue) returnUnacked(max int64) (int64, error) {
+	q.m.Lock()
+
+	ids := make([]uint64, 0, len(q.unacked))
+	for id := range q.unacked {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var count int64
+	for _, id := range ids {
+		if count == max {
+			break
+		}
+		q.ready = append(q.ready, q.unacked[id])
+		delete(q.unacked, id)
+		count++
+	}
+	q.m.Unlock()
+
+	q.wake()
+	return count, nil
+}
+
+func (q *memoryQueue) returnRejected(max int64) (int64, error) {
+	q.m.Lock()
+
+	count := int64(len(q.rejected))
+	if count > max {
+		count = max
+	}
+	q.ready = append(q.ready, q.rejected[:count]...)
+	q.rejected = q.rejected[count:]
+	q.m.Unlock()
+
+	q.wake()
+	return count, nil
+}
+
+// settle 将未确认的消息移出，to为nil时丢弃
+func (q *memoryQueue) settle(id uint64, to func(payload string)) error {
+	q.m.Lock()
+	payload, ok := q.unacked[id]
+	if !ok {
+		q.m.Unlock()
+		return ErrNotFound
+	}
+	delete(q.unacked, id)
+	q.m.Unlock()
+
+	if to != nil {
+		to(payload)
+	}
+	q.wake()
+	return nil
+}
+
+func (q *memoryQueue) reject(payload string) {
+	q.m.Lock()
+	q.rejected = append(q.rejected, payload)
+	q.m.Unlock()
+}
+
+// memoryDelivery 进程内投递，实现rmq.Delivery
+type memoryDelivery struct {
+	q       *memoryQueue
+	id      uint64
+	payload string
+}
+
+func (d *memoryDelivery) Payload() string {
+	return d.payload
+}
+
+func (d *memoryDelivery) Ack() error {
+	return d.q.settle(d.id, nil)
+}
+
+func (d *memoryDelivery) Reject() error {
+	return d.q.settle(d.id, d.q.reject)
+}
+
+func (d *memoryDelivery) Push() error {
+	d.q.m.Lock()
+	pushQueue := d.q.pushQueue
+	d.q.m.Unlock()
+
+	if pushQueue == nil {
+		return d.Reject()
+	}
+	return d.q.settle(d.id, func(payload string) {
+		_ = pushQueue.publish(payload)
+	})
+}
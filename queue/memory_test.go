@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryQueue_Ack(t *testing.T) {
+	b := newMemoryBackend()
+	q, _ := b.open("order")
+
+	if err := q.startConsuming(10, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(chan string, 3)
+	_, _ = q.addConsumerFunc("consumer", func(delivery Delivery) {
+		got <- delivery.Payload()
+		if err := delivery.Ack(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	for _, p := range []string{"a", "b", "c"} {
+		_ = q.publish(p)
+	}
+
+	for _, want := range []string{"a", "b", "c"} {
+		select {
+		case p := <-got:
+			if p != want {
+				t.Fatalf("want %s, got %s", want, p)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("delivery timeout")
+		}
+	}
+
+	<-q.stopConsuming()
+
+	if n := len(q.(*memoryQueue).unacked); n != 0 {
+		t.Fatalf("unacked should be empty, got %d", n)
+	}
+}
+
+func TestMemoryQueue_RejectAndReturn(t *testing.T) {
+	b := newMemoryBackend()
+	q, _ := b.open("order")
+	_ = q.startConsuming(1, time.Second)
+
+	done := make(chan struct{})
+	_, _ = q.addConsumerFunc("consumer", func(delivery Delivery) {
+		_ = delivery.Reject()
+		if err := delivery.Ack(); err != ErrNotFound {
+			t.Errorf("ack after reject should return ErrNotFound, got %v", err)
+		}
+		done <- struct{}{}
+	})
+
+	_ = q.publish("a")
+	<-done
+	<-q.stopConsuming()
+
+	if n, _ := q.returnRejected(10); n != 1 {
+		t.Fatalf("want 1 returned, got %d", n)
+	}
+	if n, _ := q.purgeReady(); n != 1 {
+		t.Fatalf("want 1 purged, got %d", n)
+	}
+}
+
+func TestMemoryQueue_PushAndBatch(t *testing.T) {
+	b := newMemoryBackend()
+	q, _ := b.open("order")
+	pq, _ := b.open("order-pushQ-0")
+	q.setPushQueue(pq)
+
+	_ = q.startConsuming(10, time.Second)
+	_ = pq.startConsuming(10, time.Second)
+
+	_, _ = q.addConsumerFunc("consumer", func(delivery Delivery) {
+		_ = delivery.Push()
+	})
+
+	got := make(chan Deliveries, 1)
+	_, _ = pq.addBatchConsumer("consumer", 3, time.Second, func(deliveries Deliveries) {
+		deliveries.Ack()
+		got <- deliveries
+	})
+
+	for _, p := range []string{"a", "b", "c"} {
+		_ = q.publish(p)
+	}
+
+	select {
+	case batch := <-got:
+		if len(batch) != 3 {
+			t.Fatalf("want batch of 3, got %d", len(batch))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("batch timeout")
+	}
+
+	<-b.stopAllConsuming()
+}
@@ -12,14 +12,16 @@ import (
 	"time"
 )
 
-var conn = &RedisMessageConn{name: "conn", conf: &Configuration{cleanerTick: 10 * time.Second}, openQueues: cmap.New(), assign: make([]AssignFunc, 0)}
+var conn = &RedisMessageConn{name: "conn", conf: &Configuration{cleanerTick: 10 * time.Second}, openQueues: cmap.New(), traced: cmap.New(), assign: make([]AssignFunc, 0)}
 var logger = log.Logger.Mark("rmq")
 
 type RedisMessageConn struct {
-	conn       rmq.Connection
+	backend    backend
+	memory     bool
 	name       string
 	conf       *Configuration
 	openQueues cmap.ConcurrentMap
+	traced     cmap.ConcurrentMap
 	assign     []AssignFunc
 }
 
@@ -61,6 +63,22 @@ func Name(name string) Conf {
 	}
 }
 
+// Memory 使用进程内队列代替redis，用于测试
+func Memory() Conf {
+	return func(messageConn *RedisMessageConn) {
+		messageConn.memory = true
+	}
+}
+
+// Trace 在这些队列的消息中传递链路信息，会改变消息格式，生产方与消费方需同时开启，格式见traceHeader
+func Trace(names ...string) Conf {
+	return func(messageConn *RedisMessageConn) {
+		for _, name := range names {
+			messageConn.traced.Set(name, true)
+		}
+	}
+}
+
 func CleanerTick(duration time.Duration) Conf {
 	return func(messageConn *RedisMessageConn) {
 		messageConn.conf.cleanerTick = duration
@@ -94,14 +112,20 @@ func Bind(conf ...Conf) {
 		v(conn)
 	}
 
-	if conn.conf.redis == nil {
-		logger.Fatal("has no redis client to initial")
-	}
+	var rmqConn rmq.Connection
+	if conn.memory {
+		conn.backend = newMemoryBackend()
+	} else {
+		if conn.conf.redis == nil {
+			logger.Fatal("has no redis client to initial")
+		}
 
-	var err error
-	conn.conn, err = rmq.OpenConnectionWithRedisClient(conn.name, conn.conf.redis.Client, nil)
-	if err != nil {
-		logger.Fatal("can not open connection")
+		var err error
+		rmqConn, err = rmq.OpenConnectionWithRedisClient(conn.name, conn.conf.redis.Client, nil)
+		if err != nil {
+			logger.Fatal("can not open connection")
+		}
+		conn.backend = &redisBackend{conn: rmqConn}
 	}
 
 	for _, v := range conn.assign {
@@ -110,15 +134,17 @@ func Bind(conf ...Conf) {
 		}
 	}
 
-	go startClean(conn.conf.cleanerTick)
+	if rmqConn != nil {
+		go startClean(rmqConn, conn.conf.cleanerTick)
+	}
 }
 
-func queue(name string) (rmq.Queue, error) {
+func queue(name string) (messageQueue, error) {
 	val, ok := conn.openQueues.Get(name)
 	if ok {
-		return val.(rmq.Queue), nil
+		return val.(messageQueue), nil
 	} else {
-		q, err := conn.conn.OpenQueue(name)
+		q, err := conn.backend.open(name)
 		if err != nil {
 			return nil, err
 		}
@@ -134,7 +160,7 @@ func Publish(name string, payload interface{}) error {
 		return err
 	}
 
-	err = q.Publish(payload.(string))
+	err = q.publish(payload.(string))
 	if err != nil {
 		return err
 	}
@@ -156,7 +182,7 @@ func Assign(queueName string, prefetchLimit int64, duration time.Duration, f Fun
 		if err != nil {
 			return err
 		}
-		err = q.StartConsuming(prefetchLimit, duration)
+		err = q.startConsuming(prefetchLimit, duration)
 		if err != nil {
 			return err
 		}
@@ -165,7 +191,7 @@ func Assign(queueName string, prefetchLimit int64, duration time.Duration, f Fun
 			return err
 		}
 
-		_, err = q.AddConsumerFunc(queueName+"-consumer", decorator(conn.conf, f))
+		_, err = q.addConsumerFunc(queueName+"-consumer", decorator(queueName, conn.conf, f))
 		if err != nil {
 			return err
 		}
@@ -180,7 +206,7 @@ func AssignBatch(queueName string, prefetchLimit int64, duration time.Duration,
 		if err != nil {
 			return err
 		}
-		err = q.StartConsuming(prefetchLimit, duration)
+		err = q.startConsuming(prefetchLimit, duration)
 		if err != nil {
 			return err
 		}
@@ -189,7 +215,7 @@ func AssignBatch(queueName string, prefetchLimit int64, duration time.Duration,
 			return err
 		}
 
-		_, err = q.AddBatchConsumer(queueName+"-consumer", batchSize, timeout, BatchConsumerFunc(decoratorBatch(conn.conf, f)))
+		_, err = q.addBatchConsumer(queueName+"-consumer", batchSize, timeout, decoratorBatch(queueName, conn.conf, f))
 		if err != nil {
 			return err
 		}
@@ -201,20 +227,28 @@ func AssignBatch(queueName string, prefetchLimit int64, duration time.Duration,
 type Delivery = rmq.Delivery
 type Deliveries = rmq.Deliveries
 
-func decorator(configuration *Configuration, f func(Delivery, *Configuration)) func(rmq.Delivery) {
+func decorator(name string, configuration *Configuration, f func(Delivery, *Configuration)) func(rmq.Delivery) {
 	return func(delivery rmq.Delivery) {
-		f(delivery, configuration)
+		d := traced(name, delivery)
+		defer d.finish()
+		f(d, configuration)
 	}
 }
 
-func decoratorBatch(configuration *Configuration, f func(Deliveries, *Configuration)) func(rmq.Deliveries) {
+func decoratorBatch(name string, configuration *Configuration, f func(Deliveries, *Configuration)) func(rmq.Deliveries) {
 	return func(delivery rmq.Deliveries) {
-		f(delivery, configuration)
+		deliveries := make(rmq.Deliveries, 0, len(delivery))
+		for _, d := range delivery {
+			t := traced(name, d)
+			defer t.finish()
+			deliveries = append(deliveries, t)
+		}
+		f(deliveries, configuration)
 	}
 }
 
-func startClean(duration time.Duration) {
-	cleaner := rmq.NewCleaner(conn.conn)
+func startClean(rmqConn rmq.Connection, duration time.Duration) {
+	cleaner := rmq.NewCleaner(rmqConn)
 
 	for range time.Tick(duration) {
 		returned, err := cleaner.Clean()
@@ -231,41 +265,41 @@ func StopConsuming(queueName string) error {
 	if err != nil {
 		return err
 	}
-	<-q.StopConsuming()
+	<-q.stopConsuming()
 	conn.openQueues.Remove(queueName)
 	return nil
 }
 
 func StopAllConsuming() error {
-	<-conn.conn.StopAllConsuming()
+	<-conn.backend.stopAllConsuming()
 	for _, key := range conn.openQueues.Keys() {
 		conn.openQueues.Remove(key)
 	}
 	return nil
 }
 
-func pushQueue(queueName string, q rmq.Queue, prefetchLimit int64, duration time.Duration, pushQueueFunc ...Func) error {
-	var sq rmq.Queue
+func pushQueue(queueName string, q messageQueue, prefetchLimit int64, duration time.Duration, pushQueueFunc ...Func) error {
+	var sq messageQueue
 	sq = q
 	for i, f := range pushQueueFunc {
 		pq, err := queue(fmt.Sprintf("%s-%s-%d", queueName, "pushQ", i))
 		if err != nil {
 			return err
 		}
-		sq.SetPushQueue(pq)
+		sq.setPushQueue(pq)
 
-		err = pq.StartConsuming(prefetchLimit, duration)
+		err = pq.startConsuming(prefetchLimit, duration)
 		if err != nil {
 			return err
 		}
 
-		_, err = pq.AddConsumerFunc(fmt.Sprintf("%s-%s-%d-consumer", queueName, "pushQ", i), decorator(conn.conf, f))
+		_, err = pq.addConsumerFunc(fmt.Sprintf("%s-%s-%d-consumer", queueName, "pushQ", i), decorator(queueName, conn.conf, f))
 		if err != nil {
 			return err
 		}
 		sq = pq
 	}
-	sq.SetPushQueue(q)
+	sq.setPushQueue(q)
 	return nil
 }
 
@@ -283,10 +317,10 @@ func Purge(queueName string, qt KeyFlag) error {
 		return err
 	}
 	if qt == Rejected {
-		_, err := q.PurgeRejected()
+		_, err := q.purgeRejected()
 		return err
 	} else if qt == Ready {
-		_, err := q.PurgeReady()
+		_, err := q.purgeReady()
 		return err
 	} else {
 		return nil
@@ -299,10 +333,10 @@ func Return(queueName string, qt KeyFlag, max int64) error {
 		return err
 	}
 	if qt == Rejected {
-		_, err := q.ReturnRejected(max)
+		_, err := q.returnRejected(max)
 		return err
 	} else if qt == Unacked {
-		_, err := q.ReturnUnacked(max)
+		_, err := q.returnUnacked(max)
 		return err
 	} else {
 		return nil
@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"github.com/adjust/rmq/v3"
+	"time"
+)
+
+// backend 队列后端
+type backend interface {
+	open(name string) (messageQueue, error)
+	stopAllConsuming() <-chan struct{}
+}
+
+// messageQueue 队列
+type messageQueue interface {
+	publish(payload string) error
+	setPushQueue(pushQueue messageQueue)
+	startConsuming(prefetchLimit int64, pollDuration time.Duration) error
+	stopConsuming() <-chan struct{}
+	addConsumerFunc(tag string, f func(Delivery)) (string, error)
+	addBatchConsumer(tag string, batchSize int64, timeout time.Duration, f func(Deliveries)) (string, error)
+	purgeReady() (int64, error)
+	purgeRejected() (int64, error)
+	returnUnacked(max int64) (int64, error)
+	returnRejected(max int64) (int64, error)
+}
+
+// redisBackend 基于rmq的redis后端
+type redisBackend struct {
+	conn rmq.Connection
+}
+
+func (b *redisBackend) open(name string) (messageQueue, error) {
+	q, err := b.conn.OpenQueue(name)
+	if err != nil {
+		return nil, err
+	}
+	return &redisQueue{q}, nil
+}
+
+func (b *redisBackend) stopAllConsuming() <-chan struct{} {
+	return b.conn.StopAllConsuming()
+}
+
+type redisQueue struct {
+	rmq.Queue
+}
+
+func (q *redisQueue) publish(payload string) error {
+	return q.Publish(payload)
+}
+
+func (q *redisQueue) setPushQueue(pushQueue messageQueue) {
+	q.SetPushQueue(pushQueue.(*redisQueue).Queue)
+}
+
+func (q *redisQueue) startConsuming(prefetchLimit int64, pollDuration time.Duration) error {
+	return q.StartConsuming(prefetchLimit, pollDuration)
+}
+
+func (q *redisQueue) stopConsuming() <-chan struct{} {
+	return q.StopConsuming()
+}
+
+func (q *redisQueue) addConsumerFunc(tag string, f func(Delivery)) (string, error) {
+	return q.AddConsumerFunc(tag, f)
+}
+
+func (q *redisQueue) addBatchConsumer(tag string, batchSize int64, timeout time.Duration, f func(Deliveries)) (string, error) {
+	return q.AddBatchConsumer(tag, batchSize, timeout, BatchConsumerFunc(f))
+}
+
+func (q *redisQueue) purgeReady() (int64, error) {
+	return q.PurgeReady()
+}
+
+func (q *redisQueue) purgeRejected() (int64, error) {
+	return q.PurgeRejected()
+}
+
+func (q *redisQueue) returnUnacked(max int64) (int64, error) {
+	return q.ReturnUnacked(max)
+}
+
+func (q *redisQueue) returnRejected(max int64) (int64, error) {
+	return q.ReturnRejected(max)
+}
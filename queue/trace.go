@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Jarnpher553/gemini/tracing"
+	"github.com/adjust/rmq/v3"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"strings"
+)
+
+// traceHeader 以Trace开启的队列中带链路信息的负载前缀，格式为前缀+JSON+换行+原负载，如
+//
+//	gemini-trace/1:{"traceparent":"00-..."}
+//	原负载
+//
+// 开启后消息不再是原负载，未经Assign消费的程序（直接使用rmq、其它语言或不支持此格式的旧版本）需自行去除前缀与第一行
+// 消费方只解析开启了Trace的队列中版本匹配的前缀，其它消息原样交给Assign的消费者
+const traceHeader = "gemini-trace/1:"
+
+// traceEnabled 队列是否以Trace开启了链路传递
+func traceEnabled(name string) bool {
+	return conn.traced.Has(name)
+}
+
+// PublishContext 发布消息，ctx中有Span时创建发布Span，队列以Trace开启时将链路信息随消息传递给消费者
+func PublishContext(ctx context.Context, name string, payload interface{}) error {
+	span, ctx := tracing.StartChild(ctx, "queue publish "+name,
+		ext.SpanKindProducer,
+		opentracing.Tag{Key: string(ext.MessageBusDestination), Value: name},
+	)
+	if span == nil {
+		return Publish(name, payload)
+	}
+
+	if carrier := tracing.Inject(ctx); carrier != nil && traceEnabled(name) {
+		b, _ := json.Marshal(carrier)
+		payload = traceHeader + string(b) + "\n" + payload.(string)
+	}
+	err := Publish(name, payload)
+	tracing.Finish(span, err)
+	return err
+}
+
+// DeliveryContext 消费时的ctx，消息由PublishContext发布时带有消费Span
+func DeliveryContext(d Delivery) context.Context {
+	if c, ok := d.(interface{ Context() context.Context }); ok {
+		return c.Context()
+	}
+	return context.Background()
+}
+
+// tracedDelivery 去除链路信息后的投递
+type tracedDelivery struct {
+	rmq.Delivery
+	payload string
+	ctx     context.Context
+	span    opentracing.Span
+}
+
+func (d *tracedDelivery) Payload() string {
+	return d.payload
+}
+
+func (d *tracedDelivery) Context() context.Context {
+	return d.ctx
+}
+
+// traced 解析负载中的链路信息，有链路信息时创建消费Span，需调用finish结束
+func traced(name string, delivery rmq.Delivery) *tracedDelivery {
+	d := &tracedDelivery{Delivery: delivery, payload: delivery.Payload(), ctx: context.Background()}
+	if !traceEnabled(name) || !strings.HasPrefix(d.payload, traceHeader) {
+		return d
+	}
+	i := strings.IndexByte(d.payload, '\n')
+	if i < 0 {
+		return d
+	}
+
+	var carrier map[string]string
+	if err := json.Unmarshal([]byte(d.payload[len(traceHeader):i]), &carrier); err != nil {
+		return d
+	}
+	d.payload = d.payload[i+1:]
+	d.span, d.ctx = tracing.StartFollowing(carrier, "queue consume "+name,
+		ext.SpanKindConsumer,
+		opentracing.Tag{Key: string(ext.MessageBusDestination), Value: name},
+	)
+	return d
+}
+
+func (d *tracedDelivery) finish() {
+	if d.span != nil {
+		d.span.Finish()
+	}
+}
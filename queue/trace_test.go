@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"context"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"testing"
+	"time"
+)
+
+func TestPublishContext(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	got := make(chan Delivery, 2)
+	Assign("trace", 10, 10*time.Millisecond, func(d Delivery, _ *Configuration) {
+		_ = d.Ack()
+		got <- d
+	})
+	Assign("untraced", 10, 10*time.Millisecond, func(d Delivery, _ *Configuration) {
+		_ = d.Ack()
+		got <- d
+	})
+	Bind(Memory(), Trace("trace"))
+	defer func() {
+		_ = StopAllConsuming()
+	}()
+
+	root := tracer.StartSpan("request")
+	if err := PublishContext(opentracing.ContextWithSpan(context.Background(), root), "trace", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := PublishContext(context.Background(), "trace", "plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未开启Trace的队列保持原负载
+	if err := PublishContext(opentracing.ContextWithSpan(context.Background(), root), "untraced", "raw"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 两个队列的消费顺序不固定
+	deliveries := make(map[string]Delivery)
+	for i := 0; i < 3; i++ {
+		select {
+		case d := <-got:
+			deliveries[d.Payload()] = d
+		case <-time.After(time.Second):
+			t.Fatal("delivery timeout")
+		}
+	}
+
+	for _, want := range []string{"hello", "plain", "raw"} {
+		d, ok := deliveries[want]
+		if !ok {
+			t.Fatalf("want payload %s, got %v", want, deliveries)
+		}
+
+		span := opentracing.SpanFromContext(DeliveryContext(d))
+		if want != "hello" {
+			if span != nil {
+				t.Fatalf("%s message should not be traced", want)
+			}
+			continue
+		}
+		if span == nil || span.(*mocktracer.MockSpan).SpanContext.TraceID != root.(*mocktracer.MockSpan).SpanContext.TraceID {
+			t.Fatalf("consume span should follow the request, got %+v", span)
+		}
+	}
+
+	finished := tracer.FinishedSpans()
+	if len(finished) == 0 || finished[0].OperationName != "queue publish trace" || finished[0].ParentID != root.(*mocktracer.MockSpan).SpanContext.SpanID {
+		t.Fatalf("unexpected finished spans %+v", finished)
+	}
+}
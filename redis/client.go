@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"github.com/Jarnpher553/gemini/log"
 	"github.com/go-redis/redis/v7"
 	"time"
@@ -56,6 +57,9 @@ func New(options ...Option) *RdClient {
 		log.Zap.Mark("redis"),
 	}
 
+	client.AddHook(&logHook{client.logger})
+	client.AddHook(&traceHook{option.DB})
+
 	err := client.Ping().Err()
 	if err != nil {
 		client.logger.Fatal(log.Message("redis connected error:", err.Error()))
@@ -63,6 +67,14 @@ func New(options ...Option) *RdClient {
 	return client
 }
 
+// WithContext 返回使用ctx的客户端，命令日志带有ctx中的trace_id、用户等字段，ctx中有Span时为命令创建子Span
+func (r *RdClient) WithContext(ctx context.Context) *RdClient {
+	return &RdClient{
+		r.Client.WithContext(ctx),
+		r.logger,
+	}
+}
+
 // 以下是redis操作
 
 func (r *RdClient) IncrStr(key string) string {
@@ -0,0 +1,111 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/tracing"
+	"github.com/go-redis/redis/v7"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+)
+
+// logHook 记录执行失败的命令，日志带有ctx中的trace_id、用户等字段
+type logHook struct {
+	logger *log.ZapLogger
+}
+
+func (h *logHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *logHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		h.logger.Ctx(ctx).Error(log.Message("redis command error:", err), zap.String("cmd", cmd.Name()))
+	}
+	return nil
+}
+
+func (h *logHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *logHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		_ = h.AfterProcess(ctx, cmd)
+	}
+	return nil
+}
+
+// spanKey 执行中的Span在ctx中的键
+type spanKey struct{}
+
+// traceHook ctx中有Span时为命令创建子Span，不记录参数值
+type traceHook struct {
+	db int
+}
+
+func (h *traceHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return h.start(ctx, "redis "+cmd.Name(), statement(cmd)), nil
+}
+
+func (h *traceHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.finish(ctx, cmd.Err())
+	return nil
+}
+
+func (h *traceHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	names := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		names = append(names, statement(cmd))
+	}
+	return h.start(ctx, "redis pipeline", strings.Join(names, "\n")), nil
+}
+
+func (h *traceHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if e := cmd.Err(); e != nil && e != redis.Nil {
+			err = e
+			break
+		}
+	}
+	h.finish(ctx, err)
+	return nil
+}
+
+func (h *traceHook) start(ctx context.Context, operationName string, stmt string) context.Context {
+	span, _ := tracing.StartChild(ctx, operationName,
+		ext.SpanKindRPCClient,
+		opentracing.Tag{Key: string(ext.DBType), Value: "redis"},
+		opentracing.Tag{Key: string(ext.DBInstance), Value: strconv.Itoa(h.db)},
+		opentracing.Tag{Key: string(ext.DBStatement), Value: stmt},
+	)
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func (h *traceHook) finish(ctx context.Context, err error) {
+	span, ok := ctx.Value(spanKey{}).(opentracing.Span)
+	if !ok {
+		return
+	}
+	if err == redis.Nil {
+		err = nil
+	}
+	tracing.Finish(span, err)
+}
+
+// statement 命令名与键，如GET user:1
+func statement(cmd redis.Cmder) string {
+	args := cmd.Args()
+	if len(args) > 1 {
+		return strings.ToUpper(cmd.Name()) + " " + fmt.Sprint(args[1])
+	}
+	return strings.ToUpper(cmd.Name())
+}
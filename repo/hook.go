@@ -0,0 +1,158 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/jinzhu/gorm"
+	"reflect"
+)
+
+const (
+	// ActionModify Modify、ModifyColumn与ModifyColumns
+	ActionModify = "modify"
+	// ActionRemove Remove与RemoveWithAffect
+	ActionRemove = "remove"
+)
+
+// Change 一行记录修改前后的差异，修改时只包含变化的字段，删除时Before为整行
+type Change struct {
+	Table  string                 `json:"table" bson:"table"`
+	Action string                 `json:"action" bson:"action"`
+	Key    interface{}            `json:"key" bson:"key"`
+	Before map[string]interface{} `json:"before,omitempty" bson:"before,omitempty"`
+	After  map[string]interface{} `json:"after,omitempty" bson:"after,omitempty"`
+}
+
+// Hook 变更钩子，ctx为WithContext传入的context，未调用WithContext时为context.Background()
+type Hook func(ctx context.Context, changes []*Change)
+
+// Hooks 变更钩子配置，设置后修改与删除会先查询受影响的行以计算差异
+// val为表名字符串时无法计算差异，不调用钩子
+func Hooks(hooks ...Hook) Option {
+	return func(repo *Repository) {
+		repo.hooks = append(repo.hooks, hooks...)
+	}
+}
+
+// snapshot 受影响行修改前的值，没有钩子、val不是模型或既无主键又无条件的全表操作时返回nil
+func (repo *Repository) snapshot(val interface{}, where []interface{}) []interface{} {
+	if len(repo.hooks) == 0 || !isModel(val) {
+		return nil
+	}
+
+	scope := repo.DB.NewScope(val)
+	if scope.PrimaryKeyZero() && len(where) == 0 {
+		return nil
+	}
+	db := repo.DB.New()
+	if !scope.PrimaryKeyZero() {
+		db = db.Where(fmt.Sprintf("%s = ?", scope.Quote(scope.PrimaryKey())), scope.PrimaryKeyValue())
+	}
+	if len(where) != 0 {
+		db = db.Where(where[0], where[1:]...)
+	}
+
+	rows := reflect.New(reflect.SliceOf(reflect.PtrTo(indirectType(val))))
+	if err := db.Find(rows.Interface()).Error; err != nil {
+		repo.Logger.Warn(log.Message("audit snapshot error:", err))
+		return nil
+	}
+
+	out := make([]interface{}, rows.Elem().Len())
+	for i := range out {
+		out[i] = rows.Elem().Index(i).Interface()
+	}
+	return out
+}
+
+// notify 按修改后的值计算差异并调用钩子，after为nil时为删除
+func (repo *Repository) notify(action string, before []interface{}, after func(row interface{}) map[string]interface{}) {
+	if len(before) == 0 {
+		return
+	}
+
+	changes := make([]*Change, 0, len(before))
+	for _, row := range before {
+		scope := repo.DB.NewScope(row)
+		change := &Change{Table: scope.TableName(), Action: action, Key: scope.PrimaryKeyValue()}
+		values := columns(repo.DB, row)
+
+		if after == nil {
+			change.Before = values
+		} else {
+			change.Before = make(map[string]interface{})
+			change.After = make(map[string]interface{})
+			for name, v := range after(row) {
+				if old, ok := values[name]; ok && reflect.DeepEqual(old, v) {
+					continue
+				}
+				change.Before[name] = values[name]
+				change.After[name] = v
+			}
+			if len(change.After) == 0 {
+				continue
+			}
+		}
+		changes = append(changes, change)
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	if v, ok := repo.DB.Get(contextKey); ok {
+		ctx = v.(context.Context)
+	}
+	for _, hook := range repo.hooks {
+		hook(ctx, changes)
+	}
+}
+
+// columns 模型的列值，键为列名
+func columns(db *gorm.DB, val interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, field := range db.NewScope(val).Fields() {
+		if field.IsIgnored || field.Relationship != nil {
+			continue
+		}
+		m[field.DBName] = field.Field.Interface()
+	}
+	return m
+}
+
+// updates ModifyColumns的columns转换为列值，结构体只包含非零值字段，与gorm的Updates一致
+func updates(db *gorm.DB, values interface{}) map[string]interface{} {
+	switch v := values.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			m[gorm.ToColumnName(k)] = value
+		}
+		return m
+	default:
+		m := make(map[string]interface{})
+		if !isModel(values) {
+			return m
+		}
+		for _, field := range db.NewScope(values).Fields() {
+			if field.IsIgnored || field.Relationship != nil || field.IsBlank {
+				continue
+			}
+			m[field.DBName] = field.Field.Interface()
+		}
+		return m
+	}
+}
+
+func isModel(val interface{}) bool {
+	return val != nil && indirectType(val).Kind() == reflect.Struct
+}
+
+func indirectType(val interface{}) reflect.Type {
+	t := reflect.TypeOf(val)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -1,16 +1,23 @@
 package repo
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"github.com/Jarnpher553/gemini/inspector"
 	"github.com/Jarnpher553/gemini/log"
 	"github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
 	"go.uber.org/zap"
 	"reflect"
 	"strings"
+	"time"
 )
 import _ "github.com/jinzhu/gorm/dialects/mysql"
 
+// contextKey WithContext写入gorm的ctx
+const contextKey = "gemini:context"
+
 // repo 仓储类
 type Repository struct {
 	*gorm.DB
@@ -22,6 +29,7 @@ type Repository struct {
 	port     string
 	dbName   string
 	logMode  bool
+	hooks    []Hook
 }
 
 // FieldName 字段类
@@ -103,6 +111,7 @@ func New(options ...Option) *Repository {
 	db.DB().SetMaxIdleConns(10)
 	db.SetLogger(repo)
 	db.LogMode(repo.logMode)
+	trace(db, repo.dbName)
 	repo.DB = db
 
 	return repo
@@ -187,7 +196,12 @@ func (repo *Repository) Remove(val interface{}, where ...interface{}) (e error)
 			e = fmt.Errorf("%v", err)
 		}
 	}()
-	return repo.DB.Delete(val, where...).Error
+	before := repo.snapshot(val, where)
+	if err := repo.DB.Delete(val, where...).Error; err != nil {
+		return err
+	}
+	repo.notify(ActionRemove, before, nil)
+	return nil
 }
 
 // Remove 获取影响行数
@@ -197,7 +211,11 @@ func (repo *Repository) RemoveWithAffect(val interface{}, where ...interface{})
 			e = fmt.Errorf("%v", err)
 		}
 	}()
+	before := repo.snapshot(val, where)
 	ret := repo.DB.Delete(val, where...)
+	if ret.Error == nil {
+		repo.notify(ActionRemove, before, nil)
+	}
 	return ret.RowsAffected, ret.Error
 }
 
@@ -236,7 +254,14 @@ func (repo *Repository) Modify(val interface{}) (e error) {
 		}
 	}()
 
-	return repo.DB.Save(val).Error
+	before := repo.snapshot(val, nil)
+	if err := repo.DB.Save(val).Error; err != nil {
+		return err
+	}
+	repo.notify(ActionModify, before, func(interface{}) map[string]interface{} {
+		return columns(repo.DB, val)
+	})
+	return nil
 }
 
 // 更改单个字段
@@ -246,6 +271,14 @@ func (repo *Repository) ModifyColumn(val interface{}, attr string, upValue inter
 			e = fmt.Errorf("%v", err)
 		}
 	}()
+	before := repo.snapshot(val, where)
+	defer func() {
+		if e == nil {
+			repo.notify(ActionModify, before, func(interface{}) map[string]interface{} {
+				return map[string]interface{}{gorm.ToColumnName(attr): upValue}
+			})
+		}
+	}()
 	kind := reflect.TypeOf(val).Kind()
 
 	if where != nil {
@@ -273,6 +306,14 @@ func (repo *Repository) ModifyColumns(val interface{}, columns interface{}, wher
 			e = fmt.Errorf("%v", err)
 		}
 	}()
+	before := repo.snapshot(val, where)
+	defer func() {
+		if e == nil {
+			repo.notify(ActionModify, before, func(interface{}) map[string]interface{} {
+				return updates(repo.DB, columns)
+			})
+		}
+	}()
 	kind := reflect.TypeOf(val).Kind()
 
 	if where != nil {
@@ -344,6 +385,15 @@ func (repo *Repository) Transaction(f func(*Repository) error) (e error) {
 	return nil
 }
 
+// WithContext 返回使用ctx的repo，sql日志带有ctx中的trace_id、用户等字段，ctx中有Span时为sql创建子Span
+func (repo *Repository) WithContext(ctx context.Context) *Repository {
+	r := *repo
+	r.Logger = repo.Logger.Ctx(ctx)
+	r.DB = repo.DB.Set(contextKey, ctx)
+	r.DB.SetLogger(&r)
+	return &r
+}
+
 // begin 开始一个事务
 func (repo *Repository) begin() *Repository {
 	//开始一个事务
@@ -359,6 +409,7 @@ func (repo *Repository) begin() *Repository {
 		dbName:   repo.dbName,
 		DB:       tx,
 		Logger:   repo.Logger,
+		hooks:    repo.hooks,
 	}
 }
 
@@ -445,6 +496,87 @@ func (repo *Repository) Query(out interface{}, count bool, exps ...Expression) (
 	return
 }
 
+// Rows 行迭代器，Cursor与SliceRows满足该接口，csv.Encode与excel.Stream以此逐行读取
+type Rows interface {
+	Next() bool
+	Scan(out interface{}) error
+	Err() error
+}
+
+// sliceRows 以切片实现的Rows
+type sliceRows struct {
+	data reflect.Value
+	i    int
+}
+
+// SliceRows 以切片构造Rows，用于将内存中的数据按同样的方式导出，slice须为切片
+func SliceRows(slice interface{}) Rows {
+	return &sliceRows{data: reflect.ValueOf(slice)}
+}
+
+func (r *sliceRows) Next() bool {
+	r.i++
+	return r.i <= r.data.Len()
+}
+
+func (r *sliceRows) Scan(out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("scan into non-pointer %T", out)
+	}
+	elem := reflect.Indirect(r.data.Index(r.i - 1))
+	if !elem.Type().AssignableTo(v.Elem().Type()) {
+		return fmt.Errorf("cannot scan %s into %T", elem.Type(), out)
+	}
+	v.Elem().Set(elem)
+	return nil
+}
+
+func (r *sliceRows) Err() error {
+	return nil
+}
+
+// Cursor 逐行读取的查询结果，用于导出等大结果集场景
+type Cursor struct {
+	db   *gorm.DB
+	rows *sql.Rows
+}
+
+// Rows 以游标方式查询，不一次性加载到内存，使用完毕需调用Close
+func (repo *Repository) Rows(exps ...Expression) (*Cursor, error) {
+	db := repo.DB
+
+	for _, exp := range exps {
+		db = exp(db)
+	}
+
+	rows, err := db.Rows()
+	if err != nil {
+		return nil, err
+	}
+	return &Cursor{db: db, rows: rows}, nil
+}
+
+// Next 移动到下一行，没有更多行或出错时返回false
+func (c *Cursor) Next() bool {
+	return c.rows.Next()
+}
+
+// Scan 将当前行扫描到结构体指针out
+func (c *Cursor) Scan(out interface{}) error {
+	return c.db.ScanRows(c.rows, out)
+}
+
+// Err 遍历过程中的错误
+func (c *Cursor) Err() error {
+	return c.rows.Err()
+}
+
+// Close 释放连接
+func (c *Cursor) Close() error {
+	return c.rows.Close()
+}
+
 func Expr(expression string, args ...interface{}) interface{} {
 	expr := gorm.Expr(expression, args...)
 	return expr
@@ -469,6 +601,13 @@ func (repo *Repository) Print(args ...interface{}) {
 			With(zap.String("cost", formatter[2].(string))).
 			With(zap.String("sql", formatter[3].(string))).
 			Info(formatter[4].(string))
+		inspector.RecordStatement(&inspector.Statement{
+			Time:   time.Now(),
+			SQL:    formatter[3].(string),
+			Cost:   formatter[2].(string),
+			Rows:   strings.TrimSpace(formatter[4].(string)),
+			Source: strings.Join(source[len(source)-2:], "/"),
+		})
 	} else {
 		l.
 			Error(formatter[2].(*mysql.MySQLError).Message)
@@ -0,0 +1,61 @@
+package repo
+
+import (
+	"context"
+	"github.com/Jarnpher553/gemini/tracing"
+	"github.com/jinzhu/gorm"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// spanKey 执行中的Span在gorm scope中的键
+const spanKey = "gemini:span"
+
+// trace 注册gorm回调，为WithContext传入的ctx中有Span的sql创建子Span，记录sql与影响行数
+func trace(db *gorm.DB, dbName string) {
+	callback := db.Callback()
+	callback.Create().Before("gorm:begin_transaction").Register("gemini:trace_before_create", startSpan("create", dbName))
+	callback.Create().After("gorm:commit_or_rollback_transaction").Register("gemini:trace_after_create", finishSpan)
+	callback.Update().Before("gorm:begin_transaction").Register("gemini:trace_before_update", startSpan("update", dbName))
+	callback.Update().After("gorm:commit_or_rollback_transaction").Register("gemini:trace_after_update", finishSpan)
+	callback.Delete().Before("gorm:begin_transaction").Register("gemini:trace_before_delete", startSpan("delete", dbName))
+	callback.Delete().After("gorm:commit_or_rollback_transaction").Register("gemini:trace_after_delete", finishSpan)
+	callback.Query().Before("gorm:query").Register("gemini:trace_before_query", startSpan("query", dbName))
+	callback.Query().After("gorm:after_query").Register("gemini:trace_after_query", finishSpan)
+	callback.RowQuery().Before("gorm:row_query").Register("gemini:trace_before_row_query", startSpan("row_query", dbName))
+	callback.RowQuery().After("gorm:row_query").Register("gemini:trace_after_row_query", finishSpan)
+}
+
+func startSpan(operation string, dbName string) func(*gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		v, ok := scope.Get(contextKey)
+		if !ok {
+			return
+		}
+		span, _ := tracing.StartChild(v.(context.Context), "gorm "+operation,
+			ext.SpanKindRPCClient,
+			opentracing.Tag{Key: string(ext.DBType), Value: "sql"},
+			opentracing.Tag{Key: string(ext.DBInstance), Value: dbName},
+		)
+		if span != nil {
+			scope.Set(spanKey, span)
+		}
+	}
+}
+
+func finishSpan(scope *gorm.Scope) {
+	v, ok := scope.Get(spanKey)
+	if !ok {
+		return
+	}
+	span := v.(opentracing.Span)
+	span.SetTag(string(ext.DBStatement), scope.SQL)
+	span.SetTag("db.table", scope.TableName())
+	span.SetTag("db.rows_affected", scope.DB().RowsAffected)
+
+	var err error
+	if scope.HasError() && !gorm.IsRecordNotFoundError(scope.DB().Error) {
+		err = scope.DB().Error
+	}
+	tracing.Finish(span, err)
+}
@@ -0,0 +1,69 @@
+package repo
+
+import (
+	"context"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"testing"
+)
+
+type user struct {
+	ID   int `gorm:"primary_key"`
+	Name string
+}
+
+func TestTrace(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace(db, "test")
+	rp := &Repository{DB: db, Logger: log.Zap.Mark("repo")}
+	defer rp.Close()
+	rp.Migrate(nil, &user{})
+
+	if err := rp.Insert(&user{ID: 1, Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tracer.FinishedSpans()) != 0 {
+		t.Fatal("sql without span in context should not be traced")
+	}
+
+	root := tracer.StartSpan("request")
+	r := rp.WithContext(opentracing.ContextWithSpan(context.Background(), root))
+	if _, err := r.ModifyColumn(&user{ID: 1}, "name", "b"); err != nil {
+		t.Fatal(err)
+	}
+	var u user
+	if err := r.Read(&u, 2); !gorm.IsRecordNotFoundError(err) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	spans := tracer.FinishedSpans()
+	var update, query *mocktracer.MockSpan
+	for _, s := range spans {
+		switch s.OperationName {
+		case "gorm update":
+			update = s
+		case "gorm query":
+			query = s
+		}
+	}
+	if update == nil || query == nil {
+		t.Fatalf("unexpected spans %+v", spans)
+	}
+	if update.ParentID != root.(*mocktracer.MockSpan).SpanContext.SpanID || update.Tag("db.table") != "users" || update.Tag("db.rows_affected") != int64(1) || update.Tag(string(ext.DBInstance)) != "test" {
+		t.Fatalf("unexpected update span %+v", update.Tags())
+	}
+	if query.Tag(string(ext.DBStatement)) == "" || query.Tag("error") != nil {
+		t.Fatalf("record not found should not be an error, got %+v", query.Tags())
+	}
+}
@@ -0,0 +1,71 @@
+package router
+
+import (
+	"github.com/Jarnpher553/gemini/inspector"
+	"github.com/Jarnpher553/gemini/tracing"
+	"github.com/gin-gonic/gin"
+	"path"
+	"time"
+)
+
+type inspectorConfig struct {
+	path     string
+	size     int
+	handlers []gin.HandlerFunc
+}
+
+// Inspector 在服务名称分组下的relativePath（默认/debug/gemini）挂载调试页面，显示最近的请求、Span、SQL与路由表
+// size为每类记录保留的条数，为0时保留200条，handlers为前置的鉴权等中间件
+// 只在非release模式下挂载，以-tags nodebug构建时不挂载；SQL需repo开启LogMode
+func Inspector(relativePath string, size int, handlers ...gin.HandlerFunc) Option {
+	return func(router *Router) {
+		if relativePath == "" {
+			relativePath = "/debug/gemini"
+		}
+		router.inspector = &inspectorConfig{path: relativePath, size: size, handlers: handlers}
+	}
+}
+
+func (r *Router) registerInspector() {
+	if !inspector.Enabled || r.inspector == nil || gin.Mode() == gin.ReleaseMode {
+		return
+	}
+
+	//与其它路由一样挂载在服务名称的分组下
+	full := path.Join(r.Engine.BasePath(), r.inspector.path)
+	inspector.SetSize(r.inspector.size)
+	inspector.Start(full)
+
+	h := inspector.Handler(full, r.routes)
+	handlers := append(r.inspector.handlers[:len(r.inspector.handlers):len(r.inspector.handlers)], gin.WrapH(h))
+	r.Engine.GET(r.inspector.path, handlers...)
+	r.Engine.GET(r.inspector.path+"/*any", handlers...)
+	zapLogger.Warn("inspector is mounted at " + full + ", do not use in production")
+}
+
+func (r *Router) routes() []inspector.Route {
+	routes := r.Engine.Routes()
+	out := make([]inspector.Route, 0, len(routes))
+	for _, route := range routes {
+		out = append(out, inspector.Route{Method: route.Method, Path: route.Path, Handler: route.Handler})
+	}
+	return out
+}
+
+// recordRequest 将请求写入inspector
+func recordRequest(c *gin.Context, begin time.Time, err string) {
+	if !inspector.Active() {
+		return
+	}
+	inspector.RecordRequest(&inspector.Request{
+		Time:     begin,
+		Method:   c.Request.Method,
+		Path:     c.Request.URL.Path,
+		Route:    c.FullPath(),
+		Status:   c.Writer.Status(),
+		Cost:     time.Since(begin),
+		ClientIP: c.ClientIP(),
+		TraceID:  tracing.TraceID(c.Request.Context()),
+		Error:    err,
+	})
+}
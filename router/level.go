@@ -0,0 +1,67 @@
+package router
+
+import (
+	"github.com/Jarnpher553/gemini/erro"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/service"
+	"github.com/gin-gonic/gin"
+)
+
+type logLevel struct {
+	path     string
+	handlers []gin.HandlerFunc
+}
+
+// LogLevel 在path注册运行时修改日志级别的接口，handlers为前置的鉴权等中间件
+// GET返回全局级别与按模块设置的级别
+// PUT {"module": "redis", "level": "debug"}，module为Mark的名称，为空时修改全局级别，level为空时恢复使用全局级别
+func LogLevel(path string, handlers ...gin.HandlerFunc) Option {
+	return func(router *Router) {
+		router.logLevel = &logLevel{path: path, handlers: handlers}
+	}
+}
+
+type levelRequest struct {
+	Module string `json:"module"`
+	Level  string `json:"level"`
+}
+
+type levelResponse struct {
+	Level   string            `json:"level"`
+	Modules map[string]string `json:"modules"`
+}
+
+func (r *Router) registerLogLevel() {
+	if r.logLevel == nil {
+		return
+	}
+
+	handlers := r.logLevel.handlers[:len(r.logLevel.handlers):len(r.logLevel.handlers)]
+	get := append(handlers, service.Wrapper(func(c *service.Ctx) {
+		c.Success(levels())
+	}))
+	put := append(handlers, service.Wrapper(func(c *service.Ctx) {
+		var req levelRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Failure(erro.ErrReqContent, err)
+			return
+		}
+
+		if req.Module != "" && req.Level == "" {
+			log.ResetLevel(req.Module)
+		} else if err := log.SetLevel(req.Module, req.Level); err != nil {
+			c.Failure(erro.ErrReqContent, err, true)
+			return
+		}
+		zapLogger.Info(log.Messagef("log level of module %q set to %q", req.Module, req.Level))
+		c.Success(levels())
+	}))
+
+	r.Engine.GET(r.logLevel.path, get...)
+	r.Engine.PUT(r.logLevel.path, put...)
+}
+
+func levels() *levelResponse {
+	level, modules := log.Levels()
+	return &levelResponse{Level: level, Modules: modules}
+}
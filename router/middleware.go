@@ -101,9 +101,11 @@ func recoverMiddleware(slowQueryThresholdInMilli int64) gin.HandlerFunc {
 				if brokenPipe {
 					c.Error(err)
 					c.Abort()
+					recordRequest(c, beg, err.Error())
 					return
 				}
 				c.AbortWithStatus(http.StatusInternalServerError)
+				recordRequest(c, beg, err.Error())
 				return
 			}
 
@@ -125,6 +127,7 @@ func recoverMiddleware(slowQueryThresholdInMilli int64) gin.HandlerFunc {
 				zap.String("err", err),
 			)
 			zapLogger.Info("access", fields...)
+			recordRequest(c, beg, err)
 		}()
 		c.Next()
 	}
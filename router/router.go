@@ -22,12 +22,14 @@ type Router struct {
 	sync.Once
 	sync.Mutex
 	*gin.Engine
-	services []service.IBaseService
-	static   string
-	template string
-	area     bool
-	groups   map[string]*gin.RouterGroup
-	cors     gin.HandlerFunc
+	services  []service.IBaseService
+	static    string
+	template  string
+	area      bool
+	groups    map[string]*gin.RouterGroup
+	cors      gin.HandlerFunc
+	logLevel  *logLevel
+	inspector *inspectorConfig
 }
 
 var zapLogger = log.Zap.Mark("gin")
@@ -115,6 +117,12 @@ func (r *Router) rootGroup(group string) {
 	//挂载跨域
 	r.useCors()
 
+	//注册日志级别接口
+	r.registerLogLevel()
+
+	//注册调试页面
+	r.registerInspector()
+
 	//注册静态文件路径
 	if r.static != "" {
 		r.registerStatic(r.static)
@@ -209,6 +217,7 @@ func (r *Router) doRegister(srv service.IBaseService) {
 	group.Use(service.Wrapper(service.BreakerMiddleware(srv.Interceptor().Cb)(srv)))
 	group.Use(service.Wrapper(service.MetricMiddleware(srv.Interceptor().Metric)(srv)))
 	group.Use(service.Wrapper(service.TracerMiddleware(srv.Interceptor().Tracer)(srv)))
+	group.Use(service.Wrapper(service.LoggerMiddleware()(srv)))
 
 	//注册自定义中间件
 	group.Use(middleware...)
@@ -225,8 +234,13 @@ func (r *Router) doRegister(srv service.IBaseService) {
 		if _func.Type().NumIn() != 2 || _func.Type().In(1) != reflect.TypeOf(&service.Handler{}) {
 			continue
 		}
-		//出参不满足
-		if _func.Type().NumOut() != 1 || _func.Type().Out(0) != reflect.TypeOf(service.HandlerFunc(func(ctx *service.Ctx) {})) {
+		//出参不满足，WsHandlerFunc为WebSocket处理函数
+		if _func.Type().NumOut() != 1 {
+			continue
+		}
+		out := _func.Type().Out(0)
+		ws := out == reflect.TypeOf(service.WsHandlerFunc(nil))
+		if out != reflect.TypeOf(service.HandlerFunc(func(ctx *service.Ctx) {})) && !ws {
 			continue
 		}
 
@@ -246,7 +260,7 @@ func (r *Router) doRegister(srv service.IBaseService) {
 		} else {
 			httpMethod = handler.HttpMethod
 		}
-		if httpMethod == "" {
+		if httpMethod == "" || ws {
 			httpMethod = "GET"
 		}
 		var relativePath string
@@ -265,7 +279,11 @@ func (r *Router) doRegister(srv service.IBaseService) {
 		for _, m := range handler.Middleware {
 			middleware = append(middleware, service.Wrapper(m(srv)))
 		}
-		middleware = append(middleware, service.Wrapper(ret[0].Interface().(service.HandlerFunc)))
+		if ws {
+			middleware = append(middleware, service.Wrapper(service.Upgrade(srv.Hub(), ret[0].Interface().(service.WsHandlerFunc))))
+		} else {
+			middleware = append(middleware, service.Wrapper(ret[0].Interface().(service.HandlerFunc)))
+		}
 		group.Handle(httpMethod, relativePath, middleware...)
 	}
 }
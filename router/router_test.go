@@ -1,7 +1,12 @@
 package router
 
 import (
+	"github.com/Jarnpher553/gemini/inspector"
 	"github.com/Jarnpher553/gemini/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -21,3 +26,32 @@ func TestRouter_doRegister(t *testing.T) {
 	r.doRegister(service.NewService(&TestService{}))
 
 }
+
+func TestRouter_inspector(t *testing.T) {
+	gin.SetMode(gin.DebugMode)
+	r := New(Inspector("", 10))
+	r.rootGroup("api")
+	r.doRegister(service.NewService(&TestService{}))
+	defer inspector.Stop()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/a/wo/missing", nil))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/debug/gemini/api/requests", nil))
+	if !inspector.Enabled {
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("inspector should not be mounted with nodebug, got %d", w.Code)
+		}
+		return
+	}
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/api/a/wo/missing") {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/debug/gemini/api/routes", nil))
+	if !strings.Contains(w.Body.String(), "/api/debug/gemini") {
+		t.Fatalf("unexpected routes %s", w.Body.String())
+	}
+}
@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/redis"
+	"github.com/go-redsync/redsync/v4"
+	"github.com/go-redsync/redsync/v4/redis/goredis/v7"
+	"github.com/robfig/cron/v3"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Mode 集群模式
+type Mode int
+
+const (
+	// Local 每个实例都执行所有任务
+	Local Mode = iota
+	// Lock 每次执行前争抢以计划时间为键的redis锁，同一时刻只有一个实例执行
+	Lock
+	// Leader 通过redsync选举主实例，只有主实例执行任务
+	Leader
+)
+
+// acquire 判断本实例是否执行此次计划
+func acquire(e *entry) bool {
+	switch ct.mode {
+	case Lock:
+		key, ttl := lockKey(e.name, ct.cron.Entry(e.id), ct.lockTTL)
+		return ct.conf.redis.SetNX(key, ct.node, ttl)
+	case Leader:
+		return ct.leader.isLeader()
+	default:
+		return true
+	}
+}
+
+// lockKey 以计划时间为键，Every的计划相对于各实例的启动时间，按间隔取整后各实例的键才一致
+// 此时锁时长不小于间隔，同一间隔内只执行一次
+func lockKey(name string, ce cron.Entry, ttl time.Duration) (string, time.Duration) {
+	prev := ce.Prev
+	if s, ok := ce.Schedule.(cron.ConstantDelaySchedule); ok {
+		prev = prev.Truncate(s.Delay)
+		if ttl < s.Delay {
+			ttl = s.Delay
+		}
+	}
+	return fmt.Sprintf("scheduler:lock:%s:%d", name, prev.Unix()), ttl
+}
+
+const leaderExpiry = 15 * time.Second
+
+// leader 主实例选举
+type leader struct {
+	mutex  *redsync.Mutex
+	node   string
+	leader int32
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newLeader(rd *redis.RdClient, node string) *leader {
+	rs := redsync.New(goredis.NewPool(rd.Client))
+	return &leader{
+		mutex: rs.NewMutex("scheduler:leader", redsync.WithExpiry(leaderExpiry), redsync.WithTries(1)),
+		node:  node,
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *leader) isLeader() bool {
+	return atomic.LoadInt32(&l.leader) == 1
+}
+
+func (l *leader) start() {
+	go func() {
+		ticker := time.NewTicker(leaderExpiry / 3)
+		defer ticker.Stop()
+
+		for {
+			l.elect()
+
+			select {
+			case <-l.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// elect 主实例续期，其它实例尝试成为主实例
+func (l *leader) elect() {
+	if l.isLeader() {
+		if ok, err := l.mutex.Extend(); ok && err == nil {
+			return
+		}
+		atomic.StoreInt32(&l.leader, 0)
+		logger.Warn(log.Message(l.node, "lost leadership"))
+	}
+
+	if err := l.mutex.Lock(); err == nil {
+		atomic.StoreInt32(&l.leader, 1)
+		logger.Info(log.Message(l.node, "became leader"))
+	}
+}
+
+// stop 可重复调用
+func (l *leader) stop() {
+	l.once.Do(func() {
+		close(l.done)
+		if l.isLeader() {
+			_, _ = l.mutex.Unlock()
+			atomic.StoreInt32(&l.leader, 0)
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package scheduler
+
+import (
+	"github.com/robfig/cron/v3"
+	"testing"
+	"time"
+)
+
+func TestLockKey(t *testing.T) {
+	base := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	every := Every(time.Minute)
+
+	a, ttl := lockKey("job", cron.Entry{Schedule: every, Prev: base.Add(3 * time.Second)}, time.Second)
+	b, _ := lockKey("job", cron.Entry{Schedule: every, Prev: base.Add(40 * time.Second)}, time.Second)
+	if a != b {
+		t.Fatalf("every schedule should share key in one interval, got %s and %s", a, b)
+	}
+	if ttl != time.Minute {
+		t.Fatalf("lock ttl should cover the interval, got %v", ttl)
+	}
+
+	c, _ := lockKey("job", cron.Entry{Schedule: every, Prev: base.Add(61 * time.Second)}, time.Second)
+	if a == c {
+		t.Fatal("next interval should use another key")
+	}
+
+	spec, _ := cron.ParseStandard("* * * * *")
+	d, ttl := lockKey("job", cron.Entry{Schedule: spec, Prev: base.Add(3 * time.Second)}, time.Second)
+	if d == a || ttl != time.Second {
+		t.Fatalf("cron schedule should key on prev, got %s %v", d, ttl)
+	}
+}
+
+func TestLeader_StopTwice(t *testing.T) {
+	l := &leader{done: make(chan struct{})}
+	l.stop()
+	l.stop()
+}
@@ -1,18 +1,58 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
 	"github.com/Jarnpher553/gemini/mongo"
 	"github.com/Jarnpher553/gemini/redis"
 	"github.com/Jarnpher553/gemini/repo"
 	"github.com/robfig/cron/v3"
+	uuid "github.com/satori/go.uuid"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
 	"time"
 )
 
-var ct = &CronTab{cron: cron.New(), conf: &Configuration{}}
+var ct = newCronTab()
+
+var logger = log.Zap.Mark("scheduler")
 
 type CronTab struct {
-	cron *cron.Cron
-	conf *Configuration
+	cron     *cron.Cron
+	conf     *Configuration
+	m        sync.Mutex
+	entries  map[string]*entry
+	node     string
+	mode     Mode
+	lockTTL  time.Duration
+	leader   *leader
+	recorder Recorder
+	stop     context.Context
+	cancel   context.CancelFunc
+}
+
+func newCronTab() *CronTab {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &CronTab{
+		cron:    cron.New(),
+		conf:    &Configuration{},
+		entries: make(map[string]*entry),
+		node:    uuid.NewV4().String(),
+		lockTTL: time.Minute,
+		stop:    ctx,
+		cancel:  cancel,
+	}
+}
+
+// context 任务上下文的根，Stop时取消
+func (c *CronTab) context() context.Context {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.stop
 }
 
 type Configuration struct {
@@ -26,6 +66,9 @@ type Conf func(*CronTab)
 
 type Job func(*Configuration)
 
+// ContextJob 带上下文的任务，上下文在超时或停止时取消
+type ContextJob func(context.Context, *Configuration) error
+
 func Redis(rd *redis.RdClient) Conf {
 	return func(ct *CronTab) {
 		ct.conf.redis = rd
@@ -50,6 +93,34 @@ func Custom(custom interface{}) Conf {
 	}
 }
 
+// Cluster 集群模式，Lock与Leader模式需配置redis
+func Cluster(mode Mode) Conf {
+	return func(ct *CronTab) {
+		ct.mode = mode
+	}
+}
+
+// LockTTL Lock模式下每次执行的锁时长，需大于各实例间的时钟偏差，Every计划的锁时长不小于其间隔
+func LockTTL(ttl time.Duration) Conf {
+	return func(ct *CronTab) {
+		ct.lockTTL = ttl
+	}
+}
+
+// Node 实例标识，默认随机生成
+func Node(node string) Conf {
+	return func(ct *CronTab) {
+		ct.node = node
+	}
+}
+
+// Record 任务执行记录的存储
+func Record(recorder Recorder) Conf {
+	return func(ct *CronTab) {
+		ct.recorder = recorder
+	}
+}
+
 func (c *Configuration) Redis() *redis.RdClient {
 	return c.redis
 }
@@ -70,22 +141,149 @@ func Bind(conf ...Conf) {
 	for _, v := range conf {
 		v(ct)
 	}
+
+	if ct.mode != Local && ct.conf.redis == nil {
+		logger.Fatal("has no redis client for cluster mode")
+	}
+
+	//Stop后重新Bind时重建根上下文
+	ct.m.Lock()
+	if ct.stop.Err() != nil {
+		ct.stop, ct.cancel = context.WithCancel(context.Background())
+	}
+	ct.m.Unlock()
+
+	if ct.mode == Leader {
+		ct.leader = newLeader(ct.conf.redis, ct.node)
+		ct.leader.start()
+	}
 	ct.cron.Start()
 }
 
-func Assign(schedule interface{}, job Job) {
+// Assign 分配任务，schedule为cron表达式或cron.Schedule，只有以Name指定的名称重复时返回错误
+func Assign(schedule interface{}, job Job, options ...JobOption) error {
+	return AssignContext(schedule, func(ctx context.Context, configuration *Configuration) error {
+		job(configuration)
+		return nil
+	}, append([]JobOption{defaultName(funcName(job))}, options...)...)
+}
+
+// AssignContext 分配带上下文的任务，返回的错误会记录到执行记录
+func AssignContext(schedule interface{}, job ContextJob, options ...JobOption) error {
+	e := &entry{job: job, policy: Allow, name: funcName(job)}
+	for _, op := range options {
+		op(e)
+	}
+
+	ct.m.Lock()
+	defer ct.m.Unlock()
+
+	if _, ok := ct.entries[e.name]; ok {
+		if e.named {
+			err := fmt.Errorf("job %s has existed", e.name)
+			logger.Error(err.Error())
+			return err
+		}
+		//同一函数可分配多次，例如不同的计划或循环中创建的闭包
+		name := e.name
+		for i := 2; ok; i++ {
+			e.name = fmt.Sprintf("%s#%d", name, i)
+			_, ok = ct.entries[e.name]
+		}
+	}
+
 	switch t := schedule.(type) {
 	case string:
-		ct.cron.AddFunc(t, decorator(ct.conf, job))
+		id, err := ct.cron.AddJob(t, e)
+		if err != nil {
+			logger.Error(log.Message("assign job", e.name, "error:", err))
+			return err
+		}
+		e.id = id
+		e.spec = t
 	case cron.Schedule:
-		ct.cron.Schedule(t, cron.FuncJob(decorator(ct.conf, job)))
+		e.id = ct.cron.Schedule(t, e)
+		e.spec = fmt.Sprintf("%v", t)
+	default:
+		err := fmt.Errorf("unsupported schedule type %T of job %s", schedule, e.name)
+		logger.Error(err.Error())
+		return err
 	}
+
+	ct.entries[e.name] = e
+	return nil
 }
 
 func Every(duration time.Duration) cron.Schedule {
 	return cron.Every(duration)
 }
 
+// Stop 取消执行中任务的上下文，并等待其结束
 func Stop() {
-	ct.cron.Stop()
+	ct.m.Lock()
+	ct.cancel()
+	ct.m.Unlock()
+
+	<-ct.cron.Stop().Done()
+	if ct.leader != nil {
+		ct.leader.stop()
+	}
+}
+
+// JobInfo 任务信息
+type JobInfo struct {
+	Name    string    `json:"name"`
+	Spec    string    `json:"spec"`
+	Overlap Overlap   `json:"overlap"`
+	Timeout string    `json:"timeout"`
+	Running bool      `json:"running"`
+	Prev    time.Time `json:"prev"`
+	Next    time.Time `json:"next"`
+}
+
+// Jobs 列出所有任务及下次执行时间
+func Jobs() []*JobInfo {
+	ct.m.Lock()
+	defer ct.m.Unlock()
+
+	infos := make([]*JobInfo, 0, len(ct.entries))
+	for _, e := range ct.entries {
+		ce := ct.cron.Entry(e.id)
+		infos = append(infos, &JobInfo{
+			Name:    e.name,
+			Spec:    e.spec,
+			Overlap: e.policy,
+			Timeout: e.timeout.String(),
+			Running: e.isRunning(),
+			Prev:    ce.Prev,
+			Next:    ce.Next,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Trigger 立即执行任务，不受集群模式限制，仍遵循重叠策略
+func Trigger(name string) error {
+	ct.m.Lock()
+	e, ok := ct.entries[name]
+	ct.m.Unlock()
+
+	if !ok {
+		return fmt.Errorf("job %s does not exist", name)
+	}
+	go e.fire(TriggerManual)
+	return nil
+}
+
+// History 查询任务执行记录
+func History(name string, limit int) ([]*Run, error) {
+	if ct.recorder == nil {
+		return nil, errors.New("has no recorder")
+	}
+	return ct.recorder.List(name, limit)
+}
+
+func funcName(f interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
 }
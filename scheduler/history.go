@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"github.com/Jarnpher553/gemini/redis"
+	"github.com/Jarnpher553/gemini/repo"
+	"time"
+)
+
+// Run 任务执行记录
+type Run struct {
+	ID      int       `gorm:"primary_key;AUTO_INCREMENT" json:"id"`
+	Name    string    `gorm:"type:varchar(255);index;not null" json:"name"`
+	Node    string    `gorm:"type:varchar(64);not null" json:"node"`
+	Trigger string    `gorm:"type:varchar(16);not null" json:"trigger"`
+	StartAt time.Time `gorm:"not null" json:"startAt"`
+	EndAt   time.Time `gorm:"not null" json:"endAt"`
+	Error   string    `gorm:"type:text" json:"error"`
+}
+
+func (Run) TableName() string {
+	return "scheduler_run"
+}
+
+// Recorder 执行记录存储
+type Recorder interface {
+	Save(run *Run) error
+	List(name string, limit int) ([]*Run, error)
+}
+
+// redisRecorder 以列表保存最近的执行记录
+type redisRecorder struct {
+	client *redis.RdClient
+	keep   int64
+}
+
+// NewRedisRecorder 构造函数，每个任务保留最近keep条记录
+func NewRedisRecorder(rd *redis.RdClient, keep int64) Recorder {
+	return &redisRecorder{client: rd, keep: keep}
+}
+
+func (r *redisRecorder) key(name string) string {
+	return "scheduler:history:" + name
+}
+
+func (r *redisRecorder) Save(run *Run) error {
+	b, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	pipe := r.client.TxPipeline()
+	pipe.LPush(r.key(run.Name), b)
+	pipe.LTrim(r.key(run.Name), 0, r.keep-1)
+	_, err = pipe.Exec()
+	return err
+}
+
+func (r *redisRecorder) List(name string, limit int) ([]*Run, error) {
+	values, err := r.client.Client.LRange(r.key(name), 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]*Run, 0, len(values))
+	for _, v := range values {
+		var run Run
+		if err := json.Unmarshal([]byte(v), &run); err != nil {
+			return nil, err
+		}
+		runs = append(runs, &run)
+	}
+	return runs, nil
+}
+
+// repoRecorder 保存执行记录到数据库
+type repoRecorder struct {
+	repo *repo.Repository
+}
+
+// NewRepoRecorder 构造函数，自动迁移scheduler_run表
+func NewRepoRecorder(rp *repo.Repository) Recorder {
+	rp.Migrate(nil, &Run{})
+	return &repoRecorder{repo: rp}
+}
+
+func (r *repoRecorder) Save(run *Run) error {
+	return r.repo.Insert(run)
+}
+
+func (r *repoRecorder) List(name string, limit int) ([]*Run, error) {
+	runs := make([]*Run, 0)
+	_, err := r.repo.Query(&runs, false, repo.Model(&Run{}), repo.Where("name = ?", name), repo.Order("id desc"), repo.Page(1, limit))
+	return runs, err
+}
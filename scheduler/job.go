@@ -0,0 +1,151 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/tracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Overlap 上次执行未结束时的重叠策略
+type Overlap string
+
+const (
+	// Allow 允许并发执行
+	Allow Overlap = "allow"
+	// Skip 跳过本次执行
+	Skip Overlap = "skip"
+	// Queue 等待上次执行结束后执行
+	Queue Overlap = "queue"
+)
+
+// 触发方式
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+type JobOption func(*entry)
+
+// Name 任务名称，指定时不可重复，默认为函数名，同一函数多次分配时依次加上#2、#3等后缀
+func Name(name string) JobOption {
+	return func(e *entry) {
+		e.name = name
+		e.named = true
+	}
+}
+
+// defaultName 未指定Name时的名称
+func defaultName(name string) JobOption {
+	return func(e *entry) {
+		e.name = name
+	}
+}
+
+// Policy 重叠策略，默认Allow
+func Policy(policy Overlap) JobOption {
+	return func(e *entry) {
+		e.policy = policy
+	}
+}
+
+// Timeout 单次执行超时时间，超时后取消任务上下文
+func Timeout(timeout time.Duration) JobOption {
+	return func(e *entry) {
+		e.timeout = timeout
+	}
+}
+
+type entry struct {
+	id      cron.EntryID
+	name    string
+	named   bool
+	spec    string
+	job     ContextJob
+	policy  Overlap
+	timeout time.Duration
+	queue   sync.Mutex
+	running int32
+}
+
+// Run 实现cron.Job接口
+func (e *entry) Run() {
+	e.fire(TriggerSchedule)
+}
+
+func (e *entry) isRunning() bool {
+	return atomic.LoadInt32(&e.running) > 0
+}
+
+func (e *entry) fire(trigger string) {
+	l := logger.With(zap.String("job", e.name), zap.String("trigger", trigger))
+
+	if trigger == TriggerSchedule && !acquire(e) {
+		l.Debug("job is running on other node")
+		return
+	}
+
+	switch e.policy {
+	case Skip:
+		if !atomic.CompareAndSwapInt32(&e.running, 0, 1) {
+			l.Info("job is still running, skip")
+			return
+		}
+		defer atomic.StoreInt32(&e.running, 0)
+	case Queue:
+		e.queue.Lock()
+		defer e.queue.Unlock()
+		atomic.AddInt32(&e.running, 1)
+		defer atomic.AddInt32(&e.running, -1)
+	default:
+		atomic.AddInt32(&e.running, 1)
+		defer atomic.AddInt32(&e.running, -1)
+	}
+
+	run := &Run{Name: e.name, Node: ct.node, Trigger: trigger, StartAt: time.Now()}
+	err := e.execute(trigger)
+	run.EndAt = time.Now()
+	if err != nil {
+		run.Error = err.Error()
+		l.Error(log.Message("job error:", err), zap.Duration("cost", run.EndAt.Sub(run.StartAt)))
+	}
+
+	if ct.recorder != nil {
+		if err := ct.recorder.Save(run); err != nil {
+			l.Error(log.Message("save run error:", err))
+		}
+	}
+}
+
+func (e *entry) execute(trigger string) (e2 error) {
+	span, _ := tracing.StartFollowing(nil, "job "+e.name,
+		opentracing.Tag{Key: "job.trigger", Value: trigger},
+		opentracing.Tag{Key: "job.node", Value: ct.node},
+	)
+	ctx := opentracing.ContextWithSpan(ct.context(), span)
+	defer func() {
+		tracing.Finish(span, e2)
+	}()
+
+	defer func() {
+		if err := recover(); err != nil {
+			e2 = fmt.Errorf("%v", err)
+			logger.Error(log.Messagef("err info: %s, track: %s", e2, string(debug.Stack())))
+		}
+	}()
+
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	return e.job(ctx, ct.conf)
+}
@@ -0,0 +1,183 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type memoryRecorder struct {
+	m    sync.Mutex
+	runs []*Run
+}
+
+func (r *memoryRecorder) Save(run *Run) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.runs = append(r.runs, run)
+	return nil
+}
+
+func (r *memoryRecorder) List(name string, limit int) ([]*Run, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	runs := make([]*Run, 0)
+	for i := len(r.runs) - 1; i >= 0 && len(runs) < limit; i-- {
+		if r.runs[i].Name == name {
+			runs = append(runs, r.runs[i])
+		}
+	}
+	return runs, nil
+}
+
+func remove(names ...string) {
+	ct.m.Lock()
+	defer ct.m.Unlock()
+	for _, name := range names {
+		if e, ok := ct.entries[name]; ok {
+			ct.cron.Remove(e.id)
+			delete(ct.entries, name)
+		}
+	}
+}
+
+func TestAssign(t *testing.T) {
+	defer remove("assign_ok")
+
+	job := func(*Configuration) {}
+
+	if err := Assign("bad spec", job, Name("assign_bad")); err == nil {
+		t.Fatal("invalid spec should return error")
+	}
+	if err := Assign(time.Second, job, Name("assign_type")); err == nil {
+		t.Fatal("unsupported schedule should return error")
+	}
+	if err := Assign("@every 1h", job, Name("assign_ok")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Assign(Every(time.Hour), job, Name("assign_ok")); err == nil {
+		t.Fatal("duplicate name should return error")
+	}
+
+	// 未指定名称时同一函数可分配多次
+	name := funcName(job)
+	defer remove(name, name+"#2")
+	if err := Assign("@every 1h", job); err != nil {
+		t.Fatal(err)
+	}
+	if err := Assign(Every(time.Hour), job); err != nil {
+		t.Fatal("same func without name should be assignable twice:", err)
+	}
+	ct.m.Lock()
+	_, ok := ct.entries[name+"#2"]
+	ct.m.Unlock()
+	if !ok {
+		t.Fatal("second assignment should be suffixed")
+	}
+}
+
+func TestOverlap_Skip(t *testing.T) {
+	var count int32
+	release := make(chan struct{})
+	e := &entry{name: "overlap_skip", policy: Skip, job: func(ctx context.Context, c *Configuration) error {
+		atomic.AddInt32(&count, 1)
+		<-release
+		return nil
+	}}
+
+	done := make(chan struct{})
+	go func() {
+		e.fire(TriggerManual)
+		close(done)
+	}()
+	for !e.isRunning() {
+		time.Sleep(time.Millisecond)
+	}
+
+	e.fire(TriggerManual)
+	close(release)
+	<-done
+
+	if c := atomic.LoadInt32(&count); c != 1 {
+		t.Fatalf("want 1 run, got %d", c)
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	recorder := &memoryRecorder{}
+	ct.recorder = recorder
+	defer func() { ct.recorder = nil }()
+	defer remove("trigger_job")
+
+	err := AssignContext("@every 1h", func(ctx context.Context, c *Configuration) error {
+		if _, ok := ctx.Deadline(); !ok {
+			return errors.New("no deadline")
+		}
+		panic("boom")
+	}, Name("trigger_job"), Timeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Trigger("not_exist"); err == nil {
+		t.Fatal("trigger unknown job should return error")
+	}
+	if err := Trigger("trigger_job"); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		runs, _ := History("trigger_job", 10)
+		if len(runs) == 1 {
+			if runs[0].Trigger != TriggerManual || runs[0].Error != "boom" {
+				t.Fatalf("unexpected run %+v", runs[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("run should be recorded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	for _, info := range Jobs() {
+		if info.Name == "trigger_job" {
+			return
+		}
+	}
+	t.Fatal("job should be listed")
+}
+
+func TestStop_Cancel(t *testing.T) {
+	defer remove("stop_job")
+	defer Bind()
+
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	err := AssignContext("@every 1h", func(ctx context.Context, c *Configuration) error {
+		close(started)
+		<-ctx.Done()
+		done <- ctx.Err()
+		return nil
+	}, Name("stop_job"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = Trigger("stop_job")
+	<-started
+	Stop()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("want canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("running job should be canceled on stop")
+	}
+}
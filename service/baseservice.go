@@ -49,6 +49,8 @@ type IBaseService interface {
 	SetReg(*Registry)
 	Interceptor() *Interceptor
 	SetInterceptor(*Interceptor)
+	Hub() *Hub
+	SetHub(*Hub)
 
 	CustomContext(string) interface{}
 	SetCustomContext(string, interface{})
@@ -63,6 +65,7 @@ type BaseService struct {
 	reg         *Registry
 
 	interceptor *Interceptor
+	hub         *Hub
 
 	customContext map[string]interface{}
 }
@@ -126,6 +129,13 @@ func Cb(circuitBreaker *breaker.CircuitBreaker) Option {
 	}
 }
 
+// WsHub 设置WebSocket的Hub，多个服务可共用同一个Hub
+func WsHub(hub *Hub) Option {
+	return func(service IBaseService) {
+		service.SetHub(hub)
+	}
+}
+
 func CustomContext(key string, value interface{}) Option {
 	return func(service IBaseService) {
 		service.SetCustomContext(key, value)
@@ -166,6 +176,10 @@ func NewService(service IBaseService, option ...Option) IBaseService {
 		bs.interceptor.Cb = breaker.New()
 	}
 
+	if bs.hub == nil {
+		bs.hub = NewHub()
+	}
+
 	v.Elem().FieldByName("BaseService").Set(reflect.ValueOf(bs))
 
 	return service
@@ -235,6 +249,14 @@ func (s *BaseService) SetInterceptor(op *Interceptor) {
 	s.interceptor = op
 }
 
+func (s *BaseService) Hub() *Hub {
+	return s.hub
+}
+
+func (s *BaseService) SetHub(hub *Hub) {
+	s.hub = hub
+}
+
 func (s *BaseService) CustomContext(key string) interface{} {
 	return s.customContext[key]
 }
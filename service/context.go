@@ -2,10 +2,13 @@ package service
 
 import (
 	"context"
+	"github.com/Jarnpher553/gemini/csv"
 	"github.com/Jarnpher553/gemini/erro"
 	"github.com/Jarnpher553/gemini/log"
 	"github.com/Jarnpher553/gemini/model/dto"
 	"github.com/Jarnpher553/gemini/now"
+	"github.com/Jarnpher553/gemini/repo"
+	"github.com/Jarnpher553/gemini/util/excel"
 	"github.com/Jarnpher553/gemini/uuid"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -34,6 +37,24 @@ func (c *Ctx) Csv(data []byte, filename string) {
 	c.Data(http.StatusOK, "text/csv", data)
 }
 
+// CsvStream 以分块传输逐行导出带BOM与说明行的csv，row为行结构体，用于确定列
+// 响应头写出后出错时只能中断传输，错误由调用方记录
+func (c *Ctx) CsvStream(filename string, rows repo.Rows, row interface{}) error {
+	c.Header("Content-Disposition", "attachment; filename="+filename+".csv")
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+	return csv.Encode(c.Writer, rows, row, true, true)
+}
+
+// ExcelStream 以分块传输逐行导出xlsx，row为行结构体，用于确定列
+// 响应头写出后出错时只能中断传输，错误由调用方记录
+func (c *Ctx) ExcelStream(filename string, rows repo.Rows, row interface{}) error {
+	c.Header("Content-Disposition", "attachment; filename="+filename+".xlsx")
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Status(http.StatusOK)
+	return excel.Stream(c.Writer, rows, row)
+}
+
 func (c *Ctx) Pdf(data []byte, filename string) {
 	c.Header("Content-Disposition", "filename="+filename+".pdf")
 	c.Data(http.StatusOK, "application/pdf", data)
@@ -76,7 +97,9 @@ func (c *Ctx) response(code int, data interface{}, err error, actual bool) {
 		response.Success = true
 	}
 
-	log.Zap.Source(3).
+	c.Set(responseCodeKey, code)
+
+	c.Logger().Source(3).
 		With(zap.Int("response.code", code)).
 		With(zap.String("response.msg", erro.ErrMsg[code])).
 		With(zap.NamedError("response.err", err)).
@@ -85,6 +108,23 @@ func (c *Ctx) response(code int, data interface{}, err error, actual bool) {
 	c.JSON(http.StatusOK, response)
 }
 
+// responseCodeKey 业务码在gin上下文中的键
+const responseCodeKey = "response.code"
+
+// ResponseCode 通过Success、Failure或Response返回的业务码
+func (c *Ctx) ResponseCode() (int, bool) {
+	code, ok := c.Get(responseCodeKey)
+	if !ok {
+		return 0, false
+	}
+	return code.(int), true
+}
+
+// Logger 当前请求的日志，带有trace_id、span_id、用户、路由与客户端IP
+func (c *Ctx) Logger() *log.ZapLogger {
+	return log.FromContext(c.Request.Context())
+}
+
 func (c *Ctx) UserGUID() (uuid.GUID, bool) {
 	id, ok := c.Request.Context().Value("auth_user_guid").(uuid.GUID)
 	return id, ok
@@ -93,6 +133,7 @@ func (c *Ctx) UserGUID() (uuid.GUID, bool) {
 func (c *Ctx) SetUserGUID(guid uuid.GUID) {
 	var cc context.Context
 	cc = context.WithValue(c.Request.Context(), "auth_user_guid", guid)
+	cc = log.WithFields(cc, zap.String("user_id", string(guid)))
 	c.Request = c.Request.WithContext(cc)
 }
 
@@ -104,6 +145,7 @@ func (c *Ctx) UserID() (int, bool) {
 func (c *Ctx) SetUserID(id int) {
 	var cc context.Context
 	cc = context.WithValue(c.Request.Context(), "auth_user_id", id)
+	cc = log.WithFields(cc, zap.Int("user_id", id))
 	c.Request = c.Request.WithContext(cc)
 }
 
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"github.com/Jarnpher553/gemini/feature"
+	"strconv"
+)
+
+// TenantHeader 评估功能开关时读取租户的请求头
+var TenantHeader = "X-Tenant-ID"
+
+// Feature 对当前请求评估功能开关，同一请求内多次调用结果一致
+// 用户为认证中间件设置的UserID或UserGUID，租户取自TenantHeader请求头
+func (c *Ctx) Feature(name string) bool {
+	key := "feature:" + name
+	if v, ok := c.Get(key); ok {
+		return v.(bool)
+	}
+
+	target := &feature.Target{Tenant: c.GetHeader(TenantHeader), Header: c.Request.Header}
+	if id, ok := c.UserID(); ok {
+		target.User = strconv.Itoa(id)
+	} else if guid, ok := c.UserGUID(); ok {
+		target.User = string(guid)
+	}
+
+	enabled := feature.Enabled(c.Request.Context(), name, target)
+	c.Set(key, enabled)
+	return enabled
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Jarnpher553/gemini/event"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/redis"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrWsNotFound 连接不存在
+var ErrWsNotFound = errors.New("websocket connection not found")
+
+// Fanout 跨实例转发，Hub的广播经过Fanout后在所有实例（包括自身）上投递
+type Fanout interface {
+	Publish(payload []byte) error
+	Subscribe(ctx context.Context, receive func(payload []byte)) error
+}
+
+// hubMessage 经过Fanout转发的消息，To不为空时只发给该连接，否则发给Room内的连接，Room为空时发给所有连接
+type hubMessage struct {
+	Room   string `json:"room,omitempty"`
+	To     string `json:"to,omitempty"`
+	Binary bool   `json:"binary,omitempty"`
+	Data   []byte `json:"data"`
+}
+
+// Hub 管理WebSocket连接与房间
+type Hub struct {
+	m            sync.RWMutex
+	conns        map[string]*WsConn
+	rooms        map[string]map[*WsConn]struct{}
+	fanout       Fanout
+	upgrader     websocket.Upgrader
+	pingInterval time.Duration
+	pongWait     time.Duration
+	writeWait    time.Duration
+	readLimit    int64
+	bufferSize   int
+	logger       *log.ZapLogger
+	ctx          context.Context
+	cancel       context.CancelFunc
+}
+
+// HubOption Hub配置函数
+type HubOption func(*Hub)
+
+// WithFanout 设置跨实例转发
+func WithFanout(fanout Fanout) HubOption {
+	return func(h *Hub) {
+		h.fanout = fanout
+	}
+}
+
+// CheckOrigin 校验Origin，默认只允许与Host同源的请求，跨域访问需通过此项放开
+func CheckOrigin(f func(r *http.Request) bool) HubOption {
+	return func(h *Hub) {
+		h.upgrader.CheckOrigin = f
+	}
+}
+
+// PingInterval 心跳间隔，默认30s，超过1.5倍间隔未收到pong时读取出错
+func PingInterval(d time.Duration) HubOption {
+	return func(h *Hub) {
+		h.pingInterval = d
+		h.pongWait = d * 3 / 2
+	}
+}
+
+// ReadLimit 单条消息的最大字节数，默认64KB
+func ReadLimit(n int64) HubOption {
+	return func(h *Hub) {
+		h.readLimit = n
+	}
+}
+
+// SendBuffer 每个连接的发送缓冲条数，默认256，缓冲满时Send返回ErrWsBufferFull
+func SendBuffer(n int) HubOption {
+	return func(h *Hub) {
+		h.bufferSize = n
+	}
+}
+
+// NewHub 构造函数，设置Fanout时立即订阅
+func NewHub(options ...HubOption) *Hub {
+	h := &Hub{
+		conns:        make(map[string]*WsConn),
+		rooms:        make(map[string]map[*WsConn]struct{}),
+		upgrader:     websocket.Upgrader{},
+		pingInterval: 30 * time.Second,
+		pongWait:     45 * time.Second,
+		writeWait:    10 * time.Second,
+		readLimit:    64 << 10,
+		bufferSize:   256,
+		logger:       log.Zap.Mark("websocket"),
+	}
+	for _, op := range options {
+		op(h)
+	}
+
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+	if h.fanout != nil {
+		if err := h.fanout.Subscribe(h.ctx, h.receive); err != nil {
+			h.logger.Error(log.Message("fanout subscribe error:", err))
+		}
+	}
+	return h
+}
+
+// Conn 按标识获取本实例上的连接
+func (h *Hub) Conn(id string) (*WsConn, bool) {
+	h.m.RLock()
+	defer h.m.RUnlock()
+	c, ok := h.conns[id]
+	return c, ok
+}
+
+// Count 本实例上房间内的连接数，room为空时为所有连接数
+func (h *Hub) Count(room string) int {
+	h.m.RLock()
+	defer h.m.RUnlock()
+	if room == "" {
+		return len(h.conns)
+	}
+	return len(h.rooms[room])
+}
+
+// Broadcast 向房间内的连接发送文本消息，room为空时发给所有连接
+func (h *Hub) Broadcast(room string, data []byte) error {
+	return h.dispatch(&hubMessage{Room: room, Data: data})
+}
+
+// BroadcastJSON 以JSON编码后广播
+func (h *Hub) BroadcastJSON(room string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return h.Broadcast(room, data)
+}
+
+// SendTo 向指定连接发送文本消息，设置Fanout时连接可位于任意实例
+func (h *Hub) SendTo(id string, data []byte) error {
+	if h.fanout == nil {
+		c, ok := h.Conn(id)
+		if !ok {
+			return ErrWsNotFound
+		}
+		return c.Send(data)
+	}
+	return h.dispatch(&hubMessage{To: id, Data: data})
+}
+
+// Close 取消订阅并关闭所有连接
+func (h *Hub) Close() {
+	h.cancel()
+
+	h.m.RLock()
+	conns := make([]*WsConn, 0, len(h.conns))
+	for _, c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.m.RUnlock()
+
+	for _, c := range conns {
+		_ = c.Close()
+	}
+}
+
+func (h *Hub) dispatch(msg *hubMessage) error {
+	if h.fanout == nil {
+		h.deliver(msg)
+		return nil
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return h.fanout.Publish(payload)
+}
+
+func (h *Hub) receive(payload []byte) {
+	msg := &hubMessage{}
+	if err := json.Unmarshal(payload, msg); err != nil {
+		h.logger.Error(log.Message("decode fanout message error:", err))
+		return
+	}
+	h.deliver(msg)
+}
+
+// deliver 投递到本实例上的连接
+func (h *Hub) deliver(msg *hubMessage) {
+	h.m.RLock()
+	var targets []*WsConn
+	switch {
+	case msg.To != "":
+		if c, ok := h.conns[msg.To]; ok {
+			targets = append(targets, c)
+		}
+	case msg.Room == "":
+		for _, c := range h.conns {
+			targets = append(targets, c)
+		}
+	default:
+		for c := range h.rooms[msg.Room] {
+			targets = append(targets, c)
+		}
+	}
+	h.m.RUnlock()
+
+	messageType := websocket.TextMessage
+	if msg.Binary {
+		messageType = websocket.BinaryMessage
+	}
+	for _, c := range targets {
+		if err := c.write(messageType, msg.Data); err != nil {
+			h.logger.Warn(log.Message("deliver error:", err), zap.String("id", c.id), zap.String("room", msg.Room))
+		}
+	}
+}
+
+func (h *Hub) register(c *WsConn) {
+	h.m.Lock()
+	h.conns[c.id] = c
+	h.m.Unlock()
+}
+
+func (h *Hub) unregister(c *WsConn) {
+	h.m.Lock()
+	delete(h.conns, c.id)
+	for room := range c.rooms {
+		h.remove(c, room)
+	}
+	h.m.Unlock()
+}
+
+func (h *Hub) join(c *WsConn, rooms ...string) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	if _, ok := h.conns[c.id]; !ok {
+		return
+	}
+	for _, room := range rooms {
+		members, ok := h.rooms[room]
+		if !ok {
+			members = make(map[*WsConn]struct{})
+			h.rooms[room] = members
+		}
+		members[c] = struct{}{}
+		c.rooms[room] = struct{}{}
+	}
+}
+
+func (h *Hub) leave(c *WsConn, rooms ...string) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	for _, room := range rooms {
+		h.remove(c, room)
+	}
+}
+
+// remove 调用方需持有h.m
+func (h *Hub) remove(c *WsConn, room string) {
+	delete(c.rooms, room)
+	if members, ok := h.rooms[room]; ok {
+		delete(members, c)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+// RedisFanout 基于redis发布订阅的跨实例转发
+type RedisFanout struct {
+	client  *redis.RdClient
+	channel string
+}
+
+// NewRedisFanout 构造函数
+func NewRedisFanout(client *redis.RdClient, channel string) *RedisFanout {
+	return &RedisFanout{client: client, channel: channel}
+}
+
+func (f *RedisFanout) Publish(payload []byte) error {
+	return f.client.Client.Publish(f.channel, payload).Err()
+}
+
+func (f *RedisFanout) Subscribe(ctx context.Context, receive func(payload []byte)) error {
+	ps := f.client.Client.Subscribe(f.channel)
+	if _, err := ps.Receive(); err != nil {
+		_ = ps.Close()
+		return err
+	}
+
+	go func() {
+		defer ps.Close()
+		ch := ps.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				receive([]byte(msg.Payload))
+			}
+		}
+	}()
+	return nil
+}
+
+// EventFanout 基于event总线的跨实例转发，需先调用event.Bind，channel不能再被其它地方订阅
+type EventFanout struct {
+	channel string
+	action  string
+}
+
+// NewEventFanout 构造函数
+func NewEventFanout(channel string) *EventFanout {
+	return &EventFanout{channel: channel, action: "websocket:" + channel}
+}
+
+func (f *EventFanout) Publish(payload []byte) error {
+	err := event.Publish(f.channel, event.NewEvent(f.action, json.RawMessage(payload)))
+	if err == event.ErrNoSubscriber {
+		return nil
+	}
+	return err
+}
+
+func (f *EventFanout) Subscribe(ctx context.Context, receive func(payload []byte)) error {
+	err := event.On(f.action, func(_ context.Context, ev *event.Event) error {
+		if ctx.Err() != nil {
+			return nil
+		}
+		var payload json.RawMessage
+		if err := ev.Bind(&payload); err != nil {
+			return err
+		}
+		receive(payload)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return event.Subscribe(f.channel)
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"github.com/Jarnpher553/gemini/event"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func serveHub(t *testing.T, hub *Hub) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/ws", Wrapper(Upgrade(hub, func(c *WsConn) {
+		if room := c.Ctx.Query("room"); room != "" {
+			c.Join(room)
+		}
+		c.Wait()
+	})))
+	return httptest.NewServer(engine)
+}
+
+func dialHub(t *testing.T, s *httptest.Server, room string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + "/ws?room=" + room
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func waitCount(t *testing.T, hub *Hub, room string, n int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Count(room) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("room %s want %d connections, got %d", room, n, hub.Count(room))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func readText(t *testing.T, conn *websocket.Conn) string {
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestHub_Broadcast(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+	s := serveHub(t, hub)
+	defer s.Close()
+
+	a, b := dialHub(t, s, "a"), dialHub(t, s, "b")
+	defer a.Close()
+	defer b.Close()
+	waitCount(t, hub, "a", 1)
+	waitCount(t, hub, "b", 1)
+
+	_ = hub.Broadcast("a", []byte("to a"))
+	_ = hub.Broadcast("", []byte("to all"))
+	if got := readText(t, a); got != "to a" {
+		t.Fatalf("want to a, got %s", got)
+	}
+	if got := readText(t, a); got != "to all" {
+		t.Fatalf("want to all, got %s", got)
+	}
+	if got := readText(t, b); got != "to all" {
+		t.Fatalf("want to all, got %s", got)
+	}
+
+	if err := hub.SendTo("missing", []byte("x")); err != ErrWsNotFound {
+		t.Fatalf("want ErrWsNotFound, got %v", err)
+	}
+
+	_ = a.Close()
+	waitCount(t, hub, "a", 0)
+	waitCount(t, hub, "", 1)
+}
+
+func TestHub_CheckOrigin(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+	s := serveHub(t, hub)
+	defer s.Close()
+
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + "/ws"
+	header := http.Header{"Origin": []string{"http://evil.example.com"}}
+	if _, _, err := websocket.DefaultDialer.Dial(url, header); err == nil {
+		t.Fatal("cross origin should be rejected by default")
+	}
+
+	allowed := NewHub(CheckOrigin(func(r *http.Request) bool { return true }))
+	defer allowed.Close()
+	s2 := serveHub(t, allowed)
+	defer s2.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s2.URL, "http")+"/ws", header)
+	if err != nil {
+		t.Fatal("cross origin should be allowed by CheckOrigin:", err)
+	}
+	_ = conn.Close()
+}
+
+// memoryFanout 进程内的Fanout，模拟多个实例共享的发布订阅
+type memoryFanout struct {
+	m    sync.Mutex
+	subs []func([]byte)
+}
+
+func (f *memoryFanout) Publish(payload []byte) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	for _, receive := range f.subs {
+		receive(payload)
+	}
+	return nil
+}
+
+func (f *memoryFanout) Subscribe(ctx context.Context, receive func([]byte)) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.subs = append(f.subs, receive)
+	return nil
+}
+
+func TestHub_Fanout(t *testing.T) {
+	fanout := &memoryFanout{}
+	local, remote := NewHub(WithFanout(fanout)), NewHub(WithFanout(fanout))
+	defer local.Close()
+	defer remote.Close()
+
+	s := serveHub(t, remote)
+	defer s.Close()
+	conn := dialHub(t, s, "dashboard")
+	defer conn.Close()
+	waitCount(t, remote, "dashboard", 1)
+
+	_ = local.Broadcast("dashboard", []byte("cpu 80%"))
+	if got := readText(t, conn); got != "cpu 80%" {
+		t.Fatalf("want cpu 80%%, got %s", got)
+	}
+
+	var id string
+	remote.m.RLock()
+	for id = range remote.conns {
+	}
+	remote.m.RUnlock()
+	_ = local.SendTo(id, []byte("direct"))
+	if got := readText(t, conn); got != "direct" {
+		t.Fatalf("want direct, got %s", got)
+	}
+}
+
+func TestEventFanout(t *testing.T) {
+	event.Bind(nil, event.Memory())
+	defer event.Stop()
+
+	hub := NewHub(WithFanout(NewEventFanout("websocket")))
+	defer hub.Close()
+	s := serveHub(t, hub)
+	defer s.Close()
+
+	conn := dialHub(t, s, "")
+	defer conn.Close()
+	waitCount(t, hub, "", 1)
+
+	if err := hub.BroadcastJSON("", map[string]int{"online": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readText(t, conn); got != `{"online":1}` {
+		t.Fatalf("unexpected message %s", got)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/sony/gobreaker"
+	"go.uber.org/zap"
 	"runtime/debug"
 	"strconv"
 	"strings"
@@ -70,6 +71,7 @@ func TracerMiddleware(t *tracing.Tracer) Middleware {
 			}()
 
 			ctx := opentracing.ContextWithSpan(context.Request.Context(), span)
+			ctx = tracing.WithTraceState(ctx, context.Request.Header.Get("tracestate"))
 
 			rNew := context.Request.WithContext(ctx)
 			context.Request = rNew
@@ -78,6 +80,19 @@ func TracerMiddleware(t *tracing.Tracer) Middleware {
 	}
 }
 
+// LoggerMiddleware 将路由与客户端IP写入请求context中的日志字段，需在TracerMiddleware之后
+func LoggerMiddleware() Middleware {
+	return func(srv IBaseService) HandlerFunc {
+		return func(context *Ctx) {
+			ctx := log.WithFields(context.Request.Context(),
+				zap.String("route", context.Request.Method+" "+context.FullPath()),
+				zap.String("client_ip", context.ClientIP()),
+			)
+			context.Request = context.Request.WithContext(ctx)
+		}
+	}
+}
+
 // BreakerMiddleware 断路器中间件
 func BreakerMiddleware(cb *breaker.CircuitBreaker) Middleware {
 	return func(srv IBaseService) HandlerFunc {
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Jarnpher553/gemini/event"
+	"github.com/Jarnpher553/gemini/redis"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSSEClosed 客户端已断开
+var ErrSSEClosed = errors.New("sse client disconnected")
+
+// SSEEvent 一条Server-Sent Event
+type SSEEvent struct {
+	// ID 事件标识，客户端重连时通过Last-Event-ID带回
+	ID string
+	// Event 事件名，为空时客户端触发message事件
+	Event string
+	// Data 为string、[]byte时原样发送，其它类型按JSON编码
+	Data interface{}
+	// Retry 建议客户端的重连间隔
+	Retry time.Duration
+}
+
+// SSE Server-Sent Events写入器，可在多个协程中调用
+type SSE struct {
+	ctx       *Ctx
+	m         sync.Mutex
+	heartbeat time.Duration
+	buffer    int
+}
+
+// SSEOption SSE配置函数
+type SSEOption func(*SSE)
+
+// Heartbeat 心跳注释的间隔，用于保持代理连接，默认15s，0表示不发送
+func Heartbeat(d time.Duration) SSEOption {
+	return func(s *SSE) {
+		s.heartbeat = d
+	}
+}
+
+// StreamBuffer 订阅事件时的缓冲条数，默认64
+func StreamBuffer(n int) SSEOption {
+	return func(s *SSE) {
+		s.buffer = n
+	}
+}
+
+// SSE 以text/event-stream开始流式响应
+func (c *Ctx) SSE(options ...SSEOption) *SSE {
+	s := &SSE{ctx: c, heartbeat: 15 * time.Second, buffer: 64}
+	for _, op := range options {
+		op(s)
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Writer.WriteHeader(http.StatusOK)
+	c.Writer.Flush()
+	return s
+}
+
+// LastEventID 客户端重连时带回的最后一个事件标识
+func (s *SSE) LastEventID() string {
+	return s.ctx.GetHeader("Last-Event-ID")
+}
+
+// Done 客户端断开或请求结束时关闭
+func (s *SSE) Done() <-chan struct{} {
+	return s.ctx.Request.Context().Done()
+}
+
+// Send 发送一条事件
+func (s *SSE) Send(ev *SSEEvent) error {
+	var b strings.Builder
+	if ev.ID != "" {
+		b.WriteString("id: " + oneLine(ev.ID) + "\n")
+	}
+	if ev.Event != "" {
+		b.WriteString("event: " + oneLine(ev.Event) + "\n")
+	}
+	if ev.Retry > 0 {
+		b.WriteString(fmt.Sprintf("retry: %d\n", ev.Retry.Milliseconds()))
+	}
+
+	var data string
+	switch v := ev.Data.(type) {
+	case nil:
+	case string:
+		data = v
+	case []byte:
+		data = string(v)
+	default:
+		marshal, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		data = string(marshal)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + strings.TrimSuffix(line, "\r") + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Comment 发送注释，客户端忽略，常用于心跳
+func (s *SSE) Comment(text string) error {
+	return s.write(": " + oneLine(text) + "\n\n")
+}
+
+// Stream 持续发送ch中的事件并定时发送心跳，直到客户端断开或ch关闭
+func (s *SSE) Stream(ch <-chan *SSEEvent) error {
+	var tick <-chan time.Time
+	if s.heartbeat > 0 {
+		ticker := time.NewTicker(s.heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-s.Done():
+			return nil
+		case ev, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if err := s.Send(ev); err != nil {
+				return err
+			}
+		case <-tick:
+			if err := s.Comment("ping"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// StreamEvents 将event总线上订阅到的事件推送给客户端，事件名为动作，标识为事件ID
+// 只推送本实例已通过event.Subscribe订阅的频道，actions为空时推送所有动作
+func (s *SSE) StreamEvents(actions ...string) error {
+	events, cancel := event.Listen(s.buffer, actions...)
+	defer cancel()
+
+	ch := make(chan *SSEEvent)
+	go func() {
+		for {
+			select {
+			case <-s.Done():
+				return
+			case ev := <-events:
+				select {
+				case ch <- &SSEEvent{ID: ev.ID, Event: ev.Action, Data: ev.Content}:
+				case <-s.Done():
+					return
+				}
+			}
+		}
+	}()
+	return s.Stream(ch)
+}
+
+// StreamRedis 订阅redis频道并推送给客户端，事件名为频道名，连接断开时取消订阅
+func (s *SSE) StreamRedis(client *redis.RdClient, channels ...string) error {
+	ps := client.Client.Subscribe(channels...)
+	defer ps.Close()
+	if _, err := ps.Receive(); err != nil {
+		return err
+	}
+
+	messages := ps.Channel()
+	ch := make(chan *SSEEvent)
+	go func() {
+		for {
+			select {
+			case <-s.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					close(ch)
+					return
+				}
+				select {
+				case ch <- &SSEEvent{Event: msg.Channel, Data: msg.Payload}:
+				case <-s.Done():
+					return
+				}
+			}
+		}
+	}()
+	return s.Stream(ch)
+}
+
+func (s *SSE) write(text string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	select {
+	case <-s.Done():
+		return ErrSSEClosed
+	default:
+	}
+
+	if _, err := s.ctx.Writer.WriteString(text); err != nil {
+		return err
+	}
+	s.ctx.Writer.Flush()
+	return nil
+}
+
+// oneLine 字段值不能包含换行
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"bufio"
+	"github.com/Jarnpher553/gemini/event"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSE_Send(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/sse", Wrapper(func(c *Ctx) {
+		s := c.SSE()
+		_ = s.Send(&SSEEvent{ID: "1", Event: "greet", Data: "hello\nworld", Retry: 3 * time.Second})
+		_ = s.Send(&SSEEvent{ID: s.LastEventID(), Data: map[string]int{"n": 1}})
+		_ = s.Comment("ping")
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	r.Header.Set("Last-Event-ID", "7")
+	engine.ServeHTTP(w, r)
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+	want := "id: 1\nevent: greet\nretry: 3000\ndata: hello\ndata: world\n\n" +
+		"id: 7\ndata: {\"n\":1}\n\n" +
+		": ping\n\n"
+	if w.Body.String() != want {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+}
+
+func TestSSE_StreamEvents(t *testing.T) {
+	event.Bind(nil, event.Memory())
+	defer event.Stop()
+	if err := event.Subscribe("order"); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/sse", Wrapper(func(c *Ctx) {
+		_ = c.SSE(Heartbeat(20 * time.Millisecond)).StreamEvents("order:paid")
+	}))
+	s := httptest.NewServer(engine)
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + "/sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	lines := make(chan string, 16)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(2 * time.Second):
+			t.Fatal("read timeout")
+			return ""
+		}
+	}
+
+	// 心跳说明流已建立，此后发布的事件都会被监听到
+	if line := next(); line != ": ping" {
+		t.Fatalf("want heartbeat, got %q", line)
+	}
+	_ = event.Publish("order", event.NewEvent("order:created", "ignored"))
+	ev := event.NewEvent("order:paid", "42")
+	_ = event.Publish("order", ev)
+
+	for {
+		line := next()
+		if !strings.HasPrefix(line, "id: ") {
+			continue
+		}
+		if line != "id: "+ev.ID {
+			t.Fatalf("unexpected id line %q", line)
+		}
+		break
+	}
+	if line := next(); line != "event: order:paid" {
+		t.Fatalf("unexpected event line %q", line)
+	}
+	if line := next(); line != "data: 42" {
+		t.Fatalf("unexpected data line %q", line)
+	}
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/uuid"
+	"github.com/gorilla/websocket"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrWsClosed 连接已关闭
+	ErrWsClosed = errors.New("websocket closed")
+	// ErrWsBufferFull 发送缓冲已满，通常是客户端读取过慢
+	ErrWsBufferFull = errors.New("websocket send buffer full")
+)
+
+// WsHandlerFunc WebSocket处理函数，返回后连接关闭
+// 心跳的pong在读取时处理，处理函数需持续读取直到出错，只推送不读取时调用WsConn.Wait
+// 服务方法签名为func(*Handler) WsHandlerFunc时，路由以GET注册并在经过中间件后升级连接
+type WsHandlerFunc func(*WsConn)
+
+// wsFrame 待发送的一帧
+type wsFrame struct {
+	messageType int
+	data        []byte
+}
+
+// WsConn WebSocket连接，写入由单独的协程完成，可在任意协程中调用Send
+type WsConn struct {
+	// Ctx 升级前的请求上下文，可获取认证中间件写入的用户信息
+	Ctx   *Ctx
+	conn  *websocket.Conn
+	id    string
+	hub   *Hub
+	send  chan wsFrame
+	done  chan struct{}
+	once  sync.Once
+	rooms map[string]struct{}
+}
+
+// ID 连接标识
+func (c *WsConn) ID() string {
+	return c.id
+}
+
+// Hub 连接所属的Hub
+func (c *WsConn) Hub() *Hub {
+	return c.hub
+}
+
+// RemoteAddr 远端地址
+func (c *WsConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// ReadMessage 读取一条消息，只能在处理函数所在的协程中调用
+func (c *WsConn) ReadMessage() (messageType int, data []byte, err error) {
+	return c.conn.ReadMessage()
+}
+
+// ReadJSON 读取一条JSON消息，只能在处理函数所在的协程中调用
+func (c *WsConn) ReadJSON(v interface{}) error {
+	return c.conn.ReadJSON(v)
+}
+
+// Wait 读取并丢弃客户端消息，直到连接关闭
+func (c *WsConn) Wait() {
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// Send 发送文本消息
+func (c *WsConn) Send(data []byte) error {
+	return c.write(websocket.TextMessage, data)
+}
+
+// SendBinary 发送二进制消息
+func (c *WsConn) SendBinary(data []byte) error {
+	return c.write(websocket.BinaryMessage, data)
+}
+
+// SendJSON 以JSON编码后发送文本消息
+func (c *WsConn) SendJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Send(data)
+}
+
+// Join 加入房间
+func (c *WsConn) Join(rooms ...string) {
+	c.hub.join(c, rooms...)
+}
+
+// Leave 离开房间
+func (c *WsConn) Leave(rooms ...string) {
+	c.hub.leave(c, rooms...)
+}
+
+// Done 连接关闭时关闭
+func (c *WsConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close 关闭连接
+func (c *WsConn) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
+
+func (c *WsConn) write(messageType int, data []byte) error {
+	select {
+	case <-c.done:
+		return ErrWsClosed
+	default:
+	}
+
+	select {
+	case c.send <- wsFrame{messageType: messageType, data: data}:
+		return nil
+	case <-c.done:
+		return ErrWsClosed
+	default:
+		return ErrWsBufferFull
+	}
+}
+
+// writeLoop 唯一的写协程，负责消息与心跳
+func (c *WsConn) writeLoop() {
+	ticker := time.NewTicker(c.hub.pingInterval)
+	defer func() {
+		ticker.Stop()
+		_ = c.conn.Close()
+	}()
+
+	for {
+		select {
+		case frame := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(c.hub.writeWait))
+			if err := c.conn.WriteMessage(frame.messageType, frame.data); err != nil {
+				_ = c.Close()
+				return
+			}
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(c.hub.writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				_ = c.Close()
+				return
+			}
+		case <-c.done:
+			_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(c.hub.writeWait))
+			return
+		}
+	}
+}
+
+// Upgrade 将WebSocket处理函数转换为HandlerFunc，连接注册到hub
+func Upgrade(hub *Hub, handler WsHandlerFunc) HandlerFunc {
+	return func(ctx *Ctx) {
+		conn, err := hub.upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+		if err != nil {
+			// Upgrade失败时已写入http错误响应
+			hub.logger.Error(log.Message("websocket upgrade error:", err))
+			return
+		}
+
+		c := &WsConn{
+			Ctx:   ctx,
+			conn:  conn,
+			id:    string(uuid.New()),
+			hub:   hub,
+			send:  make(chan wsFrame, hub.bufferSize),
+			done:  make(chan struct{}),
+			rooms: make(map[string]struct{}),
+		}
+
+		conn.SetReadLimit(hub.readLimit)
+		_ = conn.SetReadDeadline(time.Now().Add(hub.pongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(hub.pongWait))
+		})
+
+		hub.register(c)
+		defer hub.unregister(c)
+		go c.writeLoop()
+
+		handler(c)
+		_ = c.Close()
+	}
+}
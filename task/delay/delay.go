@@ -2,23 +2,29 @@ package delay
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/shortuuid/snow"
 	"github.com/Jarnpher553/gemini/task"
-	"github.com/go-redis/redis/v7"
-	"github.com/go-redsync/redsync/v4"
-	"github.com/go-redsync/redsync/v4/redis/goredis/v7"
+	"github.com/Jarnpher553/gemini/tracing"
+	"github.com/rcrowley/go-metrics"
 	"sync"
 	"time"
 )
 
-//失效任务实例
-var delay = &Delay{handles: make(map[string]task.Handle), m: &sync.Mutex{}, options: &task.Options{}, logger: log.Zap.Mark("taskDelay")}
+//延时任务实例
+var delay = &Delay{workers: make(map[string]*worker), m: &sync.Mutex{}, options: &task.Options{}, logger: log.Zap.Mark("taskDelay")}
+
+//延时任务指标
+var registry = metrics.NewRegistry()
 
 type Delay struct {
 	options *task.Options
-	rs      *redsync.Redsync
-	handles map[string]task.Handle
+	store   store
+	workers map[string]*worker
 	m       *sync.Mutex
+	wg      sync.WaitGroup
 	stop    context.Context
 	cancel  context.CancelFunc
 	logger  *log.ZapLogger
@@ -33,72 +39,101 @@ func Bind(autoRun bool, options ...task.Option) {
 	delay.stop = ctx
 	delay.cancel = cancel
 
-	delay.rs = redsync.New(goredis.NewPool(delay.options.Redis.Client))
+	if delay.options.Memory {
+		delay.store = newMemoryStore()
+	} else {
+		delay.store = newRedisStore(delay.options.Redis)
+	}
 
 	if autoRun {
 		Run()
 	}
 }
 
-//分配失效任务
-func Assign(name string, handle task.Handle) {
+//分配延时任务
+func Assign(name string, handle task.Handle, options ...WorkerOption) {
+	AssignHandler(name, legacy(handle), options...)
+}
+
+//分配延时任务，处理程序返回错误时重试
+func AssignHandler(name string, handler Handler, options ...WorkerOption) {
 	delay.m.Lock()
-	delay.handles[name] = handle
+	delay.workers[name] = newWorker(name, handler, options...)
 	delay.m.Unlock()
 }
 
 //执行任务
 func Run() {
-	for key := range delay.handles {
-		go func(k string) {
-		For:
-			for {
-				select {
-				case <-delay.stop.Done():
-					delay.logger.Info(log.Message(k, "stopped"))
-					break For
-				default:
-					<-time.After(100 * time.Millisecond)
-
-					mutex := delay.rs.NewMutex("mutex/" + k)
-
-					if err := mutex.Lock(); err != nil {
-						continue
-					}
-
-					now := time.Now().UnixNano() / 1e6
-					zset := delay.options.Redis.ZRangeByScoreWithScores(k, &redis.ZRangeBy{"-inf", "+inf", 0, 1}).Val()
-					if len(zset) != 0 {
-						score := zset[0].Score
-						if float64(now) >= score {
-							go delay.handles[k](zset[0].Member, delay.options)
-							delay.options.Redis.ZRem(k, zset[0].Member)
-						}
-					}
-
-					_, _ = mutex.Unlock()
-				}
-			}
-		}(key)
+	delay.m.Lock()
+	defer delay.m.Unlock()
+
+	for _, w := range delay.workers {
+		delay.wg.Add(1)
+		go func(w *worker) {
+			defer delay.wg.Done()
+			w.run(delay.stop)
+		}(w)
 	}
 }
 
+//停止领取任务并等待执行中的任务完成
 func Stop() {
 	delay.cancel()
+	delay.wg.Wait()
 }
 
+//加入延时任务，value同时作为任务id与负载
 func Join(taskName string, duration time.Duration, value string) {
-	delay.options.Redis.ZAdd(taskName, &redis.Z{Score: float64(time.Now().Add(duration).UnixNano() / 1e6), Member: value})
+	if err := EnqueueWithID(taskName, value, duration, value); err != nil {
+		delay.logger.Error(log.Message("join error:", err))
+	}
+}
+
+//加入延时任务，返回生成的任务id
+func Enqueue(taskName string, duration time.Duration, payload interface{}) (string, error) {
+	id := fmt.Sprintf("job_%s", snow.NextID())
+	return id, EnqueueWithID(taskName, id, duration, payload)
+}
+
+//以指定id加入延时任务，id已存在时覆盖原任务
+func EnqueueWithID(taskName string, id string, duration time.Duration, payload interface{}) error {
+	return EnqueueContext(context.Background(), taskName, id, duration, payload)
 }
 
+//以指定id加入延时任务，ctx中有Span时任务执行的Span与之关联
+func EnqueueContext(ctx context.Context, taskName string, id string, duration time.Duration, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return delay.store.push(&Job{
+		ID:      id,
+		Name:    taskName,
+		Payload: b,
+		DueAt:   time.Now().Add(duration).UnixNano() / 1e6,
+		Trace:   tracing.Inject(ctx),
+	})
+}
+
+//取消任务，返回任务是否存在
+func Cancel(taskName string, id string) (bool, error) {
+	return delay.store.cancel(taskName, id)
+}
+
+//任务的到期时间（毫秒），包括已被领取正在执行的任务，不存在时为0
 func Timestamp(taskName string, value string) float64 {
-	return delay.options.Redis.ZScore(taskName, value).Val()
+	score, _ := delay.store.score(taskName, value)
+	return score
 }
 
+//任务是否存在，包括已被领取正在执行的任务
 func Exist(taskName string, value string) bool {
-	err := delay.options.Redis.ZRank(taskName, value).Err()
-	if err == redis.Nil {
-		return false
-	}
-	return true
+	_, ok := delay.store.score(taskName, value)
+	return ok
+}
+
+//任务指标，键为 任务名称.lag/duration/processed/failed/retried/dead
+func Registry() metrics.Registry {
+	return registry
 }
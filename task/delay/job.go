@@ -0,0 +1,40 @@
+package delay
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Jarnpher553/gemini/task"
+)
+
+//延时任务
+type Job struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Payload  json.RawMessage `json:"payload"`
+	Attempts int             `json:"attempts"`
+	DueAt    int64           `json:"dueAt"`
+	//加入时的链路信息，执行时以此为起点创建Span
+	Trace map[string]string `json:"trace,omitempty"`
+	//领取时的租约到期时间，确认、重试与放入死信时校验，避免旧的执行覆盖同id重新加入的任务
+	lease int64
+}
+
+//将负载解析至v
+func (j *Job) Bind(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+//任务处理程序，返回错误时按退避策略重试
+type Handler func(ctx context.Context, job *Job, opt *task.Options) error
+
+//兼容旧的处理程序，负载为字符串时传入字符串，否则传入任务id
+func legacy(handle task.Handle) Handler {
+	return func(ctx context.Context, job *Job, opt *task.Options) error {
+		var value string
+		if err := job.Bind(&value); err != nil {
+			value = job.ID
+		}
+		handle(value, opt)
+		return nil
+	}
+}
@@ -0,0 +1,216 @@
+package delay
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+//基于最小堆的进程内存储，用于测试
+type memoryStore struct {
+	m      sync.Mutex
+	queues map[string]*memoryQueue
+}
+
+type memoryQueue struct {
+	ready    *delayHeap
+	inflight *delayHeap
+	jobs     map[string]Job
+	dead     map[string]Job
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{queues: make(map[string]*memoryQueue)}
+}
+
+func (s *memoryStore) queue(name string) *memoryQueue {
+	q, ok := s.queues[name]
+	if !ok {
+		q = &memoryQueue{
+			ready:    newDelayHeap(),
+			inflight: newDelayHeap(),
+			jobs:     make(map[string]Job),
+			dead:     make(map[string]Job),
+		}
+		s.queues[name] = q
+	}
+	return q
+}
+
+func (s *memoryStore) push(job *Job) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	q := s.queue(job.Name)
+	q.jobs[job.ID] = *job
+	q.inflight.remove(job.ID)
+	q.ready.set(job.ID, float64(job.DueAt))
+	return nil
+}
+
+func (s *memoryStore) claim(name string, now int64, limit int, lease time.Duration) ([]*Job, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	q := s.queue(name)
+	for i := 0; i < limit && q.inflight.due(float64(now)); i++ {
+		item := heap.Pop(q.inflight).(*delayItem)
+		q.ready.set(item.member, float64(now))
+	}
+
+	jobs := make([]*Job, 0)
+	for len(jobs) < limit && q.ready.due(float64(now)) {
+		item := heap.Pop(q.ready).(*delayItem)
+		until := now + int64(lease/time.Millisecond)
+		q.inflight.set(item.member, float64(until))
+
+		job := q.jobs[item.member]
+		job.DueAt = int64(item.score)
+		job.lease = until
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+func (s *memoryStore) ack(job *Job) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	q := s.queue(job.Name)
+	if !q.release(job) {
+		return nil
+	}
+	delete(q.jobs, job.ID)
+	return nil
+}
+
+func (s *memoryStore) retry(job *Job, at int64) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	q := s.queue(job.Name)
+	if !q.release(job) {
+		return nil
+	}
+	q.jobs[job.ID] = *job
+	q.ready.set(job.ID, float64(at))
+	return nil
+}
+
+func (s *memoryStore) bury(job *Job, now int64) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	q := s.queue(job.Name)
+	if !q.release(job) {
+		return nil
+	}
+	delete(q.jobs, job.ID)
+	q.dead[job.ID] = *job
+	return nil
+}
+
+//仅当任务仍持有本次领取的租约时移出租约集合
+func (q *memoryQueue) release(job *Job) bool {
+	item, ok := q.inflight.index[job.ID]
+	if !ok || item.score != float64(job.lease) {
+		return false
+	}
+	return q.inflight.remove(job.ID)
+}
+
+func (s *memoryStore) cancel(name string, id string) (bool, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	q := s.queue(name)
+	delete(q.jobs, id)
+	ready := q.ready.remove(id)
+	inflight := q.inflight.remove(id)
+	return ready || inflight, nil
+}
+
+func (s *memoryStore) score(name string, id string) (float64, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	q := s.queue(name)
+	if item, ok := q.ready.index[id]; ok {
+		return item.score, true
+	}
+	if _, ok := q.inflight.index[id]; ok {
+		return float64(q.jobs[id].DueAt), true
+	}
+	return 0, false
+}
+
+type delayItem struct {
+	member string
+	score  float64
+	pos    int
+}
+
+//按score排序的最小堆，score相同时与redis一致按member排序
+type delayHeap struct {
+	items []*delayItem
+	index map[string]*delayItem
+}
+
+func newDelayHeap() *delayHeap {
+	return &delayHeap{index: make(map[string]*delayItem)}
+}
+
+func (h *delayHeap) set(member string, score float64) {
+	if item, ok := h.index[member]; ok {
+		item.score = score
+		heap.Fix(h, item.pos)
+		return
+	}
+	heap.Push(h, &delayItem{member: member, score: score})
+}
+
+func (h *delayHeap) remove(member string) bool {
+	item, ok := h.index[member]
+	if !ok {
+		return false
+	}
+	heap.Remove(h, item.pos)
+	return true
+}
+
+func (h *delayHeap) due(now float64) bool {
+	return len(h.items) != 0 && h.items[0].score <= now
+}
+
+func (h *delayHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *delayHeap) Less(i, j int) bool {
+	if h.items[i].score == h.items[j].score {
+		return h.items[i].member < h.items[j].member
+	}
+	return h.items[i].score < h.items[j].score
+}
+
+func (h *delayHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].pos = i
+	h.items[j].pos = j
+}
+
+func (h *delayHeap) Push(x interface{}) {
+	item := x.(*delayItem)
+	item.pos = len(h.items)
+	h.items = append(h.items, item)
+	h.index[item.member] = item
+}
+
+func (h *delayHeap) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items[n-1] = nil
+	h.items = h.items[:n-1]
+	delete(h.index, item.member)
+	return item
+}
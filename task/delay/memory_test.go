@@ -0,0 +1,100 @@
+package delay
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_Claim(t *testing.T) {
+	s := newMemoryStore()
+	_ = s.push(&Job{ID: "order_3", Name: "talk_order", DueAt: 3})
+	_ = s.push(&Job{ID: "order_1", Name: "talk_order", DueAt: 1})
+	_ = s.push(&Job{ID: "order_2", Name: "talk_order", DueAt: 2})
+
+	if jobs, _ := s.claim("talk_order", 0, 10, time.Second); len(jobs) != 0 {
+		t.Fatal("should not claim before due")
+	}
+
+	jobs, _ := s.claim("talk_order", 2, 10, time.Second)
+	if len(jobs) != 2 || jobs[0].ID != "order_1" || jobs[1].ID != "order_2" {
+		t.Fatalf("want order_1 and order_2, got %v", jobs)
+	}
+
+	jobs, _ = s.claim("talk_order", 10, 1, time.Second)
+	if len(jobs) != 1 || jobs[0].ID != "order_3" {
+		t.Fatalf("want order_3, got %v", jobs)
+	}
+}
+
+func TestMemoryStore_Lease(t *testing.T) {
+	s := newMemoryStore()
+	_ = s.push(&Job{ID: "order_a", Name: "sell_order", DueAt: 1})
+
+	jobs, _ := s.claim("sell_order", 1, 10, 10*time.Millisecond)
+	if len(jobs) != 1 {
+		t.Fatal("want 1 job")
+	}
+
+	if jobs, _ := s.claim("sell_order", 5, 10, 10*time.Millisecond); len(jobs) != 0 {
+		t.Fatal("leased job should not be claimed again")
+	}
+	if score, ok := s.score("sell_order", "order_a"); !ok || score != 1 {
+		t.Fatalf("leased job should still exist, got %v %v", score, ok)
+	}
+
+	jobs, _ = s.claim("sell_order", 11, 10, 10*time.Millisecond)
+	if len(jobs) != 1 || jobs[0].ID != "order_a" {
+		t.Fatal("expired lease should be redelivered")
+	}
+
+	_ = s.ack(jobs[0])
+	if jobs, _ := s.claim("sell_order", 100, 10, 10*time.Millisecond); len(jobs) != 0 {
+		t.Fatal("acked job should be removed")
+	}
+}
+
+func TestMemoryStore_Cancel(t *testing.T) {
+	s := newMemoryStore()
+	_ = s.push(&Job{ID: "order_a", Name: "sell_order", DueAt: 5})
+	_ = s.push(&Job{ID: "order_a", Name: "sell_order", DueAt: 1})
+
+	if score, ok := s.score("sell_order", "order_a"); !ok || score != 1 {
+		t.Fatalf("want score 1, got %v", score)
+	}
+
+	if ok, _ := s.cancel("sell_order", "order_a"); !ok {
+		t.Fatal("cancel should find order_a")
+	}
+	if ok, _ := s.cancel("sell_order", "order_a"); ok {
+		t.Fatal("order_a has been canceled")
+	}
+	if jobs, _ := s.claim("sell_order", 10, 10, time.Second); len(jobs) != 0 {
+		t.Fatal("canceled job should not be claimed")
+	}
+}
+
+func TestMemoryStore_StaleAck(t *testing.T) {
+	s := newMemoryStore()
+	_ = s.push(&Job{ID: "order_a", Name: "sell_order", Payload: []byte(`"old"`), DueAt: 1})
+	old, _ := s.claim("sell_order", 1, 10, time.Second)
+
+	//执行中以相同id重新加入
+	_ = s.push(&Job{ID: "order_a", Name: "sell_order", Payload: []byte(`"new"`), DueAt: 2})
+	_ = s.ack(old[0])
+
+	jobs, _ := s.claim("sell_order", 2, 10, time.Second)
+	if len(jobs) != 1 || string(jobs[0].Payload) != `"new"` {
+		t.Fatalf("re-pushed job should survive stale ack, got %v", jobs)
+	}
+
+	//租约过期后被再次领取，旧租约的重试不生效
+	again, _ := s.claim("sell_order", 2000, 10, time.Second)
+	_ = s.retry(jobs[0], 5000)
+	if _, ok := s.queue("sell_order").ready.index["order_a"]; ok {
+		t.Fatal("stale retry should not requeue")
+	}
+	_ = s.ack(again[0])
+	if jobs, _ := s.claim("sell_order", 10000, 10, time.Second); len(jobs) != 0 {
+		t.Fatal("acked job should be removed")
+	}
+}
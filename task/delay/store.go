@@ -0,0 +1,198 @@
+package delay
+
+import (
+	"encoding/json"
+	"github.com/Jarnpher553/gemini/redis"
+	REDIS "github.com/go-redis/redis/v7"
+	"strconv"
+	"time"
+)
+
+//延时任务存储
+type store interface {
+	push(job *Job) error
+	claim(name string, now int64, limit int, lease time.Duration) ([]*Job, error)
+	ack(job *Job) error
+	retry(job *Job, at int64) error
+	bury(job *Job, now int64) error
+	cancel(name string, id string) (bool, error)
+	//待执行或已领取未确认的任务的到期时间
+	score(name string, id string) (float64, bool)
+}
+
+func inflightKey(name string) string {
+	return name + ":inflight"
+}
+
+func jobsKey(name string) string {
+	return name + ":jobs"
+}
+
+func deadKey(name string) string {
+	return name + ":dead"
+}
+
+//先将租约过期的任务放回待执行集合，再批量领取到期任务并写入租约集合
+//返回 id, 到期时间, 负载 三元组列表
+var claimScript = REDIS.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(expired) do
+	redis.call('ZREM', KEYS[2], id)
+	redis.call('ZADD', KEYS[1], ARGV[1], id)
+end
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'WITHSCORES', 'LIMIT', 0, ARGV[2])
+local out = {}
+for i = 1, #due, 2 do
+	local id = due[i]
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('ZADD', KEYS[2], ARGV[3], id)
+	local payload = redis.call('HGET', KEYS[3], id)
+	if not payload then
+		payload = ''
+	end
+	table.insert(out, id)
+	table.insert(out, due[i + 1])
+	table.insert(out, payload)
+end
+return out
+`)
+
+//仅当任务仍持有本次领取的租约时才删除负载，任务以相同id重新加入或租约过期被再次领取时不做处理
+var ackScript = REDIS.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score or tonumber(score) ~= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+return 1
+`)
+
+//仅当任务仍持有本次领取的租约时才放回待执行集合，避免复活已取消的任务
+var retryScript = REDIS.NewScript(`
+local score = redis.call('ZSCORE', KEYS[2], ARGV[1])
+if not score or tonumber(score) ~= tonumber(ARGV[4]) then
+	return 0
+end
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('HSET', KEYS[3], ARGV[1], ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1
+`)
+
+var buryScript = REDIS.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score or tonumber(score) ~= tonumber(ARGV[4]) then
+	return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HSET', KEYS[3], ARGV[1], ARGV[3])
+redis.call('ZADD', KEYS[2], ARGV[2], ARGV[1])
+return 1
+`)
+
+//基于redis有序集合的存储
+type redisStore struct {
+	client *redis.RdClient
+}
+
+func newRedisStore(client *redis.RdClient) *redisStore {
+	return &redisStore{client: client}
+}
+
+func (s *redisStore) push(job *Job) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(func(pipe REDIS.Pipeliner) error {
+		pipe.HSet(jobsKey(job.Name), job.ID, b)
+		pipe.ZRem(inflightKey(job.Name), job.ID)
+		pipe.ZAdd(job.Name, &REDIS.Z{Score: float64(job.DueAt), Member: job.ID})
+		return nil
+	})
+	return err
+}
+
+func (s *redisStore) claim(name string, now int64, limit int, lease time.Duration) ([]*Job, error) {
+	keys := []string{name, inflightKey(name), jobsKey(name)}
+	until := now + int64(lease/time.Millisecond)
+	ret, err := claimScript.Run(s.client.Client, keys, now, limit, until).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values, _ := ret.([]interface{})
+	jobs := make([]*Job, 0, len(values)/3)
+	for i := 0; i+2 < len(values); i += 3 {
+		id, _ := values[i].(string)
+		score, _ := values[i+1].(string)
+		payload, _ := values[i+2].(string)
+
+		dueAt, _ := strconv.ParseFloat(score, 64)
+		job := &Job{}
+		if payload == "" || json.Unmarshal([]byte(payload), job) != nil {
+			//旧版本直接写入有序集合的成员，成员即负载
+			job.Payload, _ = json.Marshal(id)
+		}
+		job.ID = id
+		job.Name = name
+		job.DueAt = int64(dueAt)
+		job.lease = until
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (s *redisStore) ack(job *Job) error {
+	keys := []string{inflightKey(job.Name), jobsKey(job.Name)}
+	return ackScript.Run(s.client.Client, keys, job.ID, job.lease).Err()
+}
+
+func (s *redisStore) retry(job *Job, at int64) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	keys := []string{job.Name, inflightKey(job.Name), jobsKey(job.Name)}
+	return retryScript.Run(s.client.Client, keys, job.ID, at, b, job.lease).Err()
+}
+
+func (s *redisStore) bury(job *Job, now int64) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	keys := []string{inflightKey(job.Name), deadKey(job.Name), jobsKey(job.Name)}
+	return buryScript.Run(s.client.Client, keys, job.ID, now, b, job.lease).Err()
+}
+
+func (s *redisStore) cancel(name string, id string) (bool, error) {
+	var ready, inflight *REDIS.IntCmd
+	_, err := s.client.TxPipelined(func(pipe REDIS.Pipeliner) error {
+		ready = pipe.ZRem(name, id)
+		inflight = pipe.ZRem(inflightKey(name), id)
+		pipe.HDel(jobsKey(name), id)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return ready.Val()+inflight.Val() > 0, nil
+}
+
+func (s *redisStore) score(name string, id string) (float64, bool) {
+	score, err := s.client.ZScore(name, id).Result()
+	if err == nil {
+		return score, true
+	}
+	//已被领取正在执行的任务，到期时间取自负载
+	if _, err := s.client.ZScore(inflightKey(name), id).Result(); err != nil {
+		return 0, false
+	}
+	job := &Job{}
+	if b, err := s.client.Client.HGet(jobsKey(name), id).Bytes(); err == nil {
+		_ = json.Unmarshal(b, job)
+	}
+	return float64(job.DueAt), true
+}
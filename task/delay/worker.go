@@ -0,0 +1,227 @@
+package delay
+
+import (
+	"context"
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/tracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/rcrowley/go-metrics"
+	"go.uber.org/zap"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+//任务执行者配置
+type WorkerOption func(*worker)
+
+//并发执行数
+func Concurrency(n int) WorkerOption {
+	return func(w *worker) {
+		w.concurrency = n
+	}
+}
+
+//单次领取的最大任务数
+func BatchSize(n int) WorkerOption {
+	return func(w *worker) {
+		w.batchSize = n
+	}
+}
+
+//租约时长，超时未确认的任务会被重新投递
+func Lease(d time.Duration) WorkerOption {
+	return func(w *worker) {
+		w.lease = d
+	}
+}
+
+//轮询间隔
+func PollInterval(d time.Duration) WorkerOption {
+	return func(w *worker) {
+		w.pollInterval = d
+	}
+}
+
+//最大重试次数，超过后转入死信集合
+func MaxRetry(n int) WorkerOption {
+	return func(w *worker) {
+		w.maxRetry = n
+	}
+}
+
+//重试退避基数，第n次重试延后n倍
+func Backoff(d time.Duration) WorkerOption {
+	return func(w *worker) {
+		w.backoff = d
+	}
+}
+
+//任务执行者，每个任务名称一个
+type worker struct {
+	name         string
+	handler      Handler
+	concurrency  int
+	batchSize    int
+	lease        time.Duration
+	pollInterval time.Duration
+	maxRetry     int
+	backoff      time.Duration
+
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	metrics *workerMetrics
+	logger  *log.ZapLogger
+}
+
+//任务指标
+type workerMetrics struct {
+	lag       metrics.Histogram
+	duration  metrics.Timer
+	processed metrics.Counter
+	failed    metrics.Counter
+	retried   metrics.Counter
+	dead      metrics.Counter
+}
+
+func newWorker(name string, handler Handler, options ...WorkerOption) *worker {
+	w := &worker{
+		name:         name,
+		handler:      handler,
+		concurrency:  10,
+		batchSize:    100,
+		lease:        30 * time.Second,
+		pollInterval: 100 * time.Millisecond,
+		maxRetry:     3,
+		backoff:      time.Second,
+		logger:       &log.ZapLogger{Logger: delay.logger.With(zap.String("task", name))},
+	}
+
+	for _, op := range options {
+		op(w)
+	}
+
+	w.sem = make(chan struct{}, w.concurrency)
+	w.metrics = &workerMetrics{
+		lag:       metrics.GetOrRegisterHistogram(name+".lag", registry, metrics.NewExpDecaySample(1028, 0.015)),
+		duration:  metrics.GetOrRegisterTimer(name+".duration", registry),
+		processed: metrics.GetOrRegisterCounter(name+".processed", registry),
+		failed:    metrics.GetOrRegisterCounter(name+".failed", registry),
+		retried:   metrics.GetOrRegisterCounter(name+".retried", registry),
+		dead:      metrics.GetOrRegisterCounter(name+".dead", registry),
+	}
+	return w
+}
+
+func (w *worker) run(ctx context.Context) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		claimed := 0
+		if free := w.concurrency - len(w.sem); free > 0 {
+			limit := w.batchSize
+			if free < limit {
+				limit = free
+			}
+
+			now := time.Now().UnixNano() / 1e6
+			jobs, err := delay.store.claim(w.name, now, limit, w.lease)
+			if err != nil {
+				w.logger.Error(log.Message("claim error:", err))
+			}
+
+			for _, job := range jobs {
+				w.metrics.lag.Update(now - job.DueAt)
+				w.sem <- struct{}{}
+				w.wg.Add(1)
+				go w.execute(job)
+			}
+			claimed = len(jobs)
+		}
+
+		//领取满一批时立即继续领取
+		if claimed != 0 && claimed == w.batchSize {
+			select {
+			case <-ctx.Done():
+				w.wg.Wait()
+				w.logger.Info(log.Message(w.name, "stopped"))
+				return
+			default:
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			w.wg.Wait()
+			w.logger.Info(log.Message(w.name, "stopped"))
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *worker) execute(job *Job) {
+	defer func() {
+		<-w.sem
+		w.wg.Done()
+	}()
+
+	begin := time.Now()
+	err := w.handle(job)
+	w.metrics.duration.UpdateSince(begin)
+
+	if err == nil {
+		w.metrics.processed.Inc(1)
+		if err := delay.store.ack(job); err != nil {
+			w.logger.Error(log.Message("ack error:", err), zap.String("id", job.ID))
+		}
+		return
+	}
+
+	w.metrics.failed.Inc(1)
+	job.Attempts++
+	now := time.Now().UnixNano() / 1e6
+	if job.Attempts > w.maxRetry {
+		w.metrics.dead.Inc(1)
+		w.logger.Error(log.Message("job dead:", err), zap.String("id", job.ID), zap.Int("attempts", job.Attempts))
+		if err := delay.store.bury(job, now); err != nil {
+			w.logger.Error(log.Message("bury error:", err), zap.String("id", job.ID))
+		}
+		return
+	}
+
+	w.metrics.retried.Inc(1)
+	w.logger.Warn(log.Message("job failed:", err), zap.String("id", job.ID), zap.Int("attempts", job.Attempts))
+	at := now + int64(w.backoff/time.Millisecond)*int64(job.Attempts)
+	if err := delay.store.retry(job, at); err != nil {
+		w.logger.Error(log.Message("retry error:", err), zap.String("id", job.ID))
+	}
+}
+
+//停止时等待执行中的任务完成，因此不从停止信号派生上下文
+func (w *worker) handle(job *Job) (e error) {
+	span, ctx := tracing.StartFollowing(job.Trace, "delay "+w.name,
+		ext.SpanKindConsumer,
+		opentracing.Tag{Key: "job.id", Value: job.ID},
+		opentracing.Tag{Key: "job.attempts", Value: job.Attempts},
+	)
+	defer func() {
+		tracing.Finish(span, e)
+	}()
+
+	defer func() {
+		if err := recover(); err != nil {
+			e = fmt.Errorf("%v", err)
+			w.logger.Error(log.Messagef("err info: %s, track: %s", e, string(debug.Stack())))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, w.lease)
+	defer cancel()
+
+	return w.handler(ctx, job, delay.options)
+}
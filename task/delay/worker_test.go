@@ -0,0 +1,81 @@
+package delay
+
+import (
+	"context"
+	"errors"
+	"github.com/Jarnpher553/gemini/task"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorker_Retry(t *testing.T) {
+	delay.store = newMemoryStore()
+
+	var attempts int32
+	done := make(chan string, 1)
+	w := newWorker("retry_order", func(ctx context.Context, job *Job, opt *task.Options) error {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			return errors.New("not ready")
+		}
+		var payload map[string]string
+		_ = job.Bind(&payload)
+		done <- payload["order"]
+		return nil
+	}, PollInterval(5*time.Millisecond), Backoff(time.Millisecond), MaxRetry(5))
+	retried := w.metrics.retried.Count()
+
+	stop := start(w)
+	defer stop()
+
+	_ = EnqueueWithID("retry_order", "1", 0, map[string]string{"order": "order_1"})
+
+	select {
+	case order := <-done:
+		if order != "order_1" {
+			t.Fatalf("want order_1, got %s", order)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("job timeout")
+	}
+
+	if c := w.metrics.retried.Count() - retried; c != 2 {
+		t.Fatalf("want 2 retries, got %d", c)
+	}
+}
+
+func TestWorker_Dead(t *testing.T) {
+	delay.store = newMemoryStore()
+
+	w := newWorker("dead_order", func(ctx context.Context, job *Job, opt *task.Options) error {
+		panic("boom")
+	}, PollInterval(5*time.Millisecond), Backoff(time.Millisecond), MaxRetry(1))
+	dead := w.metrics.dead.Count()
+
+	stop := start(w)
+	defer stop()
+
+	_, _ = Enqueue("dead_order", 0, "order_1")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for w.metrics.dead.Count()-dead != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("job should be buried")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func start(w *worker) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		w.run(ctx)
+		close(stopped)
+	}()
+
+	return func() {
+		cancel()
+		<-stopped
+	}
+}
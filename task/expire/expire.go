@@ -4,21 +4,109 @@ import (
 	"context"
 	"github.com/Jarnpher553/gemini/log"
 	"github.com/Jarnpher553/gemini/task"
+	"path"
 	"strings"
 	"sync"
+	"time"
 )
 
 //失效任务实例
-var exp = &Expire{handles: make(map[string]task.Handle), m: &sync.Mutex{}, options: &task.Options{}, logger: log.Zap.Mark("taskExpire")}
+var exp = &Expire{m: &sync.Mutex{}, options: &task.Options{}, conf: &Configuration{db: -1, schedule: "expire:schedule", lockTTL: 10 * time.Second, interval: time.Minute, grace: 30 * time.Second}, logger: log.Zap.Mark("taskExpire")}
 
 //失效任务
 type Expire struct {
-	options *task.Options
-	handles map[string]task.Handle
-	m       *sync.Mutex
-	stop    context.Context
-	cancel  context.CancelFunc
-	logger  *log.ZapLogger
+	options  *task.Options
+	conf     *Configuration
+	source   source
+	matchers []*matcher
+	m        *sync.Mutex
+	stop     context.Context
+	cancel   context.CancelFunc
+	logger   *log.ZapLogger
+}
+
+//失效任务配置
+type Configuration struct {
+	db        int
+	allDB     bool
+	exclusive bool
+	lockTTL   time.Duration
+	fallback  bool
+	schedule  string
+	interval  time.Duration
+	grace     time.Duration
+	notify    bool
+}
+
+//配置项
+type Option func(*Configuration)
+
+//订阅的数据库，默认为redis客户端所用数据库
+func DB(db int) Option {
+	return func(conf *Configuration) {
+		conf.db = db
+	}
+}
+
+//订阅所有数据库的失效事件
+func AllDB() Option {
+	return func(conf *Configuration) {
+		conf.allDB = true
+	}
+}
+
+//集群内每个失效事件只处理一次，通过redis锁实现
+func Exclusive(lockTTL time.Duration) Option {
+	return func(conf *Configuration) {
+		conf.exclusive = true
+		conf.lockTTL = lockTTL
+	}
+}
+
+//通过Join写入的键同时记录到有序集合，定期补偿停机期间遗漏的失效事件
+//interval 扫描间隔 grace 超过失效时间多久视为遗漏
+func Fallback(interval time.Duration, grace time.Duration) Option {
+	return func(conf *Configuration) {
+		conf.fallback = true
+		conf.interval = interval
+		conf.grace = grace
+	}
+}
+
+//补偿所用有序集合的键名
+func Schedule(key string) Option {
+	return func(conf *Configuration) {
+		conf.schedule = key
+	}
+}
+
+//启动时未开启键空间通知则自动开启
+func EnableNotify() Option {
+	return func(conf *Configuration) {
+		conf.notify = true
+	}
+}
+
+//失效任务匹配
+type matcher struct {
+	pattern string
+	glob    bool
+	handle  task.Handle
+}
+
+func (m *matcher) match(key string) bool {
+	if m.glob {
+		ok, _ := path.Match(m.pattern, key)
+		return ok
+	}
+	return strings.HasPrefix(key, m.pattern)
+}
+
+//配置失效任务，需在Bind前调用
+func Configure(options ...Option) {
+	for _, op := range options {
+		op(exp.conf)
+	}
 }
 
 //绑定配置并运行
@@ -29,44 +117,73 @@ func Bind(autoRun bool, options ...task.Option) {
 	}
 	exp.stop = ctx
 	exp.cancel = cancel
+
+	if exp.options.Memory {
+		exp.source = newMemorySource()
+	} else {
+		exp.source = newRedisSource(exp.options.Redis, exp.conf, exp.logger)
+	}
+
 	if autoRun {
 		Run()
 	}
 }
 
-//分配失效任务
+//分配失效任务，按前缀匹配失效的键
 func Assign(name string, handle task.Handle) *Expire {
+	return assign(&matcher{pattern: name, handle: handle})
+}
+
+//分配失效任务，按通配符匹配失效的键，规则同path.Match
+func AssignGlob(pattern string, handle task.Handle) *Expire {
+	return assign(&matcher{pattern: pattern, glob: true, handle: handle})
+}
+
+func assign(m *matcher) *Expire {
 	exp.m.Lock()
-	exp.handles[name] = handle
+	exp.matchers = append(exp.matchers, m)
 	exp.m.Unlock()
 	return exp
 }
 
+//按分配顺序返回第一个匹配的任务
+func match(key string) *matcher {
+	exp.m.Lock()
+	defer exp.m.Unlock()
+
+	for _, m := range exp.matchers {
+		if m.match(key) {
+			return m
+		}
+	}
+	return nil
+}
+
 //执行任务
 func Run() {
-	pubSub := exp.options.Redis.PSubscribe("__keyevent@*__:expired")
-	ch := pubSub.Channel()
+	ch := exp.source.expired(exp.stop)
 
 	go func() {
-	For:
 		for {
 			select {
-			case msg := <-ch:
-				for k := range exp.handles {
-					if strings.Contains(msg.Payload, k) {
-						exp.handles[k](msg.Payload, exp.options)
-						break
-					}
+			case key := <-ch:
+				//忽略本包独占锁过期产生的事件
+				if strings.HasPrefix(key, lockPrefix) {
+					continue
+				}
+				m := match(key)
+				if m == nil || !exp.source.claim(key) {
+					continue
 				}
+				m.handle(key, exp.options)
 			case <-exp.stop.Done():
-				for k := range exp.handles {
-					exp.logger.Info(log.Message(k, "stopped"))
+				exp.m.Lock()
+				for _, m := range exp.matchers {
+					exp.logger.Info(log.Message(m.pattern, "stopped"))
 				}
-				break For
-			default:
-
+				exp.m.Unlock()
+				return
 			}
-
 		}
 	}()
 }
@@ -74,3 +191,8 @@ func Run() {
 func Stop() {
 	exp.cancel()
 }
+
+//写入带过期时间的键，过期后触发对应任务
+func Join(key string, duration time.Duration) {
+	exp.source.join(key, duration)
+}
@@ -38,3 +38,34 @@ func TestExpire_Run(t *testing.T) {
 	Stop()
 	<-time.After(10 * time.Second)
 }
+
+func TestRun_Once(t *testing.T) {
+	exp.matchers = nil
+	Bind(false, task.Memory())
+	defer Stop()
+
+	got := make(chan string, 10)
+	AssignGlob("*", func(payload interface{}, opt *task.Options) {
+		got <- payload.(string)
+	})
+	Run()
+
+	Join(lockPrefix+"talk_order_1", 5*time.Millisecond)
+	Join("talk_order_1", 10*time.Millisecond)
+	Join("talk_order_1", 20*time.Millisecond)
+
+	select {
+	case key := <-got:
+		if key != "talk_order_1" {
+			t.Fatalf("want talk_order_1, got %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run timeout")
+	}
+
+	select {
+	case key := <-got:
+		t.Fatalf("key should be dispatched once, got %s", key)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,235 @@
+package expire
+
+import (
+	"context"
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/redis"
+	REDIS "github.com/go-redis/redis/v7"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//失效事件来源
+type source interface {
+	join(key string, duration time.Duration)
+	expired(ctx context.Context) <-chan string
+	claim(key string) bool
+}
+
+//PTTL的返回值，键存在但未设置过期时间为-1，键不存在为-2
+const (
+	ttlPersist = time.Duration(-1)
+	ttlMissing = time.Duration(-2)
+)
+
+//独占模式下锁的键前缀，锁过期同样会产生失效事件，需在分发时过滤
+const lockPrefix = "expire:lock:"
+
+//获取锁并移出补偿集合，获取失败说明已被集群内其它实例处理
+var claimScript = REDIS.NewScript(`
+if redis.call('SET', KEYS[2], 1, 'NX', 'PX', ARGV[2]) then
+	redis.call('ZREM', KEYS[1], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+//基于redis键空间通知的来源
+type redisSource struct {
+	client *redis.RdClient
+	conf   *Configuration
+	logger *log.ZapLogger
+	ch     chan string
+	once   sync.Once
+}
+
+func newRedisSource(client *redis.RdClient, conf *Configuration, logger *log.ZapLogger) *redisSource {
+	return &redisSource{client: client, conf: conf, logger: logger, ch: make(chan string, 100)}
+}
+
+func (s *redisSource) join(key string, duration time.Duration) {
+	if !s.conf.fallback {
+		s.client.Set(key, 1, duration)
+		return
+	}
+
+	_, err := s.client.TxPipelined(func(pipe REDIS.Pipeliner) error {
+		pipe.Set(key, 1, duration)
+		pipe.ZAdd(s.conf.schedule, &REDIS.Z{Score: float64(time.Now().Add(duration).UnixNano() / 1e6), Member: key})
+		return nil
+	})
+	if err != nil {
+		s.logger.Error(log.Message("join error:", err))
+	}
+}
+
+func (s *redisSource) channel() string {
+	if s.conf.allDB {
+		return "__keyevent@*__:expired"
+	}
+
+	db := s.conf.db
+	if db < 0 {
+		db = s.client.Options().DB
+	}
+	return fmt.Sprintf("__keyevent@%d__:expired", db)
+}
+
+func (s *redisSource) expired(ctx context.Context) <-chan string {
+	s.once.Do(func() {
+		s.checkNotify()
+
+		pubSub := s.client.PSubscribe(s.channel())
+		go func() {
+			<-ctx.Done()
+			_ = pubSub.Close()
+		}()
+		go func() {
+			for msg := range pubSub.Channel() {
+				s.ch <- msg.Payload
+			}
+		}()
+
+		if s.conf.fallback {
+			go s.reconcile(ctx)
+		}
+	})
+	return s.ch
+}
+
+//检查键空间通知是否开启，需包含E与x（或A）
+func (s *redisSource) checkNotify() {
+	ret, err := s.client.ConfigGet("notify-keyspace-events").Result()
+	if err != nil {
+		s.logger.Warn(log.Message("can not get notify-keyspace-events:", err))
+		return
+	}
+
+	var flags string
+	if len(ret) == 2 {
+		flags, _ = ret[1].(string)
+	}
+	if strings.Contains(flags, "E") && (strings.Contains(flags, "x") || strings.Contains(flags, "A")) {
+		return
+	}
+
+	if !s.conf.notify {
+		s.logger.Error(log.Messagef("notify-keyspace-events is %q, expired events will not be received, set it to \"Ex\"", flags))
+		return
+	}
+
+	if !strings.Contains(flags, "E") {
+		flags += "E"
+	}
+	if err := s.client.ConfigSet("notify-keyspace-events", flags+"x").Err(); err != nil {
+		s.logger.Error(log.Message("can not enable notify-keyspace-events:", err))
+	}
+}
+
+//扫描补偿集合中已过期却未处理的键
+func (s *redisSource) reconcile(ctx context.Context) {
+	ticker := time.NewTicker(s.conf.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		max := time.Now().Add(-s.conf.grace).UnixNano() / 1e6
+		keys, err := s.client.ZRangeByScore(s.conf.schedule, &REDIS.ZRangeBy{Min: "-inf", Max: strconv.FormatInt(max, 10), Count: 100}).Result()
+		if err != nil {
+			s.logger.Error(log.Message("reconcile error:", err))
+			continue
+		}
+
+		for _, key := range keys {
+			ttl, err := s.client.PTTL(key).Result()
+			if err != nil {
+				continue
+			}
+			//键被重新设置了过期时间，同步补偿集合
+			if ttl > 0 {
+				s.client.ZAdd(s.conf.schedule, &REDIS.Z{Score: float64(time.Now().Add(ttl).UnixNano() / 1e6), Member: key})
+				continue
+			}
+			//键被PERSIST，不会再失效，移出补偿集合
+			if ttl == ttlPersist {
+				s.client.ZRem(s.conf.schedule, key)
+				continue
+			}
+			//只有键已不存在才视为失效
+			if ttl != ttlMissing {
+				continue
+			}
+			//非独占模式下由移出成功的实例补偿
+			if !s.conf.exclusive && s.client.ZRem(s.conf.schedule, key).Val() == 0 {
+				continue
+			}
+			s.ch <- key
+		}
+	}
+}
+
+func (s *redisSource) claim(key string) bool {
+	if !s.conf.exclusive {
+		if s.conf.fallback {
+			s.client.ZRem(s.conf.schedule, key)
+		}
+		return true
+	}
+
+	keys := []string{s.conf.schedule, lockPrefix + key}
+	ok, err := claimScript.Run(s.client.Client, keys, key, int64(s.conf.lockTTL/time.Millisecond)).Int()
+	if err != nil {
+		s.logger.Error(log.Message("claim error:", err))
+		return false
+	}
+	return ok == 1
+}
+
+//基于定时器的进程内来源，用于测试
+type memorySource struct {
+	m      sync.Mutex
+	timers map[string]*time.Timer
+	ch     chan string
+}
+
+func newMemorySource() *memorySource {
+	return &memorySource{timers: make(map[string]*time.Timer), ch: make(chan string, 100)}
+}
+
+func (s *memorySource) join(key string, duration time.Duration) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if t, ok := s.timers[key]; ok {
+		t.Stop()
+	}
+	var t *time.Timer
+	t = time.AfterFunc(duration, func() {
+		s.m.Lock()
+		if s.timers[key] != t {
+			s.m.Unlock()
+			return
+		}
+		delete(s.timers, key)
+		s.m.Unlock()
+
+		s.ch <- key
+	})
+	s.timers[key] = t
+}
+
+func (s *memorySource) expired(ctx context.Context) <-chan string {
+	return s.ch
+}
+
+func (s *memorySource) claim(key string) bool {
+	return true
+}
@@ -0,0 +1,123 @@
+package expire
+
+import (
+	"context"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/redis"
+	"github.com/alicebob/miniredis/v2"
+	REDIS "github.com/go-redis/redis/v7"
+	"testing"
+	"time"
+)
+
+func TestMemorySource_Join(t *testing.T) {
+	s := newMemorySource()
+	s.join("talk_order_1", 50*time.Millisecond)
+	s.join("talk_order_2", 10*time.Millisecond)
+	s.join("talk_order_1", 100*time.Millisecond)
+
+	for _, want := range []string{"talk_order_2", "talk_order_1"} {
+		select {
+		case key := <-s.expired(context.Background()):
+			if key != want {
+				t.Fatalf("want %s, got %s", want, key)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expire timeout")
+		}
+	}
+
+	select {
+	case key := <-s.expired(context.Background()):
+		t.Fatalf("rejoined key should expire once, got %s", key)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	prefix := &matcher{pattern: "talk_order"}
+	glob := &matcher{pattern: "order:*:paid", glob: true}
+
+	cases := []struct {
+		m    *matcher
+		key  string
+		want bool
+	}{
+		{prefix, "talk_order_1", true},
+		{prefix, "sell_talk_order_1", false},
+		{glob, "order:1:paid", true},
+		{glob, "order:1:unpaid", false},
+		{glob, "order:1:2:paid", true},
+	}
+
+	for _, c := range cases {
+		if got := c.m.match(c.key); got != c.want {
+			t.Errorf("%s match %s: want %v, got %v", c.m.pattern, c.key, c.want, got)
+		}
+	}
+}
+
+func TestRedisSource_ClaimExclusive(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rd := redis.New(redis.Addr(mr.Addr()))
+	conf := &Configuration{exclusive: true, lockTTL: time.Second, fallback: true, schedule: "expire:schedule"}
+	a := newRedisSource(rd, conf, log.Zap.Mark("test"))
+	b := newRedisSource(rd, conf, log.Zap.Mark("test"))
+
+	rd.ZAdd(conf.schedule, &REDIS.Z{Score: 1, Member: "talk_order_1"})
+	if !a.claim("talk_order_1") {
+		t.Fatal("first claim should succeed")
+	}
+	if b.claim("talk_order_1") {
+		t.Fatal("key should be claimed only once in exclusive mode")
+	}
+	if _, err := rd.ZScore(conf.schedule, "talk_order_1").Result(); err != REDIS.Nil {
+		t.Fatal("claimed key should be removed from schedule")
+	}
+
+	mr.FastForward(2 * time.Second)
+	if !b.claim("talk_order_1") {
+		t.Fatal("claim should succeed after lock expired")
+	}
+}
+
+func TestRedisSource_Reconcile(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rd := redis.New(redis.Addr(mr.Addr()))
+	conf := &Configuration{fallback: true, schedule: "expire:schedule", interval: 10 * time.Millisecond}
+	s := newRedisSource(rd, conf, log.Zap.Mark("test"))
+
+	rd.Set("talk_order_persist", 1, 0)
+	rd.Set("talk_order_later", 1, time.Hour)
+	rd.ZAdd(conf.schedule,
+		&REDIS.Z{Score: 1, Member: "talk_order_persist"},
+		&REDIS.Z{Score: 1, Member: "talk_order_later"},
+		&REDIS.Z{Score: 1, Member: "talk_order_gone"},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.reconcile(ctx)
+
+	select {
+	case key := <-s.ch:
+		if key != "talk_order_gone" {
+			t.Fatalf("only missing key should be dispatched, got %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reconcile timeout")
+	}
+
+	select {
+	case key := <-s.ch:
+		t.Fatalf("unexpected dispatch %s", key)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if _, err := rd.ZScore(conf.schedule, "talk_order_persist").Result(); err != REDIS.Nil {
+		t.Fatal("persisted key should be removed from schedule")
+	}
+	if score, _ := rd.ZScore(conf.schedule, "talk_order_later").Result(); score <= 1 {
+		t.Fatal("schedule should follow the new ttl")
+	}
+}
@@ -7,9 +7,10 @@ import (
 )
 
 type Options struct {
-	Redis *redis.RdClient
-	Repo  *repo.Repository
-	Mgo   *mongo.MgoClient
+	Redis  *redis.RdClient
+	Repo   *repo.Repository
+	Mgo    *mongo.MgoClient
+	Memory bool
 }
 
 //配置
@@ -36,5 +37,12 @@ func Mongo(mg *mongo.MgoClient) Option {
 	}
 }
 
+//使用进程内实现代替redis，用于测试
+func Memory() Option {
+	return func(opt *Options) {
+		opt.Memory = true
+	}
+}
+
 //处理程序
 type Handle func(interface{}, *Options)
\ No newline at end of file
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"errors"
+	"net"
+)
+
+var errNotSupported = errors.New("not supported by client buffer")
+
+// buffer 以net.Conn的读缓冲实现tcpserver.Conn，使服务端的ICodec可直接用于客户端
+type buffer struct {
+	conn net.Conn
+	data []byte
+	ctx  interface{}
+}
+
+func (b *buffer) write(p []byte) {
+	b.data = append(b.data, p...)
+}
+
+func (b *buffer) Context() interface{} {
+	return b.ctx
+}
+
+func (b *buffer) SetContext(ctx interface{}) {
+	b.ctx = ctx
+}
+
+func (b *buffer) LocalAddr() net.Addr {
+	return b.conn.LocalAddr()
+}
+
+func (b *buffer) RemoteAddr() net.Addr {
+	return b.conn.RemoteAddr()
+}
+
+func (b *buffer) Read() []byte {
+	return b.data
+}
+
+func (b *buffer) ResetBuffer() {
+	b.data = b.data[:0]
+}
+
+// ReadN 数据不足n字节时返回0，与解码器“数据不完整”的判断一致
+func (b *buffer) ReadN(n int) (int, []byte) {
+	if n <= 0 || len(b.data) < n {
+		return 0, nil
+	}
+	return n, b.data[:n]
+}
+
+func (b *buffer) ShiftN(n int) int {
+	if n > len(b.data) {
+		n = len(b.data)
+	}
+	b.data = b.data[n:]
+	return n
+}
+
+func (b *buffer) BufferLength() int {
+	return len(b.data)
+}
+
+func (b *buffer) SendTo(buf []byte) error {
+	return errNotSupported
+}
+
+func (b *buffer) AsyncWrite(buf []byte) error {
+	return errNotSupported
+}
+
+func (b *buffer) Wake() error {
+	return errNotSupported
+}
+
+func (b *buffer) Close() error {
+	return b.conn.Close()
+}
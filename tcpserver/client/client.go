@@ -0,0 +1,445 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/Jarnpher553/gemini/tcpserver"
+	errorset "github.com/panjf2000/gnet/errors"
+	"go.uber.org/zap"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrNotConnected 连接池中没有可用连接
+	ErrNotConnected = errors.New("not connected")
+	// ErrClosed 连接已断开，等待中的请求失败
+	ErrClosed = errors.New("connection closed")
+	// ErrNoSequence 未设置Sequence时无法匹配响应
+	ErrNoSequence = errors.New("request requires sequence")
+	// ErrShortFrame 帧长度不足，无法在固定偏移处写入序列号
+	ErrShortFrame = errors.New("frame is shorter than sequence offset")
+)
+
+// Client tcp客户端，维护固定数量的连接，断开后按退避间隔自动重连
+type Client struct {
+	addr         string
+	codec        tcpserver.ICodec
+	sequence     Sequence
+	size         int
+	dialTimeout  time.Duration
+	writeTimeout time.Duration
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	onConnect    func(c *Conn) error
+	onPush       func(frame []byte)
+	logger       *log.ZapLogger
+
+	conns  []*Conn
+	next   uint32
+	seq    uint32
+	closed chan struct{}
+	wg     sync.WaitGroup
+}
+
+// Option 配置函数
+type Option func(*Client)
+
+// Codec 帧编解码，与服务端保持一致，默认为tcpserver.BuiltInFrameCodec
+func Codec(codec tcpserver.ICodec) Option {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// WithSequence 设置序列号的读写方式，Request依赖此项匹配响应
+func WithSequence(sequence Sequence) Option {
+	return func(c *Client) {
+		c.sequence = sequence
+	}
+}
+
+// PoolSize 连接数，默认1
+func PoolSize(size int) Option {
+	return func(c *Client) {
+		c.size = size
+	}
+}
+
+// DialTimeout 建立连接超时，默认5s
+func DialTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.dialTimeout = d
+	}
+}
+
+// WriteTimeout 写超时，0表示不限制
+func WriteTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.writeTimeout = d
+	}
+}
+
+// Backoff 重连的最小与最大间隔，每次失败后翻倍，默认100ms至10s
+func Backoff(min, max time.Duration) Option {
+	return func(c *Client) {
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+// OnConnect 每次连接建立后回调，可用于发送认证帧，返回错误时断开重连
+func OnConnect(f func(c *Conn) error) Option {
+	return func(c *Client) {
+		c.onConnect = f
+	}
+}
+
+// OnPush 未匹配到请求的帧（服务端推送）回调
+func OnPush(f func(frame []byte)) Option {
+	return func(c *Client) {
+		c.onPush = f
+	}
+}
+
+// Dial 建立连接池，首次连接失败时返回错误
+func Dial(addr string, options ...Option) (*Client, error) {
+	c := &Client{
+		addr:        addr,
+		codec:       &tcpserver.BuiltInFrameCodec{},
+		size:        1,
+		dialTimeout: 5 * time.Second,
+		minBackoff:  100 * time.Millisecond,
+		maxBackoff:  10 * time.Second,
+		logger:      log.Zap.Mark("tcpclient"),
+		closed:      make(chan struct{}),
+	}
+	for _, op := range options {
+		op(c)
+	}
+
+	c.conns = make([]*Conn, c.size)
+	for i := range c.conns {
+		conn := &Conn{client: c, pending: make(map[uint32]chan result)}
+		if err := conn.connect(); err != nil {
+			for _, exist := range c.conns[:i] {
+				exist.close(err)
+			}
+			return nil, err
+		}
+		c.conns[i] = conn
+	}
+
+	for _, conn := range c.conns {
+		c.wg.Add(1)
+		go conn.keep()
+	}
+	return c, nil
+}
+
+// Send 发送一帧数据，不等待响应
+func (c *Client) Send(frame []byte) error {
+	conn, err := c.pick()
+	if err != nil {
+		return err
+	}
+	return conn.Send(frame)
+}
+
+// Request 写入序列号后发送，等待序列号相同的响应，返回去掉序列号的响应帧
+func (c *Client) Request(ctx context.Context, frame []byte) ([]byte, error) {
+	conn, err := c.pick()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Request(ctx, frame)
+}
+
+// Close 关闭所有连接并停止重连
+func (c *Client) Close() error {
+	select {
+	case <-c.closed:
+		return nil
+	default:
+	}
+
+	close(c.closed)
+	for _, conn := range c.conns {
+		conn.close(ErrClosed)
+	}
+	c.wg.Wait()
+	return nil
+}
+
+// pick 轮询选择一个已连接的连接
+func (c *Client) pick() (*Conn, error) {
+	n := uint32(len(c.conns))
+	start := atomic.AddUint32(&c.next, 1)
+	for i := uint32(0); i < n; i++ {
+		conn := c.conns[(start+i)%n]
+		if conn.connected() {
+			return conn, nil
+		}
+	}
+	return nil, ErrNotConnected
+}
+
+// result 响应或连接断开的错误
+type result struct {
+	frame []byte
+	err   error
+}
+
+// Conn 连接池中的一条连接
+type Conn struct {
+	client  *Client
+	m       sync.Mutex
+	wm      sync.Mutex
+	nc      net.Conn
+	done    chan struct{}
+	pending map[uint32]chan result
+}
+
+// Send 编码并发送一帧数据
+func (c *Conn) Send(frame []byte) error {
+	c.m.Lock()
+	nc := c.nc
+	c.m.Unlock()
+	if nc == nil {
+		return ErrNotConnected
+	}
+
+	out, err := c.client.codec.Encode(&buffer{conn: nc}, frame)
+	if err != nil {
+		return err
+	}
+
+	c.wm.Lock()
+	defer c.wm.Unlock()
+	if c.client.writeTimeout > 0 {
+		_ = nc.SetWriteDeadline(time.Now().Add(c.client.writeTimeout))
+	}
+	_, err = nc.Write(out)
+	return err
+}
+
+// Request 见Client.Request
+func (c *Conn) Request(ctx context.Context, frame []byte) ([]byte, error) {
+	if c.client.sequence == nil {
+		return nil, ErrNoSequence
+	}
+
+	seq := atomic.AddUint32(&c.client.seq, 1)
+	ch := make(chan result, 1)
+
+	c.m.Lock()
+	if c.nc == nil {
+		c.m.Unlock()
+		return nil, ErrNotConnected
+	}
+	c.pending[seq] = ch
+	c.m.Unlock()
+
+	defer func() {
+		c.m.Lock()
+		delete(c.pending, seq)
+		c.m.Unlock()
+	}()
+
+	frame, err := c.client.sequence.Put(seq, frame)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Send(frame); err != nil {
+		return nil, err
+	}
+
+	select {
+	case r := <-ch:
+		return r.frame, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// RemoteAddr 远端地址，未连接时为nil
+func (c *Conn) RemoteAddr() net.Addr {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.nc == nil {
+		return nil
+	}
+	return c.nc.RemoteAddr()
+}
+
+func (c *Conn) connected() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.nc != nil
+}
+
+func (c *Conn) connect() error {
+	nc, err := net.DialTimeout("tcp", c.client.addr, c.client.dialTimeout)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	c.m.Lock()
+	c.nc = nc
+	c.done = done
+	c.m.Unlock()
+
+	// OnConnect中可能发送请求，读循环需先启动
+	go c.read(nc, done)
+	if c.client.onConnect != nil {
+		if err := c.client.onConnect(c); err != nil {
+			c.closeConn(nc, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// keep 维持连接，断开后按退避间隔重连
+func (c *Conn) keep() {
+	defer c.client.wg.Done()
+
+	backoff := c.client.minBackoff
+	for {
+		c.m.Lock()
+		done := c.done
+		c.m.Unlock()
+
+		select {
+		case <-c.client.closed:
+			return
+		case <-done:
+		}
+
+		for {
+			select {
+			case <-c.client.closed:
+				return
+			case <-time.After(backoff):
+			}
+
+			err := c.connect()
+			if err == nil {
+				c.client.logger.Info(log.Message("reconnected"), zap.String("addr", c.client.addr))
+				backoff = c.client.minBackoff
+				break
+			}
+
+			c.client.logger.Warn(log.Message("reconnect error:", err), zap.String("addr", c.client.addr), zap.String("backoff", backoff.String()))
+			if backoff *= 2; backoff > c.client.maxBackoff {
+				backoff = c.client.maxBackoff
+			}
+		}
+	}
+}
+
+// read 读循环，解码出完整的帧后分发，出错时关闭连接
+func (c *Conn) read(nc net.Conn, done chan struct{}) {
+	defer close(done)
+
+	buf := &buffer{conn: nc}
+	chunk := make([]byte, 4096)
+	for {
+		n, err := nc.Read(chunk)
+		if n > 0 {
+			buf.write(chunk[:n])
+			if derr := c.decode(buf); derr != nil {
+				err = derr
+			}
+		}
+		if err != nil {
+			c.closeConn(nc, err)
+			return
+		}
+	}
+}
+
+func (c *Conn) decode(buf *buffer) error {
+	for buf.BufferLength() > 0 {
+		frame, err := c.client.codec.Decode(buf)
+		if err != nil {
+			if incomplete(err) {
+				return nil
+			}
+			return err
+		}
+		if frame == nil {
+			return nil
+		}
+		c.deliver(append([]byte{}, frame...))
+	}
+	return nil
+}
+
+func (c *Conn) deliver(frame []byte) {
+	if c.client.sequence != nil {
+		if seq, body, ok := c.client.sequence.Get(frame); ok {
+			c.m.Lock()
+			ch, ok := c.pending[seq]
+			c.m.Unlock()
+			if ok {
+				notify(ch, result{frame: body})
+				return
+			}
+		}
+	}
+
+	if c.client.onPush != nil {
+		c.client.onPush(frame)
+	}
+}
+
+func (c *Conn) close(err error) {
+	c.m.Lock()
+	nc := c.nc
+	c.m.Unlock()
+	if nc != nil {
+		c.closeConn(nc, err)
+	}
+}
+
+// closeConn 关闭nc并使等待中的请求失败，nc已被替换时忽略
+func (c *Conn) closeConn(nc net.Conn, err error) {
+	c.m.Lock()
+	if c.nc != nc {
+		c.m.Unlock()
+		return
+	}
+	c.nc = nil
+	pending := c.pending
+	c.pending = make(map[uint32]chan result)
+	c.m.Unlock()
+
+	_ = nc.Close()
+	for _, ch := range pending {
+		notify(ch, result{err: ErrClosed})
+	}
+
+	select {
+	case <-c.client.closed:
+	default:
+		c.client.logger.Warn(log.Message("connection closed:", err), zap.String("addr", c.client.addr))
+	}
+}
+
+// notify 每个请求只接收第一个结果
+func notify(ch chan result, r result) {
+	select {
+	case ch <- r:
+	default:
+	}
+}
+
+// incomplete 解码器因数据不完整返回的错误
+func incomplete(err error) bool {
+	return err == errorset.ErrUnexpectedEOF || err == errorset.ErrCRLFNotFound || err == errorset.ErrDelimiterNotFound
+}
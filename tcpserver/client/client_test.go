@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/Jarnpher553/gemini/tcpserver"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newCodec() tcpserver.ICodec {
+	return tcpserver.NewLengthFieldBasedFrameCodec(
+		tcpserver.EncoderConfig{ByteOrder: binary.BigEndian, LengthFieldLength: 4},
+		tcpserver.DecoderConfig{ByteOrder: binary.BigEndian, LengthFieldLength: 4, InitialBytesToStrip: 4},
+	)
+}
+
+// echoServer 回显每一帧，载荷为push时先推送一帧序列号为0的数据
+type echoServer struct {
+	ln    net.Listener
+	m     sync.Mutex
+	conns []net.Conn
+}
+
+func startEcho(t *testing.T) *echoServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &echoServer{ln: ln}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.m.Lock()
+			s.conns = append(s.conns, nc)
+			s.m.Unlock()
+			go s.serve(nc)
+		}
+	}()
+	return s
+}
+
+func (s *echoServer) serve(nc net.Conn) {
+	codec := newCodec()
+	buf := &buffer{conn: nc}
+	chunk := make([]byte, 1024)
+	for {
+		n, err := nc.Read(chunk)
+		if err != nil {
+			return
+		}
+		buf.write(chunk[:n])
+		for {
+			frame, err := codec.Decode(buf)
+			if err != nil {
+				break
+			}
+			if string(frame[4:]) == "push" {
+				out, _ := codec.Encode(buf, []byte{0, 0, 0, 0, 'h', 'i'})
+				_, _ = nc.Write(out)
+			}
+			out, _ := codec.Encode(buf, append([]byte{}, frame...))
+			_, _ = nc.Write(out)
+		}
+	}
+}
+
+// drop 断开所有已建立的连接
+func (s *echoServer) drop() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for _, nc := range s.conns {
+		_ = nc.Close()
+	}
+	s.conns = nil
+}
+
+func TestRequest(t *testing.T) {
+	s := startEcho(t)
+	defer s.ln.Close()
+
+	pushed := make(chan string, 1)
+	c, err := Dial(s.ln.Addr().String(),
+		Codec(newCodec()),
+		WithSequence(NewFixedSequence(binary.BigEndian, 0)),
+		PoolSize(2),
+		OnPush(func(frame []byte) {
+			pushed <- string(frame[4:])
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, body := range []string{"a", "b", "c", "d"} {
+		wg.Add(1)
+		go func(body string) {
+			defer wg.Done()
+			reply, err := c.Request(ctx, []byte(body))
+			if err != nil || string(reply) != body {
+				t.Errorf("want %s, got %s %v", body, reply, err)
+			}
+		}(body)
+	}
+	wg.Wait()
+
+	if _, err := c.Request(ctx, []byte("push")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-pushed:
+		if p != "hi" {
+			t.Fatalf("unexpected push %s", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("push timeout")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	s := startEcho(t)
+	defer s.ln.Close()
+
+	connected := make(chan struct{}, 4)
+	c, err := Dial(s.ln.Addr().String(),
+		Codec(newCodec()),
+		WithSequence(NewFixedSequence(binary.BigEndian, 0)),
+		Backoff(10*time.Millisecond, 50*time.Millisecond),
+		OnConnect(func(conn *Conn) error {
+			connected <- struct{}{}
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-connected
+
+	s.drop()
+	select {
+	case <-connected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("reconnect timeout")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if reply, err := c.Request(ctx, []byte("again")); err != nil || string(reply) != "again" {
+		t.Fatalf("unexpected reply %s %v", reply, err)
+	}
+}
+
+func TestFixedSequence(t *testing.T) {
+	s := NewFixedSequence(binary.LittleEndian, 2)
+	frame, err := s.Put(42, []byte{0x01, 0x02, 'b', 'o', 'd', 'y'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, body, ok := s.Get(frame)
+	if !ok || seq != 42 || string(body) != "\x01\x02body" {
+		t.Fatalf("unexpected result %d %q %v", seq, body, ok)
+	}
+	if _, _, ok := s.Get([]byte{1, 2, 3}); ok {
+		t.Fatal("short frame should not contain sequence")
+	}
+	if _, err := s.Put(1, []byte{1}); err != ErrShortFrame {
+		t.Fatalf("short frame should return error, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"encoding/binary"
+)
+
+// Sequence 在请求帧中写入序列号，并从响应帧中取出，用于请求与响应的匹配
+type Sequence interface {
+	Put(seq uint32, frame []byte) ([]byte, error)
+	Get(frame []byte) (seq uint32, body []byte, ok bool)
+}
+
+// FixedSequence 序列号为4字节，位于帧的固定偏移
+type FixedSequence struct {
+	byteOrder binary.ByteOrder
+	offset    int
+}
+
+// NewFixedSequence 构造函数，offset为序列号之前的字节数，例如命令号的长度
+func NewFixedSequence(byteOrder binary.ByteOrder, offset int) *FixedSequence {
+	return &FixedSequence{byteOrder: byteOrder, offset: offset}
+}
+
+// Put 在offset处插入序列号，frame长度小于offset时返回ErrShortFrame
+func (s *FixedSequence) Put(seq uint32, frame []byte) ([]byte, error) {
+	if len(frame) < s.offset {
+		return nil, ErrShortFrame
+	}
+	out := make([]byte, len(frame)+4)
+	copy(out, frame[:s.offset])
+	s.byteOrder.PutUint32(out[s.offset:], seq)
+	copy(out[s.offset+4:], frame[s.offset:])
+	return out, nil
+}
+
+// Get 取出offset处的序列号，返回去掉序列号后的帧
+func (s *FixedSequence) Get(frame []byte) (uint32, []byte, bool) {
+	if len(frame) < s.offset+4 {
+		return 0, nil, false
+	}
+	seq := s.byteOrder.Uint32(frame[s.offset:])
+	body := make([]byte, 0, len(frame)-4)
+	body = append(body, frame[:s.offset]...)
+	return seq, append(body, frame[s.offset+4:]...), true
+}
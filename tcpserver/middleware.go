@@ -0,0 +1,77 @@
+package tcpserver
+
+import (
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/rcrowley/go-metrics"
+	"go.uber.org/zap"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+// Logging 日志中间件，记录命令号与耗时
+func Logging() Middleware {
+	logger := log.Zap.Mark("tcpserver")
+	return func(next HandlerFunc) HandlerFunc {
+		return func(req *Request) error {
+			begin := time.Now()
+			err := next(req)
+
+			fields := []zap.Field{
+				zap.Uint32("cmd", req.Cmd),
+				zap.String("remote", remote(req.Conn)),
+				zap.Int("size", len(req.Body)),
+				zap.String("cost", time.Since(begin).String()),
+			}
+			if sess := req.Session(); sess != nil {
+				fields = append(fields, zap.String("session", sess.ID()))
+			}
+			if err != nil {
+				fields = append(fields, zap.String("error", err.Error()))
+			}
+			logger.Info("request", fields...)
+			return err
+		}
+	}
+}
+
+// Recovery 恢复处理函数中的panic并转换为错误
+func Recovery() Middleware {
+	logger := log.Zap.Mark("tcpserver")
+	return func(next HandlerFunc) HandlerFunc {
+		return func(req *Request) (e error) {
+			defer func() {
+				if err := recover(); err != nil {
+					e = fmt.Errorf("%v", err)
+					logger.Error(log.Messagef("err info: %s, track: %s", e, string(debug.Stack())))
+				}
+			}()
+			return next(req)
+		}
+	}
+}
+
+// Metrics 指标中间件，按命令号统计耗时与失败数，registry为nil时使用metrics.DefaultRegistry
+// 命令号由客户端发送，未注册的命令号统一记为tcpserver.unknown，避免指标数量无限增长
+func Metrics(registry metrics.Registry) Middleware {
+	if registry == nil {
+		registry = metrics.DefaultRegistry
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(req *Request) error {
+			begin := time.Now()
+			err := next(req)
+
+			cmd := "unknown"
+			if req.Registered() {
+				cmd = strconv.FormatUint(uint64(req.Cmd), 10)
+			}
+			metrics.GetOrRegisterTimer("tcpserver."+cmd+".duration", registry).UpdateSince(begin)
+			if err != nil {
+				metrics.GetOrRegisterCounter("tcpserver."+cmd+".failed", registry).Inc(1)
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package tcpserver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/panjf2000/gnet"
+	"go.uber.org/zap"
+	"reflect"
+	"sync"
+)
+
+var (
+	// ErrFrameTooShort 帧长度小于帧头
+	ErrFrameTooShort = errors.New("frame too short")
+	// ErrCommandNotFound 命令未注册
+	ErrCommandNotFound = errors.New("command not found")
+)
+
+// Header 帧头，从帧中解析命令号，回复时封装命令号
+type Header interface {
+	Parse(frame []byte) (cmd uint32, body []byte, err error)
+	Pack(cmd uint32, body []byte) []byte
+}
+
+// FixedHeader 以帧开头定长的无符号整数作为命令号
+type FixedHeader struct {
+	byteOrder binary.ByteOrder
+	length    int
+}
+
+// NewFixedHeader 构造函数，length只支持1、2、4
+func NewFixedHeader(byteOrder binary.ByteOrder, length int) *FixedHeader {
+	if length != 1 && length != 2 && length != 4 {
+		panic(fmt.Sprintf("unsupported header length %d", length))
+	}
+	return &FixedHeader{byteOrder: byteOrder, length: length}
+}
+
+func (h *FixedHeader) Parse(frame []byte) (uint32, []byte, error) {
+	if len(frame) < h.length {
+		return 0, nil, ErrFrameTooShort
+	}
+
+	var cmd uint32
+	switch h.length {
+	case 1:
+		cmd = uint32(frame[0])
+	case 2:
+		cmd = uint32(h.byteOrder.Uint16(frame))
+	case 4:
+		cmd = h.byteOrder.Uint32(frame)
+	}
+	return cmd, frame[h.length:], nil
+}
+
+func (h *FixedHeader) Pack(cmd uint32, body []byte) []byte {
+	buf := make([]byte, h.length, h.length+len(body))
+	switch h.length {
+	case 1:
+		buf[0] = byte(cmd)
+	case 2:
+		h.byteOrder.PutUint16(buf, uint16(cmd))
+	case 4:
+		h.byteOrder.PutUint32(buf, cmd)
+	}
+	return append(buf, body...)
+}
+
+// HandlerFunc 命令处理函数
+type HandlerFunc func(*Request) error
+
+// Middleware 中间件
+type Middleware func(HandlerFunc) HandlerFunc
+
+// Request 一条已解析命令号的请求
+type Request struct {
+	context.Context
+	Conn   Conn
+	Cmd    uint32
+	Body   []byte
+	router *Router
+	// registered 命令号是否已注册，未注册时由NotFound处理
+	registered bool
+}
+
+// Registered 命令号是否已注册
+func (r *Request) Registered() bool {
+	return r.registered
+}
+
+// Session 连接所属的会话，未使用SessionService时为nil
+func (r *Request) Session() *Session {
+	sess, _ := r.Conn.Context().(*Session)
+	return sess
+}
+
+// Bind 使用路由的Serializer解码消息体
+func (r *Request) Bind(v interface{}) error {
+	return r.router.serializer.Unmarshal(r.Body, v)
+}
+
+// Reply 异步回复，v为[]byte时原样发送，否则使用路由的Serializer编码
+func (r *Request) Reply(cmd uint32, v interface{}) error {
+	body, ok := v.([]byte)
+	if !ok {
+		var err error
+		if body, err = r.router.serializer.Marshal(v); err != nil {
+			return err
+		}
+	}
+	return r.Conn.AsyncWrite(r.router.header.Pack(cmd, body))
+}
+
+// Router 按命令号分发帧
+// 在EventService的React中调用Router.React，或作为SessionService的OnMessage使用
+type Router struct {
+	m          sync.RWMutex
+	header     Header
+	serializer Serializer
+	pool       *GoroutinePool
+	handlers   map[uint32]HandlerFunc
+	middleware []Middleware
+	notFound   HandlerFunc
+	logger     *log.ZapLogger
+}
+
+// RouterOption 路由配置函数
+type RouterOption func(*Router)
+
+// WithHeader 设置帧头，默认为大端序2字节
+func WithHeader(header Header) RouterOption {
+	return func(r *Router) {
+		r.header = header
+	}
+}
+
+// WithSerializer 设置消息体编解码，默认为JSON
+func WithSerializer(serializer Serializer) RouterOption {
+	return func(r *Router) {
+		r.serializer = serializer
+	}
+}
+
+// WithPool 在协程池中执行处理函数，避免阻塞事件循环
+func WithPool(pool *GoroutinePool) RouterOption {
+	return func(r *Router) {
+		r.pool = pool
+	}
+}
+
+// NotFound 设置命令未注册时的处理函数
+func NotFound(handler HandlerFunc) RouterOption {
+	return func(r *Router) {
+		r.notFound = handler
+	}
+}
+
+// NewRouter 构造函数
+func NewRouter(options ...RouterOption) *Router {
+	r := &Router{
+		header:     NewFixedHeader(binary.BigEndian, 2),
+		serializer: &JSONSerializer{},
+		handlers:   make(map[uint32]HandlerFunc),
+		notFound: func(req *Request) error {
+			return ErrCommandNotFound
+		},
+		logger: log.Zap.Mark("tcpserver"),
+	}
+	for _, op := range options {
+		op(r)
+	}
+	return r
+}
+
+// Use 添加全局中间件，先添加的在外层
+func (r *Router) Use(middleware ...Middleware) {
+	r.m.Lock()
+	r.middleware = append(r.middleware, middleware...)
+	r.m.Unlock()
+}
+
+// Handle 注册命令处理函数
+func (r *Router) Handle(cmd uint32, handler HandlerFunc, middleware ...Middleware) error {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	if _, ok := r.handlers[cmd]; ok {
+		return fmt.Errorf("command %d has been handled", cmd)
+	}
+	r.handlers[cmd] = handler
+	return nil
+}
+
+// React 解析命令号并分发，帧头错误时关闭连接
+func (r *Router) React(frame []byte, c Conn) (out []byte, action Action) {
+	if err := r.serve(frame, c); err != nil {
+		return nil, gnet.Close
+	}
+	return
+}
+
+// OnMessage 适配SessionService的OnMessage
+func (r *Router) OnMessage(sess *Session, frame []byte) ([]byte, error) {
+	return nil, r.serve(frame, sess.Conn())
+}
+
+func (r *Router) serve(frame []byte, c Conn) error {
+	cmd, body, err := r.header.Parse(frame)
+	if err != nil {
+		r.logger.Error(log.Message("parse header error:", err), zap.String("remote", remote(c)))
+		return err
+	}
+
+	req := &Request{Context: context.Background(), Conn: c, Cmd: cmd, Body: body, router: r}
+	if r.pool == nil {
+		r.dispatch(req)
+		return nil
+	}
+
+	// 事件循环会复用读缓冲区
+	req.Body = append([]byte{}, body...)
+	if err := r.pool.Submit(func() { r.dispatch(req) }); err != nil {
+		r.logger.Error(log.Message("submit error:", err), zap.Uint32("cmd", cmd))
+	}
+	return nil
+}
+
+func (r *Router) dispatch(req *Request) {
+	r.m.RLock()
+	handler, ok := r.handlers[req.Cmd]
+	if !ok {
+		handler = r.notFound
+	}
+	req.registered = ok
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+	r.m.RUnlock()
+
+	if err := handler(req); err != nil {
+		r.logger.Error(log.Message("handle error:", err), zap.Uint32("cmd", req.Cmd), zap.String("remote", remote(req.Conn)))
+	}
+}
+
+var (
+	requestType = reflect.TypeOf(&Request{})
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Typed 将func(*tcpserver.Request, *T) error转换为HandlerFunc，消息体使用路由的Serializer解码
+func Typed(handler interface{}) HandlerFunc {
+	fn := reflect.ValueOf(handler)
+	t := fn.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 1 || t.In(0) != requestType || t.Out(0) != errorType || t.In(1).Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("handler must be func(*tcpserver.Request, *T) error, got %s", t))
+	}
+
+	in := t.In(1).Elem()
+	return func(req *Request) error {
+		v := reflect.New(in)
+		if err := req.Bind(v.Interface()); err != nil {
+			return err
+		}
+		out := fn.Call([]reflect.Value{reflect.ValueOf(req), v})
+		if err, ok := out[0].Interface().(error); ok {
+			return err
+		}
+		return nil
+	}
+}
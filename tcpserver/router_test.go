@@ -0,0 +1,92 @@
+package tcpserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/panjf2000/gnet"
+	"github.com/rcrowley/go-metrics"
+	"testing"
+	"time"
+)
+
+type login struct {
+	UserID uint32
+	Token  [4]byte
+}
+
+func TestFixedHeader(t *testing.T) {
+	h := NewFixedHeader(binary.LittleEndian, 4)
+	cmd, body, err := h.Parse(h.Pack(0x0102, []byte("body")))
+	if err != nil || cmd != 0x0102 || string(body) != "body" {
+		t.Fatalf("unexpected parse result %d %s %v", cmd, body, err)
+	}
+	if _, _, err := h.Parse([]byte{1}); err != ErrFrameTooShort {
+		t.Fatalf("want ErrFrameTooShort, got %v", err)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	serializer := NewBinarySerializer(binary.BigEndian)
+	registry := metrics.NewRegistry()
+	r := NewRouter(WithSerializer(serializer))
+	r.Use(Metrics(registry), Recovery())
+
+	_ = r.Handle(1, Typed(func(req *Request, v *login) error {
+		return req.Reply(2, &login{UserID: v.UserID + 1, Token: v.Token})
+	}))
+	_ = r.Handle(3, func(req *Request) error {
+		panic("boom")
+	})
+	if err := r.Handle(1, func(req *Request) error { return nil }); err == nil {
+		t.Fatal("duplicate command should return error")
+	}
+
+	body, _ := serializer.Marshal(&login{UserID: 7, Token: [4]byte{'a', 'b', 'c', 'd'}})
+	c := newFakeConn("127.0.0.1:4001")
+	if _, action := r.React(r.header.Pack(1, body), c); action != gnet.None {
+		t.Fatal("valid frame should not close connection")
+	}
+
+	if len(c.out) != 1 {
+		t.Fatalf("want 1 reply, got %d", len(c.out))
+	}
+	cmd, reply, _ := r.header.Parse(c.out[0])
+	v := &login{}
+	if err := serializer.Unmarshal(reply, v); err != nil || cmd != 2 || v.UserID != 8 || string(v.Token[:]) != "abcd" {
+		t.Fatalf("unexpected reply %d %+v %v", cmd, v, err)
+	}
+
+	r.React(r.header.Pack(3, nil), c)
+	if metrics.GetOrRegisterCounter("tcpserver.3.failed", registry).Count() != 1 {
+		t.Fatal("panic should be recovered and counted")
+	}
+
+	r.React(r.header.Pack(99, nil), c)
+	if registry.Get("tcpserver.99.duration") != nil || metrics.GetOrRegisterTimer("tcpserver.unknown.duration", registry).Count() != 1 {
+		t.Fatal("unregistered command should be counted as unknown")
+	}
+
+	if _, action := r.React([]byte{1}, c); action != gnet.Close {
+		t.Fatal("malformed frame should close connection")
+	}
+}
+
+func TestRouter_Pool(t *testing.T) {
+	done := make(chan uint32, 1)
+	r := NewRouter(WithPool(Pool()), NotFound(func(req *Request) error {
+		done <- req.Cmd
+		return errors.New("not found")
+	}))
+
+	frame := r.header.Pack(9, []byte("x"))
+	r.React(frame, newFakeConn("127.0.0.1:4002"))
+
+	select {
+	case cmd := <-done:
+		if cmd != 9 {
+			t.Fatalf("want 9, got %d", cmd)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handle timeout")
+	}
+}
@@ -0,0 +1,70 @@
+package tcpserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+)
+
+// Serializer 消息体编解码
+type Serializer interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type (
+	// JSONSerializer JSON编解码
+	JSONSerializer struct {
+	}
+
+	// BinarySerializer 定长结构体的二进制编解码，字段须为定长类型
+	BinarySerializer struct {
+		byteOrder binary.ByteOrder
+	}
+
+	// ProtoSerializer protobuf编解码，v须实现proto.Message
+	ProtoSerializer struct {
+	}
+)
+
+func (s *JSONSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (s *JSONSerializer) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func NewBinarySerializer(byteOrder binary.ByteOrder) *BinarySerializer {
+	return &BinarySerializer{byteOrder}
+}
+
+func (s *BinarySerializer) Marshal(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, s.byteOrder, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *BinarySerializer) Unmarshal(data []byte, v interface{}) error {
+	return binary.Read(bytes.NewReader(data), s.byteOrder, v)
+}
+
+func (s *ProtoSerializer) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (s *ProtoSerializer) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
@@ -0,0 +1,479 @@
+package tcpserver
+
+import (
+	"errors"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/panjf2000/gnet"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrSessionNotFound 会话不存在或已断开
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrUnauthenticated 会话未通过认证
+	ErrUnauthenticated = errors.New("session unauthenticated")
+)
+
+// Session 连接会话，保存连接的标识、属性与所属分组
+type Session struct {
+	conn       Conn
+	m          sync.RWMutex
+	id         string
+	authed     bool
+	attrs      map[string]interface{}
+	groups     map[string]struct{}
+	created    time.Time
+	lastActive int64
+}
+
+func newSession(c Conn) *Session {
+	now := time.Now()
+	return &Session{
+		conn:       c,
+		attrs:      make(map[string]interface{}),
+		groups:     make(map[string]struct{}),
+		created:    now,
+		lastActive: now.UnixNano(),
+	}
+}
+
+// ID 会话标识，认证前为空
+func (s *Session) ID() string {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.id
+}
+
+// Conn 底层连接
+func (s *Session) Conn() Conn {
+	return s.conn
+}
+
+// Authenticated 是否已通过认证
+func (s *Session) Authenticated() bool {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.authed
+}
+
+// Set 设置会话属性
+func (s *Session) Set(key string, value interface{}) {
+	s.m.Lock()
+	s.attrs[key] = value
+	s.m.Unlock()
+}
+
+// Get 获取会话属性
+func (s *Session) Get(key string) (interface{}, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	v, ok := s.attrs[key]
+	return v, ok
+}
+
+// Groups 会话所属的分组
+func (s *Session) Groups() []string {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	groups := make([]string, 0, len(s.groups))
+	for g := range s.groups {
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// Created 连接建立时间
+func (s *Session) Created() time.Time {
+	return s.created
+}
+
+// LastActive 最后一次收到数据的时间
+func (s *Session) LastActive() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&s.lastActive))
+}
+
+// Send 异步发送一帧数据，经过服务端的Codec编码
+func (s *Session) Send(frame []byte) error {
+	return s.conn.AsyncWrite(frame)
+}
+
+// Close 关闭连接
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
+
+func (s *Session) touch() {
+	atomic.StoreInt64(&s.lastActive, time.Now().UnixNano())
+}
+
+// SessionService 会话层，在EventService之上维护连接注册表、分组、空闲超时与首帧认证
+// 空闲检测依赖Tick，需为服务端开启Ticker(true)
+type SessionService struct {
+	*Service
+	m           sync.RWMutex
+	all         map[*Session]struct{}
+	sessions    map[string]*Session
+	groups      map[string]map[*Session]struct{}
+	idleTimeout time.Duration
+	authTimeout time.Duration
+	interval    time.Duration
+	onAuth      func(s *Session, frame []byte) (id string, out []byte, err error)
+	onOpen      func(s *Session)
+	onMessage   func(s *Session, frame []byte) (out []byte, err error)
+	onClose     func(s *Session, err error)
+}
+
+// SessionOption 会话层配置函数
+type SessionOption func(*SessionService)
+
+// IdleTimeout 超过该时长未收到数据的连接将被关闭，0表示不检测
+func IdleTimeout(d time.Duration) SessionOption {
+	return func(s *SessionService) {
+		s.idleTimeout = d
+	}
+}
+
+// AuthTimeout 连接建立后需在该时长内完成认证，默认10s
+func AuthTimeout(d time.Duration) SessionOption {
+	return func(s *SessionService) {
+		s.authTimeout = d
+	}
+}
+
+// TickInterval 空闲检测间隔，默认1s
+func TickInterval(d time.Duration) SessionOption {
+	return func(s *SessionService) {
+		s.interval = d
+	}
+}
+
+// OnAuth 首帧认证，返回会话标识与响应数据，返回错误时发送out后关闭连接
+// 未设置时连接以远端地址作为标识直接注册
+func OnAuth(f func(s *Session, frame []byte) (id string, out []byte, err error)) SessionOption {
+	return func(s *SessionService) {
+		s.onAuth = f
+	}
+}
+
+// OnOpen 会话注册完成后回调
+func OnOpen(f func(s *Session)) SessionOption {
+	return func(s *SessionService) {
+		s.onOpen = f
+	}
+}
+
+// OnMessage 认证后的每一帧数据，返回错误时关闭连接
+// 以Serve(svc, true)启动时在协程池中执行，响应通过AsyncWrite发送
+func OnMessage(f func(s *Session, frame []byte) (out []byte, err error)) SessionOption {
+	return func(s *SessionService) {
+		s.onMessage = f
+	}
+}
+
+// OnClose 连接关闭后回调
+func OnClose(f func(s *Session, err error)) SessionOption {
+	return func(s *SessionService) {
+		s.onClose = f
+	}
+}
+
+// NewSessionService 构造函数
+func NewSessionService(options ...SessionOption) *SessionService {
+	s := &SessionService{
+		all:         make(map[*Session]struct{}),
+		sessions:    make(map[string]*Session),
+		groups:      make(map[string]map[*Session]struct{}),
+		authTimeout: 10 * time.Second,
+		interval:    time.Second,
+	}
+	for _, op := range options {
+		op(s)
+	}
+	return s
+}
+
+// Get 按标识获取会话
+func (s *SessionService) Get(id string) (*Session, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	sess, ok := s.sessions[id]
+	return sess, ok
+}
+
+// Len 已注册的会话数
+func (s *SessionService) Len() int {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return len(s.sessions)
+}
+
+// Range 遍历已注册的会话，f返回false时停止
+func (s *SessionService) Range(f func(sess *Session) bool) {
+	for _, sess := range s.snapshot(false) {
+		if !f(sess) {
+			return
+		}
+	}
+}
+
+// Send 向指定会话异步发送一帧数据
+func (s *SessionService) Send(id string, frame []byte) error {
+	sess, ok := s.Get(id)
+	if !ok {
+		return ErrSessionNotFound
+	}
+	return sess.Send(frame)
+}
+
+// Kick 关闭指定会话
+func (s *SessionService) Kick(id string) error {
+	sess, ok := s.Get(id)
+	if !ok {
+		return ErrSessionNotFound
+	}
+	return sess.Close()
+}
+
+// Register 以id注册会话，同一id已存在时关闭旧连接
+func (s *SessionService) Register(sess *Session, id string) {
+	s.m.Lock()
+	old, ok := s.sessions[id]
+	s.sessions[id] = sess
+	s.m.Unlock()
+
+	sess.m.Lock()
+	sess.id = id
+	sess.authed = true
+	sess.m.Unlock()
+
+	if ok && old != sess {
+		s.logger().Warn(log.Message("session", id, "replaced"), zap.String("remote", remote(old.conn)))
+		_ = old.Close()
+	}
+}
+
+// Join 将会话加入分组
+func (s *SessionService) Join(sess *Session, groups ...string) error {
+	if !sess.Authenticated() {
+		return ErrUnauthenticated
+	}
+
+	s.m.Lock()
+	sess.m.Lock()
+	for _, g := range groups {
+		members, ok := s.groups[g]
+		if !ok {
+			members = make(map[*Session]struct{})
+			s.groups[g] = members
+		}
+		members[sess] = struct{}{}
+		sess.groups[g] = struct{}{}
+	}
+	sess.m.Unlock()
+	s.m.Unlock()
+	return nil
+}
+
+// Leave 将会话移出分组
+func (s *SessionService) Leave(sess *Session, groups ...string) {
+	s.m.Lock()
+	sess.m.Lock()
+	for _, g := range groups {
+		s.leave(sess, g)
+	}
+	sess.m.Unlock()
+	s.m.Unlock()
+}
+
+// Broadcast 向分组内的所有会话发送，返回发送成功的数量
+func (s *SessionService) Broadcast(group string, frame []byte) int {
+	s.m.RLock()
+	members := make([]*Session, 0, len(s.groups[group]))
+	for sess := range s.groups[group] {
+		members = append(members, sess)
+	}
+	s.m.RUnlock()
+
+	n := 0
+	for _, sess := range members {
+		if err := sess.Send(frame); err != nil {
+			s.logger().Error(log.Message("broadcast to", sess.ID(), "error:", err), zap.String("group", group))
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// OnOpened 创建会话
+func (s *SessionService) OnOpened(c Conn) (out []byte, action Action) {
+	sess := newSession(c)
+	c.SetContext(sess)
+
+	s.m.Lock()
+	s.all[sess] = struct{}{}
+	s.m.Unlock()
+
+	if s.onAuth == nil {
+		s.Register(sess, remote(c))
+		if s.onOpen != nil {
+			s.onOpen(sess)
+		}
+	}
+	return
+}
+
+// OnClosed 注销会话
+func (s *SessionService) OnClosed(c Conn, err error) (action Action) {
+	sess, ok := c.Context().(*Session)
+	if !ok {
+		return
+	}
+
+	s.m.Lock()
+	delete(s.all, sess)
+	sess.m.Lock()
+	if exist, ok := s.sessions[sess.id]; ok && exist == sess {
+		delete(s.sessions, sess.id)
+	}
+	for g := range sess.groups {
+		s.leave(sess, g)
+	}
+	sess.m.Unlock()
+	s.m.Unlock()
+
+	if s.onClose != nil {
+		s.onClose(sess, err)
+	}
+	return
+}
+
+// React 首帧认证，之后交由OnMessage处理
+func (s *SessionService) React(frame []byte, c Conn) (out []byte, action Action) {
+	sess, ok := c.Context().(*Session)
+	if !ok {
+		return nil, gnet.Close
+	}
+	sess.touch()
+
+	if !sess.Authenticated() {
+		id, out, err := s.onAuth(sess, frame)
+		if err != nil {
+			s.logger().Warn(log.Message("authenticate error:", err), zap.String("remote", remote(c)))
+			return out, gnet.Close
+		}
+		s.Register(sess, id)
+		if s.onOpen != nil {
+			s.onOpen(sess)
+		}
+		return out, gnet.None
+	}
+
+	if s.onMessage == nil {
+		return
+	}
+
+	if s.Service != nil && s.Pool != nil {
+		data := append([]byte{}, frame...)
+		err := s.Pool.Submit(func() {
+			out, err := s.handle(sess, data)
+			if len(out) > 0 {
+				_ = sess.Send(out)
+			}
+			if err != nil {
+				_ = sess.Close()
+			}
+		})
+		if err != nil {
+			s.logger().Error(log.Message("submit error:", err), zap.String("session", sess.ID()))
+		}
+		return
+	}
+
+	out, err := s.handle(sess, frame)
+	if err != nil {
+		return out, gnet.Close
+	}
+	return out, gnet.None
+}
+
+// Tick 关闭空闲与认证超时的连接
+func (s *SessionService) Tick() (delay time.Duration, action Action) {
+	now := time.Now()
+	for _, sess := range s.snapshot(true) {
+		if !sess.Authenticated() {
+			if s.authTimeout > 0 && now.Sub(sess.created) > s.authTimeout {
+				s.logger().Warn(log.Message("authenticate timeout"), zap.String("remote", remote(sess.conn)))
+				_ = sess.Close()
+			}
+			continue
+		}
+		if s.idleTimeout > 0 && now.Sub(sess.LastActive()) > s.idleTimeout {
+			s.logger().Info(log.Message("session", sess.ID(), "idle timeout"))
+			_ = sess.Close()
+		}
+	}
+	return s.interval, gnet.None
+}
+
+func (s *SessionService) handle(sess *Session, frame []byte) (out []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New("panic in session handler")
+			s.logger().Error(log.Messagef("%v", r), zap.String("session", sess.ID()))
+		}
+	}()
+
+	out, err = s.onMessage(sess, frame)
+	if err != nil {
+		s.logger().Error(log.Message("handle error:", err), zap.String("session", sess.ID()))
+	}
+	return
+}
+
+// leave 调用方需持有s.m与sess.m
+func (s *SessionService) leave(sess *Session, group string) {
+	delete(sess.groups, group)
+	if members, ok := s.groups[group]; ok {
+		delete(members, sess)
+		if len(members) == 0 {
+			delete(s.groups, group)
+		}
+	}
+}
+
+func (s *SessionService) snapshot(all bool) []*Session {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	if all {
+		sessions := make([]*Session, 0, len(s.all))
+		for sess := range s.all {
+			sessions = append(sessions, sess)
+		}
+		return sessions
+	}
+
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
+
+func (s *SessionService) logger() *log.ZapLogger {
+	if s.Service != nil && s.Service.logger != nil {
+		return s.Service.logger
+	}
+	return log.Zap.Mark("tcpserver")
+}
+
+func remote(c Conn) string {
+	if addr := c.RemoteAddr(); addr != nil {
+		return addr.String()
+	}
+	return ""
+}
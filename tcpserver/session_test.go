@@ -0,0 +1,163 @@
+package tcpserver
+
+import (
+	"errors"
+	"github.com/panjf2000/gnet"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConn 测试用连接，只实现会话层用到的方法
+type fakeConn struct {
+	gnet.Conn
+	m      sync.Mutex
+	ctx    interface{}
+	addr   net.Addr
+	out    [][]byte
+	closed bool
+}
+
+func newFakeConn(addr string) *fakeConn {
+	a, _ := net.ResolveTCPAddr("tcp", addr)
+	return &fakeConn{addr: a}
+}
+
+func (c *fakeConn) Context() interface{}       { return c.ctx }
+func (c *fakeConn) SetContext(ctx interface{}) { c.ctx = ctx }
+func (c *fakeConn) RemoteAddr() net.Addr       { return c.addr }
+
+func (c *fakeConn) AsyncWrite(buf []byte) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.out = append(c.out, buf)
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeConn) isClosed() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.closed
+}
+
+func TestSessionService_Auth(t *testing.T) {
+	closed := make(chan string, 2)
+	svc := NewSessionService(
+		OnAuth(func(s *Session, frame []byte) (string, []byte, error) {
+			if string(frame) == "bad" {
+				return "", []byte("denied"), errors.New("bad token")
+			}
+			return string(frame), []byte("ok"), nil
+		}),
+		OnMessage(func(s *Session, frame []byte) ([]byte, error) {
+			return append([]byte("echo:"), frame...), nil
+		}),
+		OnClose(func(s *Session, err error) {
+			closed <- s.ID()
+		}),
+	)
+
+	c := newFakeConn("127.0.0.1:1001")
+	svc.OnOpened(c)
+	if svc.Len() != 0 {
+		t.Fatal("session should not be registered before auth")
+	}
+
+	out, action := svc.React([]byte("dev1"), c)
+	if string(out) != "ok" || action != gnet.None {
+		t.Fatalf("unexpected auth result %s %v", out, action)
+	}
+	if out, _ := svc.React([]byte("hi"), c); string(out) != "echo:hi" {
+		t.Fatalf("unexpected reply %s", out)
+	}
+
+	if err := svc.Send("dev1", []byte("push")); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.out) != 1 || string(c.out[0]) != "push" {
+		t.Fatalf("unexpected writes %q", c.out)
+	}
+	if err := svc.Send("dev2", []byte("push")); err != ErrSessionNotFound {
+		t.Fatalf("want ErrSessionNotFound, got %v", err)
+	}
+
+	bad := newFakeConn("127.0.0.1:1002")
+	svc.OnOpened(bad)
+	if out, action := svc.React([]byte("bad"), bad); string(out) != "denied" || action != gnet.Close {
+		t.Fatalf("unexpected auth result %s %v", out, action)
+	}
+
+	// 同一标识重复登录时关闭旧连接
+	c2 := newFakeConn("127.0.0.1:1003")
+	svc.OnOpened(c2)
+	svc.React([]byte("dev1"), c2)
+	if !c.isClosed() {
+		t.Fatal("old connection should be closed")
+	}
+	svc.OnClosed(c, nil)
+	if s, ok := svc.Get("dev1"); !ok || s.Conn() != c2 {
+		t.Fatal("new session should stay registered")
+	}
+	<-closed
+}
+
+func TestSessionService_Group(t *testing.T) {
+	svc := NewSessionService()
+
+	conns := []*fakeConn{newFakeConn("127.0.0.1:2001"), newFakeConn("127.0.0.1:2002"), newFakeConn("127.0.0.1:2003")}
+	for i, c := range conns {
+		svc.OnOpened(c)
+		if i < 2 {
+			_ = svc.Join(c.Context().(*Session), "room")
+		}
+	}
+
+	if n := svc.Broadcast("room", []byte("hello")); n != 2 {
+		t.Fatalf("want 2 receivers, got %d", n)
+	}
+	if len(conns[2].out) != 0 {
+		t.Fatal("session outside group should not receive")
+	}
+
+	svc.OnClosed(conns[0], nil)
+	if n := svc.Broadcast("room", []byte("hello")); n != 1 {
+		t.Fatalf("want 1 receiver, got %d", n)
+	}
+	svc.Leave(conns[1].Context().(*Session), "room")
+	if n := svc.Broadcast("room", []byte("hello")); n != 0 {
+		t.Fatalf("want 0 receiver, got %d", n)
+	}
+}
+
+func TestSessionService_Tick(t *testing.T) {
+	svc := NewSessionService(
+		IdleTimeout(50*time.Millisecond),
+		AuthTimeout(50*time.Millisecond),
+		OnAuth(func(s *Session, frame []byte) (string, []byte, error) {
+			return string(frame), nil, nil
+		}),
+	)
+
+	idle, active, anonymous := newFakeConn("127.0.0.1:3001"), newFakeConn("127.0.0.1:3002"), newFakeConn("127.0.0.1:3003")
+	for _, c := range []*fakeConn{idle, active, anonymous} {
+		svc.OnOpened(c)
+	}
+	svc.React([]byte("idle"), idle)
+	svc.React([]byte("active"), active)
+
+	time.Sleep(60 * time.Millisecond)
+	svc.React([]byte("ping"), active)
+	svc.Tick()
+
+	if !idle.isClosed() || !anonymous.isClosed() || active.isClosed() {
+		t.Fatalf("unexpected closed state idle=%v anonymous=%v active=%v", idle.isClosed(), anonymous.isClosed(), active.isClosed())
+	}
+}
@@ -14,6 +14,12 @@ addr = "127.0.0.1:6379"
 password = "password"
 db = 0
 poolSize = 100
+[dev.log]
+level = "debug"
+encoding = "console"
+outputs = ["stderr"]
+[dev.tracing]
+exporter = "log"
 #自定义配置项
 
 [test]
@@ -22,13 +28,18 @@ addr = ":8080"
 [test.mysql]
 addr = "127.0.0.1:3306"
 username = "root"
-password = "password"
+#密码支持${env:NAME}、${file:/path}、${enc:密文}引用，加载时解析
+password = "${env:MYSQL_PASSWORD}"
 dbName = "demo"
 [test.redis]
 addr = "127.0.0.1:6379"
-password = "password"
+password = "${env:REDIS_PASSWORD}"
 db = 0
 poolSize = 100
+[test.log]
+level = "debug"
+encoding = "json"
+outputs = ["stderr"]
 #自定义配置项
 
 [pre]
@@ -37,13 +48,17 @@ addr = ":8080"
 [pre.mysql]
 addr = "127.0.0.1:3306"
 username = "root"
-password = "password"
+password = "${env:MYSQL_PASSWORD}"
 dbName = "demo"
 [pre.redis]
 addr = "127.0.0.1:6379"
-password = "password"
+password = "${env:REDIS_PASSWORD}"
 db = 0
 poolSize = 100
+[pre.log]
+level = "info"
+encoding = "json"
+outputs = ["stderr"]
 #自定义配置项
 
 [prod]
@@ -52,12 +67,33 @@ addr = ":8080"
 [prod.mysql]
 addr = "127.0.0.1:3306"
 username = "root"
-password = "password"
+password = "${env:MYSQL_PASSWORD}"
 dbName = "demo"
 [prod.redis]
 addr = "127.0.0.1:6379"
-password = "password"
+password = "${env:REDIS_PASSWORD}"
 db = 0
 poolSize = 100
+[prod.log]
+level = "info"
+encoding = "json"
+outputs = ["stderr"]
+[prod.log.file]
+filename = "logs/app.log"
+maxSize = 100
+maxBackups = 30
+compress = true
+interval = "24h"
+[prod.log.errorFile]
+filename = "logs/error.log"
+maxBackups = 30
+compress = true
+[prod.tracing]
+propagators = ["w3c", "b3"]
+exporter = "otlp"
+url = "http://127.0.0.1:4318/v1/traces"
+[prod.tracing.sampler]
+type = "ratio"
+ratio = 0.1
 #自定义配置项
 `
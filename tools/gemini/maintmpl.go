@@ -36,6 +36,12 @@ func main() {
 		// redis实例化
 		rd := redis.New(redis.Pwd(redisCf.GetString("password")), redis.PoolSize(redisCf.GetInt("poolSize")), redis.DB(redisCf.GetInt("db")), redis.Addr(redisCf.GetString("addr")))
 
+		// 链路跟踪实例
+		tracer, err := config.NewTracer(config.Conf().Sub("tracing"))
+		if err != nil {
+			return err
+		}
+
 		//初始化定时任务
 		//scheduler.Bind(scheduler.Repo(db))
 
@@ -43,7 +49,7 @@ func main() {
 		//email.Bind(email.Host("..."))
 
 		// 实例化服务
-		{{range .}}{{ .Name }} := service.NewService(&services.{{ title .Name }}{}, service.Repository(db), service.RedisClient(rd)){{ end }}
+		{{range .}}{{ .Name }} := service.NewService(&services.{{ title .Name }}{}, service.Repository(db), service.RedisClient(rd), service.Tracer(tracer)){{ end }}
 
 		// 实例化路由
 		r := router.New()
@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"fmt"
+	"github.com/openzipkin/zipkin-go/reporter"
+	"time"
+)
+
+// Config 链路跟踪配置，通常由config.NewTracer从配置的tracing节绑定
+type Config struct {
+	// ServiceName 本服务名称
+	ServiceName string
+	// HostPort 本服务地址
+	HostPort string
+	// Propagators 请求头的传播格式，w3c、b3、b3single或jar
+	Propagators []string `default:"w3c,b3"`
+	// Sampler 采样配置
+	Sampler SamplerConfig
+	// Exporter 上报方式，log、zipkin或otlp
+	Exporter string `default:"log" binding:"oneof=log zipkin otlp"`
+	// URL zipkin或otlp的上报地址
+	URL string
+	// BatchSize 每批上报的Span数
+	BatchSize int `default:"100"`
+	// BatchInterval 未攒满时的上报间隔
+	BatchInterval time.Duration `default:"1s"`
+	// Headers 上报请求附加的请求头
+	Headers map[string]string
+}
+
+// FromConfig 按配置构造Tracer，并设置为opentracing的全局Tracer
+func FromConfig(conf Config) (*Tracer, error) {
+	options := []Option{Sampler(conf.Sampler)}
+	if conf.ServiceName != "" {
+		options = append(options, Endpoint(conf.ServiceName, conf.HostPort))
+	}
+	if len(conf.Propagators) > 0 {
+		propagators := make([]Propagator, 0, len(conf.Propagators))
+		for _, name := range conf.Propagators {
+			p, err := PropagatorFor(name)
+			if err != nil {
+				return nil, err
+			}
+			propagators = append(propagators, p)
+		}
+		options = append(options, Propagators(propagators...))
+	}
+
+	var rep reporter.Reporter
+	reporterOptions := []ReporterOption{Headers(conf.Headers)}
+	if conf.BatchSize > 0 {
+		reporterOptions = append(reporterOptions, BatchSize(conf.BatchSize))
+	}
+	if conf.BatchInterval > 0 {
+		reporterOptions = append(reporterOptions, BatchInterval(conf.BatchInterval))
+	}
+	switch conf.Exporter {
+	case "", "log":
+		rep = NewZapReporter()
+	case "zipkin":
+		rep = NewZipkinReporter(conf.URL, reporterOptions...)
+	case "otlp":
+		rep = NewOTLPReporter(conf.URL, reporterOptions...)
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q", conf.Exporter)
+	}
+
+	t, err := newTracer(rep, options...)
+	if err != nil {
+		_ = rep.Close()
+		return nil, err
+	}
+	return t, nil
+}
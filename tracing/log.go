@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+	"github.com/Jarnpher553/gemini/log"
+	"github.com/opentracing/opentracing-go"
+	zipkinAdapter "github.com/openzipkin-contrib/zipkin-go-opentracing"
+	"github.com/openzipkin/zipkin-go/model"
+	"go.uber.org/zap"
+)
+
+func init() {
+	log.RegisterExtractor(logFields)
+}
+
+// logFields 日志中的trace_id与span_id
+func logFields(ctx context.Context) []zap.Field {
+	sc, ok := currentSpanContext(ctx)
+	if !ok || sc.TraceID.Empty() {
+		return nil
+	}
+	return []zap.Field{zap.String("trace_id", sc.TraceID.String()), zap.String("span_id", sc.ID.String())}
+}
+
+// TraceID ctx中的trace id，没有时返回空字符串
+func TraceID(ctx context.Context) string {
+	sc, ok := currentSpanContext(ctx)
+	if !ok || sc.TraceID.Empty() {
+		return ""
+	}
+	return sc.TraceID.String()
+}
+
+// currentSpanContext 依次取opentracing的Span、zipkin的Span与请求头中的SpanContext
+func currentSpanContext(ctx context.Context) (model.SpanContext, bool) {
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		if sc, ok := span.Context().(zipkinAdapter.SpanContext); ok {
+			return model.SpanContext(sc), true
+		}
+	}
+	if span := SpanFromContext(ctx); span != nil {
+		return span.Context(), true
+	}
+	if sc := SpanContextFromContext(ctx); sc != nil {
+		return *sc, true
+	}
+	return model.SpanContext{}, false
+}
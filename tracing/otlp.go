@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/reporter"
+	httpreporter "github.com/openzipkin/zipkin-go/reporter/http"
+	"sort"
+	"strconv"
+)
+
+// NewOTLPReporter 以OTLP/HTTP JSON格式上报到url，如http://127.0.0.1:4318/v1/traces，攒批规则与NewZipkinReporter一致
+func NewOTLPReporter(url string, options ...ReporterOption) reporter.Reporter {
+	return newHTTPReporter(url, newReporterOptions(options), httpreporter.Serializer(otlpSerializer{}))
+}
+
+// otlpSerializer 将一批Span编码为OTLP JSON
+type otlpSerializer struct{}
+
+func (otlpSerializer) Serialize(batch []*model.SpanModel) ([]byte, error) {
+	return json.Marshal(otlpTraces(batch))
+}
+
+func (otlpSerializer) ContentType() string {
+	return "application/json"
+}
+
+// 以下为OTLP JSON编码，trace id与span id为十六进制字符串，时间为纳秒字符串
+
+type otlpKeyValue struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope map[string]string `json:"scope"`
+	Spans []otlpSpan        `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   map[string][]otlpKeyValue `json:"resource"`
+	ScopeSpans []otlpScopeSpans          `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// otlpTraces 按本地服务名分组为resourceSpans
+func otlpTraces(batch []*model.SpanModel) *otlpRequest {
+	services := make(map[string][]otlpSpan)
+	var names []string
+	for _, s := range batch {
+		name := "unknown_service"
+		if s.LocalEndpoint != nil && s.LocalEndpoint.ServiceName != "" {
+			name = s.LocalEndpoint.ServiceName
+		}
+		if _, ok := services[name]; !ok {
+			names = append(names, name)
+		}
+		services[name] = append(services[name], otlpSpanOf(*s))
+	}
+
+	req := &otlpRequest{}
+	for _, name := range names {
+		req.ResourceSpans = append(req.ResourceSpans, otlpResourceSpans{
+			Resource:   map[string][]otlpKeyValue{"attributes": {stringAttr("service.name", name)}},
+			ScopeSpans: []otlpScopeSpans{{Scope: map[string]string{"name": "github.com/Jarnpher553/gemini/tracing"}, Spans: services[name]}},
+		})
+	}
+	return req
+}
+
+func otlpSpanOf(s model.SpanModel) otlpSpan {
+	span := otlpSpan{
+		TraceID:           fmt.Sprintf("%016x%016x", s.TraceID.High, s.TraceID.Low),
+		SpanID:            fmt.Sprintf("%016x", uint64(s.ID)),
+		Name:              s.Name,
+		Kind:              otlpKind(s.Kind),
+		StartTimeUnixNano: strconv.FormatInt(s.Timestamp.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.Timestamp.Add(s.Duration).UnixNano(), 10),
+	}
+	if s.ParentID != nil {
+		span.ParentSpanID = fmt.Sprintf("%016x", uint64(*s.ParentID))
+	}
+
+	keys := make([]string, 0, len(s.Tags))
+	for k := range s.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		span.Attributes = append(span.Attributes, stringAttr(k, s.Tags[k]))
+	}
+	if msg, ok := s.Tags["error"]; ok {
+		span.Status = otlpStatus{Code: 2, Message: msg}
+	}
+	return span
+}
+
+func otlpKind(kind model.Kind) int {
+	switch kind {
+	case model.Server:
+		return 2
+	case model.Client:
+		return 3
+	case model.Producer:
+		return 4
+	case model.Consumer:
+		return 5
+	}
+	return 1
+}
+
+func stringAttr(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: map[string]string{"stringValue": value}}
+}
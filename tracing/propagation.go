@@ -0,0 +1,257 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/openzipkin/zipkin-go/model"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Propagator 在请求头与SpanContext之间转换
+type Propagator interface {
+	// Extract 请求头中没有或格式错误时返回false
+	Extract(h http.Header) (model.SpanContext, bool)
+	// Inject 写入请求头
+	Inject(sc model.SpanContext, h http.Header)
+}
+
+// PropagatorFor 按名称返回Propagator，支持w3c、b3、b3single与jar
+func PropagatorFor(name string) (Propagator, error) {
+	switch strings.ToLower(name) {
+	case "w3c", "tracecontext":
+		return W3C(), nil
+	case "b3", "b3multi":
+		return B3(), nil
+	case "b3single":
+		return B3Single(), nil
+	case "jar":
+		return Jar(), nil
+	}
+	return nil, fmt.Errorf("tracing: unknown propagator %q", name)
+}
+
+type w3c struct{}
+
+// W3C W3C Trace Context的traceparent请求头，tracestate由TraceState在请求间透传
+func W3C() Propagator {
+	return w3c{}
+}
+
+func (w3c) Extract(h http.Header) (model.SpanContext, bool) {
+	var sc model.SpanContext
+	parts := strings.Split(strings.TrimSpace(h.Get("traceparent")), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+
+	traceID, err := model.TraceIDFromHex(parts[1])
+	if err != nil || traceID.Empty() {
+		return sc, false
+	}
+	id, err := strconv.ParseUint(parts[2], 16, 64)
+	if err != nil || id == 0 {
+		return sc, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return sc, false
+	}
+
+	sampled := flags&1 == 1
+	sc.TraceID = traceID
+	sc.ID = model.ID(id)
+	sc.Sampled = &sampled
+	return sc, true
+}
+
+func (w3c) Inject(sc model.SpanContext, h http.Header) {
+	flags := "00"
+	if sc.Debug || (sc.Sampled != nil && *sc.Sampled) {
+		flags = "01"
+	}
+	h.Set("traceparent", fmt.Sprintf("00-%016x%016x-%016x-%s", sc.TraceID.High, sc.TraceID.Low, uint64(sc.ID), flags))
+}
+
+type b3 struct{}
+
+// B3 zipkin的X-B3-*多请求头
+func B3() Propagator {
+	return b3{}
+}
+
+func (b3) Extract(h http.Header) (model.SpanContext, bool) {
+	var sc model.SpanContext
+	traceID, err := model.TraceIDFromHex(h.Get("X-B3-TraceId"))
+	if err != nil || traceID.Empty() {
+		return sc, false
+	}
+	id, err := strconv.ParseUint(h.Get("X-B3-SpanId"), 16, 64)
+	if err != nil {
+		return sc, false
+	}
+	sc.TraceID = traceID
+	sc.ID = model.ID(id)
+
+	if parent, err := strconv.ParseUint(h.Get("X-B3-ParentSpanId"), 16, 64); err == nil {
+		pID := model.ID(parent)
+		sc.ParentID = &pID
+	}
+	sc.Sampled = parseSampled(h.Get("X-B3-Sampled"))
+	sc.Debug = h.Get("X-B3-Flags") == "1"
+	return sc, true
+}
+
+func (b3) Inject(sc model.SpanContext, h http.Header) {
+	h.Set("X-B3-TraceId", sc.TraceID.String())
+	h.Set("X-B3-SpanId", sc.ID.String())
+	if sc.ParentID != nil {
+		h.Set("X-B3-ParentSpanId", sc.ParentID.String())
+	}
+	if sc.Debug {
+		h.Set("X-B3-Flags", "1")
+	} else if sc.Sampled != nil {
+		h.Set("X-B3-Sampled", formatSampled(*sc.Sampled))
+	}
+}
+
+type b3Single struct{}
+
+// B3Single zipkin的b3单请求头，格式为{TraceId}-{SpanId}-{SamplingState}-{ParentSpanId}
+func B3Single() Propagator {
+	return b3Single{}
+}
+
+func (b3Single) Extract(h http.Header) (model.SpanContext, bool) {
+	var sc model.SpanContext
+	parts := strings.Split(strings.TrimSpace(h.Get("b3")), "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		return sc, false
+	}
+
+	traceID, err := model.TraceIDFromHex(parts[0])
+	if err != nil || traceID.Empty() {
+		return sc, false
+	}
+	id, err := strconv.ParseUint(parts[1], 16, 64)
+	if err != nil {
+		return sc, false
+	}
+	sc.TraceID = traceID
+	sc.ID = model.ID(id)
+
+	if len(parts) > 2 {
+		if parts[2] == "d" {
+			sc.Debug = true
+		} else {
+			sc.Sampled = parseSampled(parts[2])
+		}
+	}
+	if len(parts) > 3 {
+		if parent, err := strconv.ParseUint(parts[3], 16, 64); err == nil {
+			pID := model.ID(parent)
+			sc.ParentID = &pID
+		}
+	}
+	return sc, true
+}
+
+func (b3Single) Inject(sc model.SpanContext, h http.Header) {
+	v := sc.TraceID.String() + "-" + sc.ID.String()
+	if sc.Debug {
+		v += "-d"
+	} else if sc.Sampled != nil {
+		v += "-" + formatSampled(*sc.Sampled)
+	}
+	if sc.ParentID != nil && (sc.Debug || sc.Sampled != nil) {
+		v += "-" + sc.ParentID.String()
+	}
+	h.Set("b3", v)
+}
+
+type jar struct{}
+
+// Jar 早期版本的jar-*请求头，用于与旧服务互通
+func Jar() Propagator {
+	return jar{}
+}
+
+func (jar) Extract(h http.Header) (model.SpanContext, bool) {
+	var sc model.SpanContext
+	traceID, err := model.TraceIDFromHex(h.Get("jar-traceid"))
+	if err != nil || traceID.Empty() {
+		return sc, false
+	}
+	sc.TraceID = traceID
+
+	if id, err := strconv.ParseUint(h.Get("jar-spanid"), 16, 64); err == nil {
+		sc.ID = model.ID(id)
+	}
+	if parent, err := strconv.ParseUint(h.Get("jar-parentid"), 16, 64); err == nil && parent != 0 {
+		pID := model.ID(parent)
+		sc.ParentID = &pID
+	}
+	sc.Sampled = parseSampled(h.Get("jar-sampled"))
+	sc.Debug = h.Get("jar-flags") == "1"
+	return sc, true
+}
+
+func (jar) Inject(sc model.SpanContext, h http.Header) {
+	if sc.Debug {
+		h.Set("jar-flags", "1")
+	}
+	if sc.Sampled != nil && *sc.Sampled {
+		h.Set("jar-sampled", "1")
+	} else {
+		h.Set("jar-sampled", "0")
+	}
+
+	h.Set("jar-traceid", sc.TraceID.String())
+	h.Set("jar-spanid", sc.ID.String())
+
+	if sc.ParentID != nil {
+		h.Set("jar-parentid", sc.ParentID.String())
+	} else {
+		h.Set("jar-parentid", "0")
+	}
+}
+
+func parseSampled(s string) *bool {
+	var sampled bool
+	switch s {
+	case "1", "true":
+		sampled = true
+	case "0", "false":
+		sampled = false
+	default:
+		return nil
+	}
+	return &sampled
+}
+
+func formatSampled(sampled bool) string {
+	if sampled {
+		return "1"
+	}
+	return "0"
+}
+
+type traceStateKey struct{}
+
+// WithTraceState 将收到的W3C tracestate写入context，TracerMiddleware调用
+func WithTraceState(ctx context.Context, state string) context.Context {
+	if state == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceStateKey{}, state)
+}
+
+// TraceState context中的W3C tracestate，发出请求时原样透传
+func TraceState(ctx context.Context) string {
+	s, _ := ctx.Value(traceStateKey{}).(string)
+	return s
+}
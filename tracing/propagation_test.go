@@ -0,0 +1,193 @@
+package tracing
+
+import (
+	"encoding/json"
+	"github.com/opentracing/opentracing-go"
+	zipkinAdapter "github.com/openzipkin-contrib/zipkin-go-opentracing"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/reporter"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func spanContext() model.SpanContext {
+	sampled := true
+	parent := model.ID(0x1111)
+	return model.SpanContext{
+		TraceID:  model.TraceID{High: 0x0af7651916cd43dd, Low: 0x8448eb211c80319c},
+		ID:       model.ID(0xb7ad6b7169203331),
+		ParentID: &parent,
+		Sampled:  &sampled,
+	}
+}
+
+func TestPropagators(t *testing.T) {
+	sc := spanContext()
+	for _, name := range []string{"w3c", "b3", "b3single", "jar"} {
+		p, err := PropagatorFor(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := http.Header{}
+		p.Inject(sc, h)
+		got, ok := p.Extract(h)
+		if !ok || got.TraceID != sc.TraceID || got.ID != sc.ID || got.Sampled == nil || !*got.Sampled {
+			t.Fatalf("%s: unexpected span context %+v from %v", name, got, h)
+		}
+	}
+
+	h := http.Header{}
+	W3C().Inject(sc, h)
+	if h.Get("traceparent") != "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01" {
+		t.Fatalf("unexpected traceparent %s", h.Get("traceparent"))
+	}
+	for _, v := range []string{"", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331", "ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", "00-00000000000000000000000000000000-b7ad6b7169203331-01"} {
+		if _, ok := W3C().Extract(http.Header{"Traceparent": {v}}); ok {
+			t.Fatalf("traceparent %q should be invalid", v)
+		}
+	}
+
+	got, ok := B3Single().Extract(http.Header{"B3": {"80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-d"}})
+	if !ok || !got.Debug || got.ID != model.ID(0xe457b5a2e4d86bd1) {
+		t.Fatalf("unexpected b3 span context %+v", got)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	tracer, err := newTracer(reporter.NewNoopReporter(), Propagators(B3Single(), W3C()), Sampler(SamplerConfig{IgnoreParent: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc := spanContext()
+	carrier := opentracing.HTTPHeadersCarrier(http.Header{})
+	if err := tracer.Inject(zipkinAdapter.SpanContext(sc), opentracing.HTTPHeaders, carrier); err != nil {
+		t.Fatal(err)
+	}
+	h := http.Header(carrier)
+	if h.Get("b3") == "" || h.Get("traceparent") == "" {
+		t.Fatalf("unexpected headers %v", h)
+	}
+
+	h.Del("b3")
+	extracted, err := tracer.Extract(opentracing.HTTPHeaders, carrier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zsc := model.SpanContext(extracted.(zipkinAdapter.SpanContext))
+	if zsc.TraceID != sc.TraceID || zsc.ID != sc.ID || zsc.Sampled != nil {
+		t.Fatalf("unexpected span context %+v", zsc)
+	}
+
+	if _, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(http.Header{})); err != opentracing.ErrSpanContextNotFound {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	s, err := SamplerConfig{Type: "rate", Rate: 2}.sampler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for i := uint64(0); i < 10; i++ {
+		if s(i) {
+			n++
+		}
+	}
+	if n < 2 || n > 4 {
+		t.Fatalf("unexpected sampled count %d", n)
+	}
+
+	if s, _ := (SamplerConfig{Type: "never"}).sampler(); s(1) {
+		t.Fatal("never sampler should not sample")
+	}
+	if _, err := (SamplerConfig{Type: "ratio", Ratio: 2}).sampler(); err == nil {
+		t.Fatal("ratio out of range should fail")
+	}
+	if _, err := (SamplerConfig{Type: "unknown"}).sampler(); err == nil {
+		t.Fatal("unknown sampler should fail")
+	}
+}
+
+func collector() (*httptest.Server, chan []byte, chan http.Header) {
+	bodies, headers := make(chan []byte, 10), make(chan http.Header, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies <- b
+		headers <- r.Header
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	return srv, bodies, headers
+}
+
+func spanModel() model.SpanModel {
+	return model.SpanModel{
+		SpanContext:   spanContext(),
+		Name:          "get /users",
+		Kind:          model.Server,
+		Timestamp:     time.Unix(1600000000, 0),
+		Duration:      time.Millisecond,
+		LocalEndpoint: &model.Endpoint{ServiceName: "user"},
+		Tags:          map[string]string{"http.method": "GET", "error": "boom"},
+	}
+}
+
+func TestZipkinReporter(t *testing.T) {
+	srv, bodies, headers := collector()
+	defer srv.Close()
+
+	r := NewZipkinReporter(srv.URL, BatchInterval(10*time.Millisecond), Headers(map[string]string{"Authorization": "token"}))
+	r.Send(spanModel())
+	_ = r.Close()
+
+	var spans []model.SpanModel
+	select {
+	case b := <-bodies:
+		if err := json.Unmarshal(b, &spans); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("report timeout")
+	}
+	if len(spans) != 1 || spans[0].Name != "get /users" || spans[0].TraceID != spanContext().TraceID {
+		t.Fatalf("unexpected spans %+v", spans)
+	}
+	if h := <-headers; h.Get("Authorization") != "token" {
+		t.Fatalf("unexpected headers %v", h)
+	}
+}
+
+func TestOTLPReporter(t *testing.T) {
+	srv, bodies, headers := collector()
+	defer srv.Close()
+
+	r := NewOTLPReporter(srv.URL, BatchSize(1), Headers(map[string]string{"Authorization": "token"}))
+	r.Send(spanModel())
+
+	var req otlpRequest
+	select {
+	case b := <-bodies:
+		if err := json.Unmarshal(b, &req); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("report timeout")
+	}
+	_ = r.Close()
+
+	if len(req.ResourceSpans) != 1 || req.ResourceSpans[0].Resource["attributes"][0].Value["stringValue"] != "user" {
+		t.Fatalf("unexpected resource %+v", req)
+	}
+	span := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if span.TraceID != "0af7651916cd43dd8448eb211c80319c" || span.SpanID != "b7ad6b7169203331" || span.ParentSpanID != "0000000000001111" ||
+		span.Kind != 2 || span.StartTimeUnixNano != "1600000000000000000" || span.EndTimeUnixNano != "1600000000001000000" || span.Status.Code != 2 {
+		t.Fatalf("unexpected span %+v", span)
+	}
+	if h := <-headers; h.Get("Authorization") != "token" || h.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected headers %v", h)
+	}
+}
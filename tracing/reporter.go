@@ -4,8 +4,11 @@ import (
 	"github.com/Jarnpher553/gemini/log"
 	"github.com/openzipkin/zipkin-go/model"
 	"github.com/openzipkin/zipkin-go/reporter"
+	httpreporter "github.com/openzipkin/zipkin-go/reporter/http"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"net/http"
+	"time"
 )
 
 type ZapReporter struct {
@@ -36,3 +39,69 @@ func (r *ZapReporter) Send(s model.SpanModel) {
 
 // Close 实现Reporter接口
 func (*ZapReporter) Close() error { return nil }
+
+type reporterOptions struct {
+	batchSize int
+	interval  time.Duration
+	timeout   time.Duration
+	headers   map[string]string
+}
+
+// ReporterOption HTTP上报配置函数
+type ReporterOption func(*reporterOptions)
+
+// BatchSize 每批上报的Span数，默认100
+func BatchSize(n int) ReporterOption {
+	return func(o *reporterOptions) {
+		o.batchSize = n
+	}
+}
+
+// BatchInterval 未攒满时的上报间隔，默认1s
+func BatchInterval(d time.Duration) ReporterOption {
+	return func(o *reporterOptions) {
+		o.interval = d
+	}
+}
+
+// Timeout 上报请求超时，默认5s
+func Timeout(d time.Duration) ReporterOption {
+	return func(o *reporterOptions) {
+		o.timeout = d
+	}
+}
+
+// Headers 上报请求附加的请求头，如鉴权
+func Headers(headers map[string]string) ReporterOption {
+	return func(o *reporterOptions) {
+		o.headers = headers
+	}
+}
+
+func newReporterOptions(options []ReporterOption) *reporterOptions {
+	o := &reporterOptions{batchSize: 100, interval: time.Second, timeout: 5 * time.Second}
+	for _, op := range options {
+		op(o)
+	}
+	return o
+}
+
+// NewZipkinReporter 以zipkin v2 JSON格式上报到url，如http://127.0.0.1:9411/api/v2/spans
+func NewZipkinReporter(url string, options ...ReporterOption) reporter.Reporter {
+	return newHTTPReporter(url, newReporterOptions(options))
+}
+
+// newHTTPReporter 使用zipkin的HTTP上报攒批，积压超过10批时丢弃最早的Span
+func newHTTPReporter(url string, o *reporterOptions, options ...httpreporter.ReporterOption) reporter.Reporter {
+	return httpreporter.NewReporter(url, append([]httpreporter.ReporterOption{
+		httpreporter.BatchSize(o.batchSize),
+		httpreporter.BatchInterval(o.interval),
+		httpreporter.MaxBacklog(o.batchSize * 10),
+		httpreporter.Timeout(o.timeout),
+		httpreporter.RequestCallback(func(r *http.Request) {
+			for k, v := range o.headers {
+				r.Header.Set(k, v)
+			}
+		}),
+	}, options...)...)
+}
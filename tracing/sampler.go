@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"fmt"
+	"github.com/openzipkin/zipkin-go"
+	"sync"
+	"time"
+)
+
+// SamplerConfig 采样配置
+// 默认基于父Span的采样结果（parent-based），只有根Span由Type决定；IgnoreParent为true时总是由Type决定
+type SamplerConfig struct {
+	// Type always、never、ratio或rate，默认always
+	Type string `default:"always" binding:"oneof=always never ratio rate"`
+	// Ratio ratio采样的比例，0-1
+	Ratio float64
+	// Rate rate采样每秒最多采样的链路数
+	Rate int
+	// IgnoreParent 忽略上游的采样结果
+	IgnoreParent bool
+}
+
+func (c SamplerConfig) sampler() (zipkin.Sampler, error) {
+	switch c.Type {
+	case "", "always":
+		return zipkin.AlwaysSample, nil
+	case "never":
+		return zipkin.NeverSample, nil
+	case "ratio":
+		return zipkin.NewBoundarySampler(c.Ratio, time.Now().UnixNano())
+	case "rate":
+		if c.Rate <= 0 {
+			return nil, fmt.Errorf("tracing: rate of sampler must be positive, got %d", c.Rate)
+		}
+		return newRateSampler(c.Rate), nil
+	}
+	return nil, fmt.Errorf("tracing: unknown sampler %q", c.Type)
+}
+
+// newRateSampler 每秒最多采样rate条链路
+func newRateSampler(rate int) zipkin.Sampler {
+	var (
+		m      sync.Mutex
+		second int64
+		count  int
+	)
+	return func(uint64) bool {
+		now := time.Now().Unix()
+		m.Lock()
+		defer m.Unlock()
+		if now != second {
+			second, count = now, 0
+		}
+		if count >= rate {
+			return false
+		}
+		count++
+		return true
+	}
+}
@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"context"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// StartChild 以ctx中的Span为父Span创建子Span，ctx中没有Span时不创建，返回nil与原ctx
+func StartChild(ctx context.Context, operationName string, opts ...opentracing.StartSpanOption) (opentracing.Span, context.Context) {
+	parent := opentracing.SpanFromContext(ctx)
+	if parent == nil {
+		return nil, ctx
+	}
+	span := parent.Tracer().StartSpan(operationName, append(opts, opentracing.ChildOf(parent.Context()))...)
+	return span, opentracing.ContextWithSpan(ctx, span)
+}
+
+// Inject 将ctx中的Span写入map，随消息、任务跨进程传递，ctx中没有Span时返回nil
+func Inject(ctx context.Context) map[string]string {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return nil
+	}
+	carrier := opentracing.TextMapCarrier{}
+	if err := span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier); err != nil {
+		return nil
+	}
+	return carrier
+}
+
+// StartFollowing 以Inject写入的map为起点创建Span，map为空或无法解析时创建新的链路
+func StartFollowing(carrier map[string]string, operationName string, opts ...opentracing.StartSpanOption) (opentracing.Span, context.Context) {
+	if len(carrier) > 0 {
+		if sc, err := opentracing.GlobalTracer().Extract(opentracing.TextMap, opentracing.TextMapCarrier(carrier)); err == nil {
+			opts = append(opts, opentracing.FollowsFrom(sc))
+		}
+	}
+	span := opentracing.StartSpan(operationName, opts...)
+	return span, opentracing.ContextWithSpan(context.Background(), span)
+}
+
+// Finish 按err设置错误标签并结束Span，span为nil时忽略
+func Finish(span opentracing.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogKV("error", err.Error())
+	}
+	span.Finish()
+}
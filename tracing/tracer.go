@@ -2,35 +2,146 @@ package tracing
 
 import (
 	"context"
+	"github.com/Jarnpher553/gemini/inspector"
 	"github.com/Jarnpher553/gemini/log"
 	"github.com/opentracing/opentracing-go"
 	zipkinAdapter "github.com/openzipkin-contrib/zipkin-go-opentracing"
 	"github.com/openzipkin/zipkin-go"
 	"github.com/openzipkin/zipkin-go/model"
 	"github.com/openzipkin/zipkin-go/reporter"
+	"net/http"
 )
 
 var logger = log.Logger.Mark("tracer")
 
-// Tracer 跟踪类
+// Tracer 跟踪类，HTTPHeaders与TextMap格式的Inject、Extract使用配置的Propagator
 type Tracer struct {
 	opentracing.Tracer
+	propagators  []Propagator
+	ignoreParent bool
 }
 
-// New 构造函数
-func New(reporter reporter.Reporter) *Tracer {
-	t, err := zipkin.NewTracer(reporter, zipkin.WithSharedSpans(false))
+type options struct {
+	propagators []Propagator
+	sampler     SamplerConfig
+	endpoint    *model.Endpoint
+}
+
+// Option 配置函数
+type Option func(*options)
+
+// Propagators 请求头的传播格式，提取时依次尝试，注入时全部写入，默认W3C与B3
+func Propagators(propagators ...Propagator) Option {
+	return func(o *options) {
+		o.propagators = propagators
+	}
+}
+
+// Sampler 采样配置，默认全部采样
+func Sampler(conf SamplerConfig) Option {
+	return func(o *options) {
+		o.sampler = conf
+	}
+}
+
+// Endpoint 本服务的名称与地址，记录在上报的Span中
+func Endpoint(serviceName string, hostPort string) Option {
+	return func(o *options) {
+		endpoint, err := zipkin.NewEndpoint(serviceName, hostPort)
+		if err != nil {
+			logger.Warn(log.Message("invalid endpoint:", err))
+			endpoint = &model.Endpoint{ServiceName: serviceName}
+		}
+		o.endpoint = endpoint
+	}
+}
 
+// New 构造函数，并设置为opentracing的全局Tracer，Span同时写入inspector供调试页面查看
+func New(reporter reporter.Reporter, options ...Option) *Tracer {
+	t, err := newTracer(reporter, options...)
 	if err != nil {
 		logger.Fatal(log.Message(err))
 	}
+	return t
+}
+
+func newTracer(reporter reporter.Reporter, opts ...Option) (*Tracer, error) {
+	o := &options{propagators: []Propagator{W3C(), B3()}}
+	for _, op := range opts {
+		op(o)
+	}
+
+	sampler, err := o.sampler.sampler()
+	if err != nil {
+		return nil, err
+	}
+	zipkinOptions := []zipkin.TracerOption{zipkin.WithSharedSpans(false), zipkin.WithSampler(sampler)}
+	if o.endpoint != nil {
+		zipkinOptions = append(zipkinOptions, zipkin.WithLocalEndpoint(o.endpoint))
+	}
 
-	tracer := zipkinAdapter.Wrap(t)
+	t, err := zipkin.NewTracer(inspector.Reporter(reporter), zipkinOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	tracer := &Tracer{
+		Tracer:       zipkinAdapter.Wrap(t),
+		propagators:  o.propagators,
+		ignoreParent: o.sampler.IgnoreParent,
+	}
 	opentracing.SetGlobalTracer(tracer)
+	return tracer, nil
+}
+
+// Inject 实现opentracing.Tracer接口
+func (t *Tracer) Inject(sc opentracing.SpanContext, format interface{}, carrier interface{}) error {
+	if format != opentracing.HTTPHeaders && format != opentracing.TextMap {
+		return t.Tracer.Inject(sc, format, carrier)
+	}
+	zsc, ok := sc.(zipkinAdapter.SpanContext)
+	if !ok {
+		return opentracing.ErrInvalidSpanContext
+	}
+	w, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+
+	h := http.Header{}
+	for _, p := range t.propagators {
+		p.Inject(model.SpanContext(zsc), h)
+	}
+	for k := range h {
+		w.Set(k, h.Get(k))
+	}
+	return nil
+}
+
+// Extract 实现opentracing.Tracer接口
+func (t *Tracer) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
+	if format != opentracing.HTTPHeaders && format != opentracing.TextMap {
+		return t.Tracer.Extract(format, carrier)
+	}
+	r, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return nil, opentracing.ErrInvalidCarrier
+	}
 
-	return &Tracer{
-		Tracer: tracer,
+	h := http.Header{}
+	_ = r.ForeachKey(func(k, v string) error {
+		h.Add(k, v)
+		return nil
+	})
+	for _, p := range t.propagators {
+		if sc, ok := p.Extract(h); ok {
+			if t.ignoreParent {
+				sc.Sampled = nil
+			}
+			return zipkinAdapter.SpanContext(sc), nil
+		}
 	}
+	return nil, opentracing.ErrSpanContextNotFound
 }
 
 // SpanFromContext 从context中获取Span
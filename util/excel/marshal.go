@@ -0,0 +1,123 @@
+package excel
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"io"
+	"reflect"
+)
+
+// maxRow xlsx的最大行数，下拉验证作用到整列
+const maxRow = 1048576
+
+// Sheet 一个工作表及其数据
+// 导出时Data为结构体切片，为结构体时只生成标题，用作导入模板；导入时Data为结构体切片的指针
+type Sheet struct {
+	// Name 工作表名称，为空时为Sheet1
+	Name string
+	Data interface{}
+}
+
+// Marshal 按excel标签导出多个工作表，标题带comment批注，enum列带下拉选项
+func Marshal(w io.Writer, sheets ...Sheet) error {
+	f := excelize.NewFile()
+	for i, sheet := range sheets {
+		name := sheetName(sheet)
+		if i == 0 {
+			f.SetSheetName("Sheet1", name)
+		} else {
+			f.NewSheet(name)
+		}
+		if err := writeSheet(f, name, sheet.Data, "#FFFF99"); err != nil {
+			return err
+		}
+	}
+	return f.Write(w)
+}
+
+func sheetName(sheet Sheet) string {
+	if sheet.Name == "" {
+		return "Sheet1"
+	}
+	return sheet.Name
+}
+
+// writeSheet 写入标题、批注、下拉与数据
+func writeSheet(f *excelize.File, name string, data interface{}, titleColor string) error {
+	t, err := structType(data)
+	if err != nil {
+		return err
+	}
+	cols := columns(t)
+
+	styleID, err := titleStyle(f, titleColor)
+	if err != nil {
+		return err
+	}
+
+	for i := range cols {
+		c := &cols[i]
+		axis, err := excelize.CoordinatesToCellName(i+1, 1)
+		if err != nil {
+			return err
+		}
+		if err := f.SetCellValue(name, axis, c.header); err != nil {
+			return err
+		}
+		if c.comment != "" {
+			if err := f.AddComment(name, axis, comment(c.comment)); err != nil {
+				return err
+			}
+		}
+		if c.enum != nil {
+			col, _ := excelize.ColumnNumberToName(i + 1)
+			dv := excelize.NewDataValidation(true)
+			dv.SetSqref(fmt.Sprintf("%s2:%s%d", col, col, maxRow))
+			if err := dv.SetDropList(c.labels()); err != nil {
+				return err
+			}
+			f.AddDataValidation(name, dv)
+		}
+	}
+	if len(cols) > 0 {
+		end, _ := excelize.CoordinatesToCellName(len(cols), 1)
+		if err := f.SetCellStyle(name, "A1", end, styleID); err != nil {
+			return err
+		}
+	}
+
+	v := reflect.ValueOf(data)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return nil
+	}
+
+	row := make([]interface{}, len(cols))
+	for i := 0; i < v.Len(); i++ {
+		item := reflect.Indirect(v.Index(i))
+		for j := range cols {
+			row[j] = toCell(item.Field(cols[j].field), &cols[j])
+		}
+		axis, _ := excelize.CoordinatesToCellName(1, i+2)
+		if err := f.SetSheetRow(name, axis, &row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func titleStyle(f *excelize.File, color string) (int, error) {
+	return f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+		Fill: excelize.Fill{Type: "pattern", Color: []string{color}, Pattern: 1},
+	})
+}
+
+// comment 批注的格式参数
+func comment(text string) string {
+	b, _ := json.Marshal(map[string]string{"author": "", "text": text})
+	return string(b)
+}
@@ -0,0 +1,141 @@
+package excel
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"github.com/Jarnpher553/gemini/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type product struct {
+	Name     string    `excel:"名称" binding:"required"`
+	Price    float64   `excel:"价格" binding:"gte=0"`
+	Status   int       `excel:"状态" enum:"1:上架,2:下架" comment:"上架或下架"`
+	Listed   json.Date `excel:"上架日期"`
+	Internal string
+}
+
+func TestMarshalUnmarshal(t *testing.T) {
+	listed := json.Date(time.Date(2020, 11, 1, 0, 0, 0, 0, time.Local))
+	products := []product{
+		{Name: "苹果", Price: 5.5, Status: 1, Listed: listed, Internal: "x"},
+		{Name: "香蕉", Price: 3, Status: 2},
+	}
+
+	var buf bytes.Buffer
+	err := Marshal(&buf, Sheet{Name: "商品", Data: products}, Sheet{Name: "模板", Data: product{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out []*product
+	if err := Unmarshal(bytes.NewReader(buf.Bytes()), Sheet{Name: "商品", Data: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 || out[0].Name != "苹果" || out[0].Status != 1 || out[1].Status != 2 || out[0].Internal != "" {
+		t.Fatalf("unexpected products %+v %+v", out[0], out[1])
+	}
+	if time.Time(out[0].Listed) != time.Time(listed) {
+		t.Fatalf("unexpected date %v", time.Time(out[0].Listed))
+	}
+
+	f, err := excelize.OpenReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := f.GetRows("模板")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(template) != 1 || strings.Join(template[0], ",") != "名称,价格,状态,上架日期" {
+		t.Fatalf("unexpected template %v", template)
+	}
+}
+
+func TestUnmarshal_Errors(t *testing.T) {
+	f := excelize.NewFile()
+	rows := [][]interface{}{
+		{"名称", "价格", "状态"},
+		{"苹果", "abc", "上架"},
+		{"", "-1", "下架"},
+		{},
+		{"梨", "2", "缺货"},
+		{"桃", "3", "上架"},
+	}
+	for i, row := range rows {
+		axis, _ := excelize.CoordinatesToCellName(1, i+1)
+		r := row
+		_ = f.SetSheetRow("Sheet1", axis, &r)
+	}
+	var in bytes.Buffer
+	if err := f.Write(&in); err != nil {
+		t.Fatal(err)
+	}
+
+	var out []product
+	err := Unmarshal(&in, Sheet{Data: &out})
+	importErr, ok := err.(*ImportError)
+	if !ok {
+		t.Fatalf("want ImportError, got %v", err)
+	}
+	if len(out) != 1 || out[0].Name != "桃" {
+		t.Fatalf("only valid rows should be imported, got %+v", out)
+	}
+
+	got := make(map[string]string)
+	for _, e := range importErr.Errors {
+		got[e.Axis] = e.Message
+	}
+	want := map[string]string{"": "缺少该列", "B2": "不是有效的数字", "A3": "不能为空", "B3": "不能小于0", "C5": "不是有效的选项，可选：上架、下架"}
+	for axis, msg := range want {
+		if got[axis] != msg {
+			t.Errorf("cell %q want %q, got %q", axis, msg, got[axis])
+		}
+	}
+
+	var report bytes.Buffer
+	if err := importErr.Report(&report); err != nil {
+		t.Fatal(err)
+	}
+	annotated, err := excelize.OpenReader(&report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	styleID, _ := annotated.GetCellStyle("Sheet1", "B2")
+	if styleID == 0 {
+		t.Fatal("error cell should be highlighted")
+	}
+}
+
+func TestGen_ManyColumns(t *testing.T) {
+	fields := make([]reflect.StructField, 30)
+	for i := range fields {
+		fields[i] = reflect.StructField{
+			Name: fmt.Sprintf("C%d", i+1),
+			Type: reflect.TypeOf(0),
+			Tag:  reflect.StructTag(fmt.Sprintf(`excel:"列%d"`, i+1)),
+		}
+	}
+	typ := reflect.StructOf(fields)
+	entities := reflect.MakeSlice(reflect.SliceOf(typ), 1, 1)
+	entities.Index(0).Field(29).SetInt(30)
+
+	buf, err := Gen(entities.Interface())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := f.GetCellValue("Sheet1", "AD1"); v != "列30" {
+		t.Fatalf("unexpected title %q", v)
+	}
+	if v, _ := f.GetCellValue("Sheet1", "AD2"); v != "30" {
+		t.Fatalf("unexpected value %q", v)
+	}
+}
@@ -4,14 +4,17 @@ import (
 	"errors"
 	"io"
 )
-import "github.com/360EntSecGroup-Skylar/excelize"
+import "github.com/360EntSecGroup-Skylar/excelize/v2"
 
 func Parse(file io.Reader, sheetName string) ([]map[string]string, error) {
 	f, err := excelize.OpenReader(file)
 	if err != nil {
 		return nil, err
 	}
-	content := f.GetRows(sheetName)
+	content, err := f.GetRows(sheetName)
+	if err != nil {
+		return nil, err
+	}
 
 	if len(content) < 2 {
 		return nil, errors.New("too few rows")
@@ -0,0 +1,69 @@
+package excel
+
+import (
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"github.com/Jarnpher553/gemini/repo"
+	"io"
+	"reflect"
+)
+
+// Stream 逐行读取rows并以流的方式生成xlsx写入w，标题与样式规则与Gen一致
+// row为行结构体或其指针，仅用于确定列；超出内存缓冲的行暂存于临时文件
+func Stream(w io.Writer, rows repo.Rows, row interface{}, titleColor ...string) error {
+	tc := "#FFFF99"
+	if len(titleColor) != 0 {
+		tc = titleColor[0]
+	}
+
+	t, err := structType(row)
+	if err != nil {
+		return err
+	}
+	cols := columns(t)
+
+	f := excelize.NewFile()
+	sw, err := f.NewStreamWriter("Sheet1")
+	if err != nil {
+		return err
+	}
+
+	styleID, err := titleStyle(f, tc)
+	if err != nil {
+		return err
+	}
+	title := make([]interface{}, len(cols))
+	for i := range cols {
+		title[i] = excelize.Cell{StyleID: styleID, Value: cols[i].header}
+	}
+	if err := sw.SetRow("A1", title); err != nil {
+		return err
+	}
+
+	v := reflect.New(t)
+	values := make([]interface{}, len(cols))
+	for n := 2; rows.Next(); n++ {
+		v.Elem().Set(reflect.Zero(t))
+		if err := rows.Scan(v.Interface()); err != nil {
+			return err
+		}
+		for i := range cols {
+			values[i] = toCell(v.Elem().Field(cols[i].field), &cols[i])
+		}
+
+		axis, err := excelize.CoordinatesToCellName(1, n)
+		if err != nil {
+			return err
+		}
+		if err := sw.SetRow(axis, values); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+	return f.Write(w)
+}
@@ -0,0 +1,32 @@
+package excel
+
+import (
+	"bytes"
+	"github.com/Jarnpher553/gemini/repo"
+	"testing"
+)
+
+type record struct {
+	ID     int    `excel:"编号"`
+	Name   string `excel:"名称"`
+	Ignore string
+}
+
+func TestStream(t *testing.T) {
+	var buf bytes.Buffer
+	rows := repo.SliceRows([]record{{1, "a", "x"}, {2, "b", "y"}})
+	if err := Stream(&buf, rows, record{}); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := Parse(&buf, "Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table) != 2 || table[1]["编号"] != "2" || table[1]["名称"] != "b" {
+		t.Fatalf("unexpected table %v", table)
+	}
+	if _, ok := table[0]["Ignore"]; ok {
+		t.Fatal("untagged field should not be exported")
+	}
+}
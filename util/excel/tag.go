@@ -0,0 +1,236 @@
+package excel
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// column 由结构体标签描述的一列
+// excel为标题，comment为标题批注，enum为"值:显示文本"的逗号分隔列表，导出时显示文本、导入时还原为值并生成下拉
+type column struct {
+	field   int
+	name    string
+	header  string
+	comment string
+	enum    [][2]string
+}
+
+// columns 解析带excel标签的字段
+func columns(t reflect.Type) []column {
+	var cols []column
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		header := f.Tag.Get("excel")
+		if header == "" || header == "-" {
+			continue
+		}
+
+		c := column{field: i, name: f.Name, header: header, comment: f.Tag.Get("comment")}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			for _, item := range strings.Split(enum, ",") {
+				kv := strings.SplitN(item, ":", 2)
+				if len(kv) == 1 {
+					kv = append(kv, kv[0])
+				}
+				c.enum = append(c.enum, [2]string{strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])})
+			}
+		}
+		cols = append(cols, c)
+	}
+	return cols
+}
+
+// labels 下拉选项
+func (c *column) labels() []string {
+	labels := make([]string, 0, len(c.enum))
+	for _, item := range c.enum {
+		labels = append(labels, item[1])
+	}
+	return labels
+}
+
+// structType 取切片、指针下的结构体类型
+func structType(v interface{}) (reflect.Type, error) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil, errors.New("nil data")
+	}
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, errors.New("data must be a struct or a slice of struct")
+	}
+	return t, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// layouts 导入时支持的日期格式
+var layouts = []string{
+	"2006-01-02 15:04:05",
+	"2006/1/2 15:04:05",
+	"2006-01-02 15:04",
+	"2006/1/2 15:04",
+	"2006-01-02",
+	"2006/1/2",
+	"2006-1-2",
+	"01-02-06",
+	"1/2/06 15:04",
+	"1/2/06",
+}
+
+// toCell 字段值转换为单元格的值
+func toCell(v reflect.Value, c *column) interface{} {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	if c.enum != nil {
+		s := fmt.Sprint(v.Interface())
+		for _, item := range c.enum {
+			if item[0] == s {
+				return item[1]
+			}
+		}
+		return s
+	}
+
+	if v.Type() == timeType {
+		if v.IsZero() {
+			return nil
+		}
+		return v.Interface()
+	}
+	if v.Kind() == reflect.Struct && v.IsZero() {
+		return nil
+	}
+
+	// json.Date等类型的方法定义在指针上
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	switch i := p.Interface().(type) {
+	case encoding.TextMarshaler:
+		text, err := i.MarshalText()
+		if err == nil {
+			return string(text)
+		}
+	case fmt.Stringer:
+		return i.String()
+	}
+	return v.Interface()
+}
+
+// fromCell 单元格文本转换为字段值，返回的错误作为单元格的错误说明
+func fromCell(s string, v reflect.Value, c *column) error {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+
+	if c.enum != nil {
+		var found bool
+		for _, item := range c.enum {
+			if item[1] == s || item[0] == s {
+				s, found = item[0], true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("不是有效的选项，可选：%s", strings.Join(c.labels(), "、"))
+		}
+	}
+
+	if v.Kind() == reflect.Ptr {
+		e := reflect.New(v.Type().Elem())
+		if err := fromCell(s, e.Elem(), &column{}); err != nil {
+			return err
+		}
+		v.Set(e)
+		return nil
+	}
+
+	if v.Kind() == reflect.Struct && v.Type().ConvertibleTo(timeType) {
+		t, err := parseTime(s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t).Convert(v.Type()))
+		return nil
+	}
+
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			return errors.New("格式不正确")
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			f, ferr := strconv.ParseFloat(s, 64)
+			if ferr != nil || f != float64(int64(f)) {
+				return errors.New("不是有效的整数")
+			}
+			n = int64(f)
+		}
+		if v.OverflowInt(n) {
+			return errors.New("数值超出范围")
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return errors.New("不是有效的非负整数")
+		}
+		if v.OverflowUint(n) {
+			return errors.New("数值超出范围")
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return errors.New("不是有效的数字")
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		switch strings.ToLower(s) {
+		case "1", "true", "是", "y", "yes":
+			v.SetBool(true)
+		case "0", "false", "否", "n", "no":
+			v.SetBool(false)
+		default:
+			return errors.New("应为是或否")
+		}
+	default:
+		return fmt.Errorf("不支持的字段类型%s", v.Type())
+	}
+	return nil
+}
+
+// parseTime 解析日期文本或Excel日期序列号
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && f > 0 {
+		days := int(f)
+		seconds := int((f-float64(days))*86400 + 0.5)
+		return time.Date(1899, 12, 30, 0, 0, seconds, 0, time.Local).AddDate(0, 0, days), nil
+	}
+	return time.Time{}, errors.New("不是有效的日期")
+}
@@ -0,0 +1,238 @@
+package excel
+
+import (
+	"errors"
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"github.com/Jarnpher553/gemini/validator"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// CellError 单元格的错误，Column为空时为整行的错误
+type CellError struct {
+	Sheet   string
+	Row     int
+	Column  string
+	Axis    string
+	Message string
+}
+
+func (e *CellError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("%s 第%d行：%s", e.Sheet, e.Row, e.Message)
+	}
+	return fmt.Sprintf("%s 第%d行 %s：%s", e.Sheet, e.Row, e.Column, e.Message)
+}
+
+// ImportError 导入时的所有单元格错误
+type ImportError struct {
+	Errors []*CellError
+	file   *excelize.File
+}
+
+func (e *ImportError) Error() string {
+	const max = 5
+	var msgs []string
+	for i, err := range e.Errors {
+		if i == max {
+			msgs = append(msgs, fmt.Sprintf("等%d个错误", len(e.Errors)))
+			break
+		}
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "；")
+}
+
+// Report 在上传的工作簿上标红出错的单元格并以批注写明原因，写入w供用户下载
+func (e *ImportError) Report(w io.Writer) error {
+	messages := make(map[string][]string)
+	var cells []string
+	for _, err := range e.Errors {
+		axis := err.Axis
+		if axis == "" {
+			axis, _ = excelize.CoordinatesToCellName(1, err.Row)
+		}
+		key := err.Sheet + "!" + axis
+		if _, ok := messages[key]; !ok {
+			cells = append(cells, key)
+		}
+		msg := err.Message
+		if err.Column == "" {
+			msg = "整行：" + msg
+		}
+		messages[key] = append(messages[key], msg)
+	}
+
+	styleID, err := e.file.NewStyle(&excelize.Style{
+		Fill: excelize.Fill{Type: "pattern", Color: []string{"#FFC7CE"}, Pattern: 1},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range cells {
+		i := strings.LastIndex(key, "!")
+		sheet, axis := key[:i], key[i+1:]
+		if err := e.file.SetCellStyle(sheet, axis, axis, styleID); err != nil {
+			return err
+		}
+		if err := e.file.AddComment(sheet, axis, comment(strings.Join(messages[key], "\n"))); err != nil {
+			return err
+		}
+	}
+	return e.file.Write(w)
+}
+
+// Unmarshal 读取工作簿，按标题匹配excel标签转换到结构体并以binding规则校验
+// 只有没有错误的行追加到Data，存在错误时返回*ImportError，可调用Report生成标注后的工作簿
+func Unmarshal(r io.Reader, sheets ...Sheet) error {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return err
+	}
+
+	importErr := &ImportError{file: f}
+	for _, sheet := range sheets {
+		if err := readSheet(f, sheetName(sheet), sheet.Data, importErr); err != nil {
+			return err
+		}
+	}
+
+	if len(importErr.Errors) > 0 {
+		return importErr
+	}
+	return nil
+}
+
+func readSheet(f *excelize.File, name string, data interface{}, importErr *ImportError) error {
+	out := reflect.ValueOf(data)
+	if out.Kind() != reflect.Ptr || out.Elem().Kind() != reflect.Slice {
+		return errors.New("data must be a pointer to slice")
+	}
+	slice := out.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	t, err := structType(data)
+	if err != nil {
+		return err
+	}
+	cols := columns(t)
+
+	content, err := f.GetRows(name)
+	if err != nil {
+		return err
+	}
+	if len(content) == 0 {
+		importErr.Errors = append(importErr.Errors, &CellError{Sheet: name, Row: 1, Message: "缺少标题行"})
+		return nil
+	}
+
+	// 标题文本对应的列序号
+	index := make(map[string]int)
+	for i, header := range content[0] {
+		index[strings.TrimSpace(header)] = i
+	}
+	positions := make([]int, len(cols))
+	byField := make(map[string]int)
+	for i, c := range cols {
+		byField[c.name] = i
+		p, ok := index[c.header]
+		if !ok {
+			importErr.Errors = append(importErr.Errors, &CellError{Sheet: name, Row: 1, Column: c.header, Message: "缺少该列"})
+			p = -1
+		}
+		positions[i] = p
+	}
+
+	for i := 1; i < len(content); i++ {
+		cells := content[i]
+		if blank(cells) {
+			continue
+		}
+
+		row := i + 1
+		errs := len(importErr.Errors)
+		item := reflect.New(t)
+		for j := range cols {
+			p := positions[j]
+			if p < 0 || p >= len(cells) {
+				continue
+			}
+			if err := fromCell(cells[p], item.Elem().Field(cols[j].field), &cols[j]); err != nil {
+				importErr.Errors = append(importErr.Errors, cellError(name, row, p, cols[j].header, err.Error()))
+			}
+		}
+
+		// 转换失败的行不再校验，避免同一单元格重复报错
+		if len(importErr.Errors) == errs {
+			if err := validator.Struct(item.Interface()); err != nil {
+				validationErrs, ok := err.(validator.ValidationErrors)
+				if !ok {
+					return err
+				}
+				for _, fe := range validationErrs {
+					j, ok := byField[fe.StructField()]
+					if !ok || positions[j] < 0 {
+						importErr.Errors = append(importErr.Errors, &CellError{Sheet: name, Row: row, Message: message(fe.Field(), fe.Tag(), fe.Param())})
+						continue
+					}
+					importErr.Errors = append(importErr.Errors, cellError(name, row, positions[j], cols[j].header, message(cols[j].header, fe.Tag(), fe.Param())))
+				}
+			}
+		}
+
+		if len(importErr.Errors) == errs {
+			if isPtr {
+				slice.Set(reflect.Append(slice, item))
+			} else {
+				slice.Set(reflect.Append(slice, item.Elem()))
+			}
+		}
+	}
+
+	return nil
+}
+
+func cellError(sheet string, row, col int, header, msg string) *CellError {
+	axis, _ := excelize.CoordinatesToCellName(col+1, row)
+	return &CellError{Sheet: sheet, Row: row, Column: header, Axis: axis, Message: msg}
+}
+
+func blank(cells []string) bool {
+	for _, c := range cells {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// message 常用校验规则的说明
+func message(field, tag, param string) string {
+	switch tag {
+	case "required":
+		return "不能为空"
+	case "min", "gte":
+		return "不能小于" + param
+	case "max", "lte":
+		return "不能大于" + param
+	case "gt":
+		return "应大于" + param
+	case "lt":
+		return "应小于" + param
+	case "len":
+		return "长度应为" + param
+	case "oneof":
+		return "应为" + strings.Join(strings.Fields(param), "、") + "之一"
+	case "email":
+		return "不是有效的邮箱"
+	case "numeric", "number":
+		return "应为数字"
+	}
+	if param != "" {
+		return fmt.Sprintf("%s不满足%s=%s", field, tag, param)
+	}
+	return fmt.Sprintf("%s不满足%s", field, tag)
+}
@@ -88,3 +88,11 @@ type FieldLevel interface {
 }
 
 type Func func(v *Validate, fl FieldLevel) bool
+
+// ValidationErrors 校验失败时Struct返回的错误
+type ValidationErrors = validator.ValidationErrors
+
+// Struct 按binding标签校验结构体，规则与请求绑定时一致
+func Struct(s interface{}) error {
+	return v.Struct(s)
+}